@@ -0,0 +1,212 @@
+package main
+
+import (
+	"BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	sched "BeanGithub/crawler/scheduler"
+	"BeanGithub/crawler/toolkit/deadletter"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// 命令参数。
+var (
+	storePath     string
+	errorType     string
+	host          string
+	urlPrefix     string
+	errorContains string
+	minAttempts   uint
+	since         string
+	until         string
+	jsonOutput    bool
+	outPath       string
+	removeAfter   bool
+)
+
+func init() {
+	flag.StringVar(&storePath, "store", "./dead_letters.jsonl",
+		"The path of the dead letter store file.")
+	flag.StringVar(&errorType, "type", "",
+		"Only the dead letters with this error type, e.g. \"downloader error\".")
+	flag.StringVar(&host, "host", "",
+		"Only the dead letters whose URL host is this.")
+	flag.StringVar(&urlPrefix, "prefix", "",
+		"Only the dead letters whose URL starts with this.")
+	flag.StringVar(&errorContains, "contains", "",
+		"Only the dead letters whose error message contains this.")
+	flag.UintVar(&minAttempts, "min-attempts", 0,
+		"Only the dead letters with at least this number of attempts.")
+	flag.StringVar(&since, "since", "",
+		"Only the dead letters failed since this time (RFC 3339) or duration ago, e.g. \"24h\".")
+	flag.StringVar(&until, "until", "",
+		"Only the dead letters failed before this time (RFC 3339) or duration ago.")
+	flag.BoolVar(&jsonOutput, "json", false,
+		"Print the dead letters as JSON lines.")
+	flag.StringVar(&outPath, "out", "./checkpoint.json",
+		"The path of the checkpoint file written by the export command.")
+	flag.BoolVar(&removeAfter, "remove", false,
+		"Remove the exported dead letters from the store.")
+}
+
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\tdeadletter [flags] list|remove|export\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "\tlist\tList the matched dead letters.\n")
+	fmt.Fprintf(os.Stderr, "\tremove\tRemove the matched dead letters.\n")
+	fmt.Fprintf(os.Stderr, "\texport\tWrite the matched dead letters to a checkpoint file "+
+		"so that a new scheduler can re-crawl them by StartFrom.\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = Usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		Usage()
+		os.Exit(2)
+	}
+	filter, err := genFilter()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Illegal filter: %s\n", err)
+		os.Exit(2)
+	}
+	store, err := deadletter.Open(storePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't open dead letter store: %s\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	letters, err := store.List(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't list dead letters: %s\n", err)
+		os.Exit(1)
+	}
+	switch command := flag.Arg(0); command {
+	case "list":
+		err = list(letters)
+	case "remove":
+		err = remove(store, letters)
+	case "export":
+		err = export(store, letters)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n", command)
+		Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurs: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// genFilter 根据命令参数生成死信的过滤条件。
+func genFilter() (deadletter.Filter, error) {
+	filter := deadletter.Filter{
+		ErrorType:     errors.ErrorType(errorType),
+		Host:          host,
+		URLPrefix:     urlPrefix,
+		ErrorContains: errorContains,
+		MinAttempts:   uint32(minAttempts),
+	}
+	var err error
+	if filter.Since, err = parseTime(since); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseTime(until); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseTime 解析RFC 3339格式的时间，或者距今的时长。
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("neither a time nor a duration: %q", value)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// list 打印给定的死信。
+func list(letters []deadletter.Letter) error {
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, letter := range letters {
+			if err := encoder.Encode(letter); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "LAST FAILED\tTYPE\tATTEMPTS\tFAILURES\tDEPTH\tURL\tERROR")
+	for _, letter := range letters {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			letter.LastFailed.Format(time.RFC3339), letter.ErrorType,
+			letter.Attempts, letter.Failures, letter.Depth, letter.URL, letter.Error)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Total: %d\n", len(letters))
+	return nil
+}
+
+// remove 从存储中删除给定的死信。
+func remove(store deadletter.Store, letters []deadletter.Letter) error {
+	urls := make([]string, len(letters))
+	for i, letter := range letters {
+		urls[i] = letter.URL
+	}
+	removed, err := store.Remove(urls...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed: %d\n", removed)
+	return nil
+}
+
+// export 把给定的死信写入检查点文件。
+// 未记录请求体的死信会被跳过，也不会被删除。
+func export(store deadletter.Store, letters []deadletter.Letter) error {
+	reqs := make([]*module.Request, 0, len(letters))
+	exported := make([]deadletter.Letter, 0, len(letters))
+	for _, letter := range letters {
+		req, err := letter.Request()
+		if err == deadletter.ErrBodyDropped {
+			fmt.Fprintf(os.Stderr, "Warning: skip dead letter without request body (%s %s)\n",
+				letter.Method, letter.URL)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("illegal dead letter (URL: %s): %s", letter.URL, err)
+		}
+		reqs = append(reqs, req)
+		exported = append(exported, letter)
+	}
+	cp, err := sched.NewCheckpoint(reqs)
+	if err != nil {
+		return err
+	}
+	if err := cp.Save(outPath); err != nil {
+		return err
+	}
+	fmt.Printf("Exported: %d (checkpoint: %s)\n", len(reqs), outPath)
+	if removeAfter {
+		return remove(store, exported)
+	}
+	return nil
+}
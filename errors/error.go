@@ -3,6 +3,7 @@ package errors
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // ErrorType 错误类型。
@@ -35,6 +36,8 @@ type myCrawlerError struct {
 	errMsg string
 	// fullErrMsg 完整的错误提示信息。
 	fullErrMsg string
+	// cause 导致该错误的底层错误。可能为nil。
+	cause error
 }
 
 // NewCrawlerError 创建新的爬虫错误。
@@ -46,8 +49,13 @@ func NewCrawlerError(errType ErrorType, errMsg string) CrawlerError {
 }
 
 // NewCrawlerErrorBy 根据给定的错误创建新的爬虫错误。
+// 给定的错误会作为底层错误保留，可以通过errors.Is和errors.As检查。
 func NewCrawlerErrorBy(errType ErrorType, err error) CrawlerError {
-	return NewCrawlerError(errType, err.Error())
+	return &myCrawlerError{
+		errType: errType,
+		errMsg:  err.Error(),
+		cause:   err,
+	}
 }
 
 // Type 获取错误类型。
@@ -63,6 +71,11 @@ func (ce *myCrawlerError) Error() string {
 	return ce.fullErrMsg
 }
 
+// Unwrap 获取导致该错误的底层错误。
+func (ce *myCrawlerError) Unwrap() error {
+	return ce.cause
+}
+
 // getFullErrMsg 生成错误信息，并赋值给相应字段。
 func (ce *myCrawlerError) genFullErrMsg() {
 	var builder strings.Builder
@@ -91,3 +104,49 @@ func NewIllegalParameterError(errMsg string) IllegalParameterError {
 func (ipe IllegalParameterError) Error() string {
 	return ipe.msg
 }
+
+// TimeoutError 超时错误类型。
+type TimeoutError struct {
+	// URL 超时的请求的URL。
+	URL string
+	// Limit 超时时间。为0时表示未知。
+	Limit time.Duration
+	// Err 导致超时的底层错误。可能为nil。
+	Err error
+}
+
+// NewTimeoutError 新建一个超时错误实例。
+func NewTimeoutError(url string, timeout time.Duration, err error) *TimeoutError {
+	return &TimeoutError{URL: url, Limit: timeout, Err: err}
+}
+
+func (te *TimeoutError) Error() string {
+	var builder strings.Builder
+	builder.WriteString("timeout")
+	if te.Limit > 0 {
+		builder.WriteString(fmt.Sprintf(" after %s", te.Limit))
+	}
+	if te.URL != "" {
+		builder.WriteString(fmt.Sprintf(" (URL: %s)", te.URL))
+	}
+	if te.Err != nil {
+		builder.WriteString(": ")
+		builder.WriteString(te.Err.Error())
+	}
+	return builder.String()
+}
+
+// Unwrap 获取导致超时的底层错误。
+func (te *TimeoutError) Unwrap() error {
+	return te.Err
+}
+
+// Timeout 表明该错误是超时错误。
+func (te *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary 表明该错误是暂时性的。
+func (te *TimeoutError) Temporary() bool {
+	return true
+}
@@ -2,17 +2,25 @@ package internal
 
 import (
 	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/link"
 	"fmt"
 	"net/http"
-	"net/url"
 	"path"
 	"strings"
-
-	"github.com/PuerkitoBio/goquery"
 )
 
+// defaultFollowedLinkKinds 默认需要跟进的链接的种类。
+// 图片链接也需要跟进，以便由图片解析函数生成条目。
+var defaultFollowedLinkKinds = []link.Kind{
+	link.KIND_ANCHOR,
+	link.KIND_IMAGE,
+}
+
 // genResponseParsers 生成响应解析器。
-func genResponseParsers() []module.ParseResponse {
+// 参数extraKinds 除默认种类之外还需要跟进的链接的种类，
+// 例如link.KIND_FRAME和link.KIND_REFRESH。它们会扩大爬取的范围。
+func genResponseParsers(extraKinds ...link.Kind) []module.ParseResponse {
+	followedLinkKinds := append(append([]link.Kind{}, defaultFollowedLinkKinds...), extraKinds...)
 	parseLink := func(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
 		dataList := make([]module.Data, 0)
 		// 检查响应。
@@ -48,64 +56,21 @@ func genResponseParsers() []module.ParseResponse {
 		if !matchedContentType {
 			return dataList, nil
 		}
-		// 解析HTTP响应体。
-		doc, err := goquery.NewDocumentFromReader(body)
+		// 解析HTTP响应体并提取需要跟进的链接。
+		links, err := link.Parse(body, reqURL)
 		if err != nil {
 			return dataList, []error{err}
 		}
 		errs := make([]error, 0)
-		// 查找a标签并提取链接地址。
-		doc.Find("a").Each(func(index int, sel *goquery.Selection) {
-			href, exists := sel.Attr("href")
-			// 前期过滤。
-			if !exists || href == "" || href == "#" || href == "/" {
-				return
-			}
-			href = strings.TrimSpace(href)
-			lowerHref := strings.ToLower(href)
-			if href == "" || strings.HasPrefix(lowerHref, "javascript") {
-				return
-			}
-			aURL, err := url.Parse(href)
-			if err != nil {
-				fmt.Printf("An error occurs when parsing attribute %q in tag %q: %s (href: %s)",
-					err, "href", "a", href)
-				return
-			}
-			if !aURL.IsAbs() {
-				aURL = reqURL.ResolveReference(aURL)
-			}
-			httpReq, err := http.NewRequest("GET", aURL.String(), nil)
-			if err != nil {
-				errs = append(errs, err)
-			} else {
-				req := module.NewRequest(httpReq, respDepth)
-				dataList = append(dataList, req)
-			}
-		})
-		// 查找img标签并提取地址。
-		doc.Find("img").Each(func(index int, sel *goquery.Selection) {
-			imgSrc, exists := sel.Attr("src")
-			if !exists || imgSrc == "" || imgSrc == "#" || imgSrc == "/" {
-				return
-			}
-			imgSrc = strings.TrimSpace(imgSrc)
-			imgURL, err := url.Parse(imgSrc)
-			if err != nil {
-				errs = append(errs, err)
-				return
-			}
-			if !imgURL.IsAbs() {
-				imgURL = reqURL.ResolveReference(imgURL)
-			}
-			httpReq, err := http.NewRequest("GET", imgURL.String(), nil)
+		for _, l := range link.Filter(links, followedLinkKinds...) {
+			httpReq, err := http.NewRequest("GET", l.URL.String(), nil)
 			if err != nil {
 				errs = append(errs, err)
 			} else {
 				req := module.NewRequest(httpReq, respDepth)
 				dataList = append(dataList, req)
 			}
-		})
+		}
 		return dataList, errs
 	}
 	parseImg := func(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
@@ -61,6 +61,14 @@ type Downloader interface {
 	Download(req *Request) (*Response, error)
 }
 
+// CookieJarUser 可以使用外部Cookie存储器的下载器的接口类型。
+// 调度器会让实现了该接口的所有下载器共享同一个Cookie存储器。
+type CookieJarUser interface {
+	// SetCookieJar 设置下载时使用的Cookie存储器。为nil时表示不使用。
+	// 应该在开始下载之前调用。
+	SetCookieJar(jar http.CookieJar)
+}
+
 // Analyzer 分析器的接口类型。
 // 该接口的实现类型必须是并发安全的！
 type Analyzer interface {
@@ -72,6 +80,13 @@ type Analyzer interface {
 	Analyze(resp *Response) ([]Data, []error)
 }
 
+// ResponseMatcher 可以声明所接受的响应的分析器的接口类型。
+// 调度器只会把响应交给接受它的分析器，未实现该接口的分析器被视为接受所有响应。
+type ResponseMatcher interface {
+	// Accepts 判断是否接受给定的响应。
+	Accepts(resp *Response) bool
+}
+
 // ParseResponse 用于解析HTTP响应的函数类型。
 type ParseResponse func(httpResp *http.Response, respDepth uint32) ([]Data, []error)
 
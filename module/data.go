@@ -1,7 +1,13 @@
 package module
 
 import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 // Data 数据接口类型。
@@ -16,13 +22,83 @@ type Request struct {
 	httpReq *http.Request
 	// depth 请求深度。
 	depth uint32
+	// priority 请求优先级。数值越大越优先。
+	priority float64
+	// attempt 已经失败的下载尝试的次数。
+	attempt uint32
+	// ctx 下载时使用的上下文。为nil时使用http请求的上下文。
+	ctx context.Context
+	// lastModified 请求的资源的已知的最后修改时间，例如站点地图中声明的时间。
+	lastModified time.Time
+	// checkRedirect 下载时跟随重定向之前的检查函数。为nil时不做检查。
+	checkRedirect CheckRedirect
 }
 
+// CheckRedirect 检查重定向的函数类型。
+// 参数target 重定向的目标请求。可以修改其URL，例如将其规范化。
+// 参数via 此前经过的请求，第一个是原始请求。
+// 返回非nil的错误值时，下载器不会跟随该重定向，下载会以该错误值（或包装它的错误值）失败。
+type CheckRedirect func(target *http.Request, via []*http.Request) error
+
 // NewRequest 创建一个请求实例。
 func NewRequest(httpReq *http.Request, depth uint32) *Request {
 	return &Request{httpReq: httpReq, depth: depth}
 }
 
+// WithDepth 创建一个深度为给定值、其余部分都与当前请求相同的请求实例。
+func (req *Request) WithDepth(depth uint32) *Request {
+	newReq := *req
+	newReq.depth = depth
+	return &newReq
+}
+
+// WithAttempt 创建一个失败尝试次数为给定值、其余部分都与当前请求相同的请求实例。
+func (req *Request) WithAttempt(attempt uint32) *Request {
+	newReq := *req
+	newReq.attempt = attempt
+	return &newReq
+}
+
+// WithHTTPReq 创建一个http请求为给定值、其余部分都与当前请求相同的请求实例。
+func (req *Request) WithHTTPReq(httpReq *http.Request) *Request {
+	newReq := *req
+	newReq.httpReq = httpReq
+	return &newReq
+}
+
+// WithContext 创建一个上下文为给定值、其余部分都与当前请求相同的请求实例。
+// 下载器应该在该上下文结束时中止下载。
+func (req *Request) WithContext(ctx context.Context) *Request {
+	newReq := *req
+	newReq.ctx = ctx
+	return &newReq
+}
+
+// WithCheckRedirect 创建一个重定向检查函数为给定值、其余部分都与当前请求相同的请求实例。
+// 下载器应该在跟随每次重定向之前调用该函数。
+func (req *Request) WithCheckRedirect(check CheckRedirect) *Request {
+	newReq := *req
+	newReq.checkRedirect = check
+	return &newReq
+}
+
+// CheckRedirect 获取下载时跟随重定向之前的检查函数。未设置时为nil。
+func (req *Request) CheckRedirect() CheckRedirect {
+	return req.checkRedirect
+}
+
+// Context 获取下载时使用的上下文。
+// 未设置时为http请求的上下文。
+func (req *Request) Context() context.Context {
+	if req.ctx != nil {
+		return req.ctx
+	}
+	if req.httpReq != nil {
+		return req.httpReq.Context()
+	}
+	return context.Background()
+}
+
 // HTTPReq 获取http请求。
 func (req *Request) HTTPReq() *http.Request {
 	return req.httpReq
@@ -33,17 +109,113 @@ func (req *Request) Depth() uint32 {
 	return req.depth
 }
 
+// Attempt 获取已经失败的下载尝试的次数。
+// 首次下载之前为0。
+func (req *Request) Attempt() uint32 {
+	return req.attempt
+}
+
+// Priority 获取请求优先级。
+func (req *Request) Priority() float64 {
+	return req.priority
+}
+
+// SetPriority 设置请求优先级。
+// 应该在把请求交给调度器之前调用。
+func (req *Request) SetPriority(priority float64) {
+	req.priority = priority
+}
+
+// LastModified 获取请求的资源的已知的最后修改时间。
+// 未知时为零值。
+func (req *Request) LastModified() time.Time {
+	return req.lastModified
+}
+
+// SetLastModified 设置请求的资源的已知的最后修改时间。
+// 应该在把请求交给调度器之前调用。
+func (req *Request) SetLastModified(lastModified time.Time) {
+	req.lastModified = lastModified
+}
+
 // Valid 判断请求是否有效。
 func (req *Request) Valid() bool {
 	return req.httpReq != nil && req.httpReq.URL != nil
 }
 
+// CredentialHeaders 包含凭据的请求头部。
+// 检查点和死信等持久化的请求中不会包含它们。
+var CredentialHeaders = []string{"Cookie", "Authorization", "Proxy-Authorization"}
+
+// StripCredentials 返回去掉了凭据类头部的请求头部副本。结果为空时返回nil。
+func StripCredentials(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	header = header.Clone()
+	for _, key := range CredentialHeaders {
+		header.Del(key)
+	}
+	if len(header) == 0 {
+		return nil
+	}
+	return header
+}
+
+// MaxPersistedBodySize 持久化的请求中的请求体的最大长度。
+var MaxPersistedBodySize int64 = 64 << 10
+
+// ErrBodyTooLarge 请求体超出最大长度的错误。
+var ErrBodyTooLarge = errors.New("request body too large to persist")
+
+// ErrBodyNotReplayable 请求体无法被重新读取的错误。
+var ErrBodyNotReplayable = errors.New("request body can't be replayed")
+
+// PersistedBody 读取请求体的副本以便将其持久化，不会消耗请求本身的请求体。
+// 没有请求体时返回nil。
+// 请求体无法被重新读取（未设置GetBody）或超出MaxPersistedBodySize时返回错误。
+func PersistedBody(httpReq *http.Request) ([]byte, error) {
+	if httpReq.Body == nil || httpReq.Body == http.NoBody {
+		return nil, nil
+	}
+	if httpReq.GetBody == nil {
+		return nil, ErrBodyNotReplayable
+	}
+	body, err := httpReq.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(body, MaxPersistedBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxPersistedBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
+
 // Response 数据响应类型。
 type Response struct {
 	// httpResp http响应。
 	httpResp *http.Response
 	// depth 响应深度。
 	depth uint32
+	// charset 响应体的字符集。为空时表示未知或者响应体不是文本。
+	charset string
+	// redirects 得到响应之前经过的重定向的列表。
+	redirects []Redirect
+}
+
+// Redirect 重定向类型。
+type Redirect struct {
+	// From 重定向之前的URL。
+	From *url.URL
+	// To 重定向之后的URL。
+	To *url.URL
+	// StatusCode 重定向响应的状态码。
+	StatusCode int
 }
 
 // NewResponse 创建一个响应实例。
@@ -61,6 +233,42 @@ func (resp *Response) Depth() uint32 {
 	return resp.depth
 }
 
+// Charset 获取响应体的字符集。
+// 该字符集是响应体原本的字符集，分析器可能已经把响应体转换为UTF-8。
+func (resp *Response) Charset() string {
+	return resp.charset
+}
+
+// SetCharset 设置响应体的字符集。
+func (resp *Response) SetCharset(charset string) {
+	resp.charset = charset
+}
+
+// Redirects 获取得到响应之前经过的重定向的列表，按照发生的先后排列。
+// 未经过重定向时返回空列表。
+func (resp *Response) Redirects() []Redirect {
+	redirects := make([]Redirect, len(resp.redirects))
+	copy(redirects, resp.redirects)
+	return redirects
+}
+
+// SetRedirects 设置得到响应之前经过的重定向的列表。
+func (resp *Response) SetRedirects(redirects []Redirect) {
+	resp.redirects = redirects
+}
+
+// FinalURL 获取最终得到响应的URL。
+// 经过重定向时为最后一次重定向之后的URL，否则为http响应对应的请求的URL。
+func (resp *Response) FinalURL() *url.URL {
+	if n := len(resp.redirects); n > 0 {
+		return resp.redirects[n-1].To
+	}
+	if resp.httpResp != nil && resp.httpResp.Request != nil {
+		return resp.httpResp.Request.URL
+	}
+	return nil
+}
+
 // Valid 判断响应是否有效。
 func (resp *Response) Valid() bool {
 	return resp.httpResp != nil && resp.httpResp.Body != nil
@@ -7,12 +7,35 @@ import (
 	"fmt"
 )
 
+// Options 分析器的可选项。
+type Options struct {
+	// Body 读取响应体时使用的多重读取器的可选项。
+	// 可以限制响应体的最大长度，以及超过多大时转存到临时文件中。
+	Body reader.Options `json:"body"`
+	// NoTranscode 是否不把响应体转换为UTF-8。
+	// 为false时会探测文本响应体的字符集，并在交给响应解析器之前将其转换为UTF-8。
+	// 此时Content-Type头中的字符集参数会被设为utf-8，XML声明中的编码也会被改为UTF-8。
+	NoTranscode bool `json:"no_transcode"`
+	// MediaTypes 接受的响应的媒体类型列表，例如“text/html”和“image/*”。
+	// 为空时接受任何媒体类型。
+	MediaTypes []string `json:"media_types,omitempty"`
+	// URLPatterns 接受的响应的最终URL的正则表达式列表，匹配其中之一即可。
+	// 为空时接受任何URL。
+	URLPatterns []string `json:"url_patterns,omitempty"`
+}
+
 // myAnalyzer 分析器的实现类型。
 type myAnalyzer struct {
 	// stub.ModuleInternal 组件基础实例。
 	stub.ModuleInternal
 	// respParsers 响应解析器列表。
 	respParsers []module.ParseResponse
+	// bodyOpts 读取响应体时使用的多重读取器的可选项。
+	bodyOpts reader.Options
+	// transcode 是否把响应体转换为UTF-8。
+	transcode bool
+	// matcher 响应的匹配器。为nil时表示接受所有响应。
+	matcher *responseMatcher
 }
 
 // New 创建一个分析器实例。
@@ -20,6 +43,15 @@ func New(
 	mid module.MID,
 	respParsers []module.ParseResponse,
 	scoreCalculator module.CalculateScore) (module.Analyzer, error) {
+	return NewWithOptions(mid, respParsers, Options{}, scoreCalculator)
+}
+
+// NewWithOptions 根据给定的可选项创建一个分析器实例。
+func NewWithOptions(
+	mid module.MID,
+	respParsers []module.ParseResponse,
+	opts Options,
+	scoreCalculator module.CalculateScore) (module.Analyzer, error) {
 	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
 		return nil, err
@@ -30,6 +62,13 @@ func New(
 	if len(respParsers) == 0 {
 		return nil, genParameterError("empty response parser list")
 	}
+	if opts.Body.MaxSize < 0 {
+		return nil, genParameterError("negative max body size")
+	}
+	matcher, err := newResponseMatcher(opts.MediaTypes, opts.URLPatterns)
+	if err != nil {
+		return nil, genParameterError(err.Error())
+	}
 	var innerParsers []module.ParseResponse
 	for i, parser := range respParsers {
 		if parser == nil {
@@ -40,9 +79,19 @@ func New(
 	return &myAnalyzer{
 		ModuleInternal: moduleBase,
 		respParsers:    innerParsers,
+		bodyOpts:       opts.Body,
+		transcode:      !opts.NoTranscode,
+		matcher:        matcher,
 	}, nil
 }
 
+func (analyzer *myAnalyzer) Accepts(resp *module.Response) bool {
+	if resp == nil {
+		return false
+	}
+	return analyzer.matcher == nil || analyzer.matcher.match(resp)
+}
+
 func (analyzer *myAnalyzer) RespParsers() []module.ParseResponse {
 	parsers := make([]module.ParseResponse, len(analyzer.respParsers))
 	copy(parsers, analyzer.respParsers)
@@ -84,15 +133,45 @@ func (analyzer *myAnalyzer) Analyze(
 	if httpResp.Body != nil {
 		defer httpResp.Body.Close()
 	}
-	multipleReader, err := reader.NewMultipleReader(httpResp.Body)
+	multipleReader, err := reader.NewMultipleReaderWithOptions(httpResp.Body, analyzer.bodyOpts)
 	if err != nil {
+		if err == reader.ErrTooLarge {
+			err = fmt.Errorf("the response body exceeds %d bytes (URL: %s)",
+				analyzer.bodyOpts.MaxSize, reqURL)
+		}
 		errorList = append(errorList, genError(err.Error()))
 		return
 	}
+	// 所有解析器都处理完毕后才删除可能存在的临时文件。
+	defer multipleReader.Close()
+	if multipleReader.Truncated() {
+		fmt.Printf("The response body was truncated to %d bytes (URL: %s).\n",
+			multipleReader.Size(), reqURL)
+	}
+	// 探测字符集并按需转换为UTF-8。
+	var bc *bodyCharset
+	if analyzer.transcode {
+		contentType := httpResp.Header.Get("Content-Type")
+		bc, err = detectCharset(multipleReader, contentType)
+		if err != nil {
+			errorList = append(errorList, genError(err.Error()))
+			return
+		}
+		if bc != nil {
+			// 解析函数可以据此得知响应体已经是UTF-8。
+			resp.SetCharset(bc.name)
+			httpResp.Header.Set("Content-Type", bc.contentType)
+		}
+	}
 	dataList = []module.Data{}
 	for _, respParser := range analyzer.respParsers {
-		httpResp.Body = multipleReader.Reader()
+		body := multipleReader.Reader()
+		if bc != nil {
+			body = bc.transcode(body)
+		}
+		httpResp.Body = body
 		pDataList, pErrorList := respParser(httpResp, respDepth)
+		body.Close()
 		if pDataList != nil {
 			for _, pData := range pDataList {
 				if pData == nil {
@@ -127,7 +206,7 @@ func appendDataList(dataList []module.Data, data module.Data, respDepth uint32)
 	}
 	newDepth := respDepth + 1
 	if req.Depth() != newDepth {
-		req = module.NewRequest(req.HTTPReq(), newDepth)
+		req = req.WithDepth(newDepth)
 	}
 	return append(dataList, req)
 }
@@ -0,0 +1,261 @@
+package analyzer
+
+import (
+	"BeanGithub/crawler/toolkit/reader"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// sniffLen 用于探测字符集和内容类型的数据的最大长度。
+const sniffLen = 1024
+
+// utf8BOM UTF-8的字节顺序标记。
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// xmlDeclPattern XML声明中的encoding属性的正则表达式。
+// 第一个分组为属性值之前的部分，第二个分组为属性值。
+var xmlDeclPattern = regexp.MustCompile(`^(\s*<\?xml\s[^>]*?\bencoding\s*=\s*["'])([A-Za-z0-9._:-]+)`)
+
+// bodyCharset 代表响应体的字符集。
+type bodyCharset struct {
+	// name 字符集的名称。
+	name string
+	// encoding 字符集对应的编码。为nil时表示无需转码。
+	encoding encoding.Encoding
+	// xmlDecl 是否需要把XML声明中的编码改为UTF-8。
+	xmlDecl bool
+	// contentType 转换为UTF-8之后的内容类型。
+	contentType string
+}
+
+// detectCharset 探测响应体的字符集。
+// 依次根据字节顺序标记、Content-Type头、XML声明（仅限XML）、<meta>标签（仅限HTML）和内容本身进行判断。
+// 没有声明字符集的XML按照XML规范视为UTF-8，没有声明字符集的JSON按照JSON规范视为UTF-8。
+// 无法确定字符集且前缀中只有ASCII字符时，会继续探测之后的内容。
+// 响应体不是文本时返回nil。
+func detectCharset(multipleReader reader.MultipleReader, contentType string) (*bodyCharset, error) {
+	body := multipleReader.Reader()
+	defer body.Close()
+	prefix, err := ioutil.ReadAll(io.LimitReader(body, sniffLen))
+	if err != nil {
+		return nil, err
+	}
+	if !isText(contentType, prefix) {
+		return nil, nil
+	}
+	e, name, certain := charset.DetermineEncoding(prefix, contentType)
+	bc := &bodyCharset{contentType: utf8ContentType(contentType, prefix)}
+	if isJSON(contentType) && !bytes.HasPrefix(prefix, utf8BOM) && !hasCharsetParam(contentType) {
+		e, name = charset.Lookup("utf-8")
+	} else if !certain && name == "windows-1252" && !hasHighByte(prefix) {
+		// 此时DetermineEncoding只是在猜测，而之后的内容可能是UTF-8。
+		isUTF8, err := sniffUTF8(body)
+		if err != nil {
+			return nil, err
+		}
+		if isUTF8 {
+			e, name = charset.Lookup("utf-8")
+		}
+	}
+	if isXML(contentType, prefix) {
+		declared := xmlDeclaredCharset(prefix)
+		if !bytes.HasPrefix(prefix, utf8BOM) && !hasCharsetParam(contentType) {
+			e, name = charset.Lookup("utf-8")
+			if de, dname := charset.Lookup(declared); de != nil {
+				e, name = de, dname
+			}
+		}
+		// 转换之后的内容是UTF-8，XML声明中的编码必须与之一致，以免XML解析器再次解码。
+		bc.xmlDecl = declared != "" && !strings.EqualFold(declared, "utf-8")
+	}
+	bc.name = name
+	// UTF-8的内容只在带有字节顺序标记时才需要经过解码器以去掉该标记。
+	if name != "utf-8" || bytes.HasPrefix(prefix, utf8BOM) {
+		bc.encoding = e
+	}
+	return bc, nil
+}
+
+// isXML 判断给定的内容类型是否代表XML。
+// 内容类型为空时会根据内容本身进行判断。
+func isXML(contentType string, prefix []byte) bool {
+	if contentType == "" {
+		return bytes.HasPrefix(bytes.TrimLeft(bytes.TrimPrefix(prefix, utf8BOM), " \t\r\n"), []byte("<?xml"))
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/xml" || mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+xml")
+}
+
+// isJSON 判断给定的内容类型是否代表JSON。
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// hasHighByte 判断给定的内容中是否有非ASCII字节。
+func hasHighByte(content []byte) bool {
+	return indexHighByte(content) >= 0
+}
+
+// indexHighByte 获取给定的内容中第一个非ASCII字节的位置。没有时返回-1。
+func indexHighByte(content []byte) int {
+	for i, b := range content {
+		if b >= utf8.RuneSelf {
+			return i
+		}
+	}
+	return -1
+}
+
+// sniffUTF8 继续探测前缀之后的内容是否是UTF-8。
+// 之后的内容同样只有ASCII字符，或者从第一个非ASCII字节开始的一段内容是合法的UTF-8时，结果值为true。
+func sniffUTF8(r io.Reader) (bool, error) {
+	buf := make([]byte, sniffLen)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if i := indexHighByte(buf[:n]); i >= 0 {
+			window := append([]byte(nil), buf[i:n]...)
+			if err == nil {
+				more, err := ioutil.ReadAll(io.LimitReader(r, int64(i)))
+				if err != nil {
+					return false, err
+				}
+				window = append(window, more...)
+			}
+			return validUTF8(window), nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// validUTF8 判断给定的内容是否是合法的UTF-8。末尾不完整的字符会被忽略。
+func validUTF8(content []byte) bool {
+	for i := len(content) - 1; i >= 0 && i > len(content)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(content[i]) {
+			if !utf8.FullRune(content[i:]) {
+				content = content[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(content)
+}
+
+// hasCharsetParam 判断给定的内容类型中是否带有字符集参数。
+func hasCharsetParam(contentType string) bool {
+	_, params, err := mime.ParseMediaType(contentType)
+	return err == nil && params["charset"] != ""
+}
+
+// xmlDeclaredCharset 获取XML声明中的编码。没有时返回空字符串。
+func xmlDeclaredCharset(prefix []byte) string {
+	match := xmlDeclPattern.FindSubmatch(bytes.TrimPrefix(prefix, utf8BOM))
+	if match == nil {
+		return ""
+	}
+	return string(match[2])
+}
+
+// isText 判断给定的内容类型是否代表文本。
+// 内容类型为空时会根据内容本身进行判断。
+func isText(contentType string, prefix []byte) bool {
+	if contentType == "" {
+		contentType = http.DetectContentType(prefix)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+xml"),
+		strings.HasSuffix(mediaType, "+json"):
+		return true
+	}
+	switch mediaType {
+	case "application/xml", "application/json",
+		"application/javascript", "application/x-javascript":
+		return true
+	}
+	return false
+}
+
+// transcode 返回把给定响应体转换为UTF-8的读取器。
+// XML声明中的编码会被改为UTF-8。
+func (bc *bodyCharset) transcode(body io.ReadCloser) io.ReadCloser {
+	if bc.encoding == nil && !bc.xmlDecl {
+		return body
+	}
+	var r io.Reader = body
+	if bc.encoding != nil {
+		r = transform.NewReader(body, bc.encoding.NewDecoder())
+	}
+	if bc.xmlDecl {
+		r = rewriteXMLDecl(r)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, body}
+}
+
+// rewriteXMLDecl 返回把XML声明中的编码改为UTF-8之后的读取器。
+func rewriteXMLDecl(r io.Reader) io.Reader {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	head = head[:n]
+	head = xmlDeclPattern.ReplaceAll(head, []byte("${1}utf-8"))
+	if err != nil {
+		// 内容已经读完，或者读取出错，出错时交由后续的读取来报告。
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return bytes.NewReader(head)
+		}
+		return io.MultiReader(bytes.NewReader(head), errReader{err})
+	}
+	return io.MultiReader(bytes.NewReader(head), r)
+}
+
+// errReader 总是返回给定错误的读取器。
+type errReader struct {
+	err error
+}
+
+func (er errReader) Read(p []byte) (int, error) {
+	return 0, er.err
+}
+
+// utf8ContentType 返回把字符集参数替换为UTF-8之后的内容类型。
+// 内容类型为空时会根据内容本身进行探测。
+func utf8ContentType(contentType string, prefix []byte) string {
+	if contentType == "" {
+		contentType = http.DetectContentType(prefix)
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	params["charset"] = "utf-8"
+	return mime.FormatMediaType(mediaType, params)
+}
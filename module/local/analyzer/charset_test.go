@@ -0,0 +1,188 @@
+package analyzer
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/module/local/parser"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// charsetCases 各种字符集的测试用例。
+var charsetCases = []struct {
+	label    string
+	encoding encoding.Encoding
+	title    string
+}{
+	{"gbk", simplifiedchinese.GBK, "中文标题"},
+	{"shift_jis", japanese.ShiftJIS, "日本語のタイトル"},
+	{"windows-1252", charmap.Windows1252, "Café déjà vu"},
+}
+
+func encode(t *testing.T, e encoding.Encoding, s string) []byte {
+	b, err := e.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("couldn't encode %q: %s", s, err)
+	}
+	return b
+}
+
+func analyzeBody(t *testing.T, contentType string, body []byte) (*module.Response, []module.Data) {
+	mid, _ := module.GenMID(module.TYPE_ANALYZER, 1, nil)
+	a, err := New(mid, []module.ParseResponse{parser.ParseFeed, parser.ParseSitemap}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq, _ := http.NewRequest("GET", "https://example.com/feed", nil)
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	httpResp := &http.Response{
+		StatusCode: 200,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request:    httpReq,
+	}
+	resp := module.NewResponse(httpResp, 0)
+	dataList, errs := a.Analyze(resp)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	return resp, dataList
+}
+
+func TestTranscodeXML(t *testing.T) {
+	for _, c := range charsetCases {
+		rss := func(decl string) []byte {
+			var buf bytes.Buffer
+			buf.WriteString(`<?xml version="1.0"` + decl + `?><rss version="2.0"><channel><item><title>`)
+			buf.Write(encode(t, c.encoding, c.title))
+			buf.WriteString(`</title><link>https://example.com/1</link></item></channel></rss>`)
+			return buf.Bytes()
+		}
+		decl := ` encoding="` + c.label + `"`
+		for _, tc := range []struct {
+			name        string
+			contentType string
+			body        []byte
+		}{
+			{"header", "application/rss+xml; charset=" + c.label, rss("")},
+			{"header and declaration", "application/rss+xml; charset=" + c.label, rss(decl)},
+			{"declaration", "application/rss+xml", rss(decl)},
+			{"text/xml declaration", "text/xml", rss(decl)},
+			{"no content type", "", rss(decl)},
+		} {
+			resp, dataList := analyzeBody(t, tc.contentType, tc.body)
+			if len(dataList) == 0 {
+				t.Fatalf("%s/%s: no data", c.label, tc.name)
+			}
+			item, ok := dataList[0].(module.Item)
+			if !ok {
+				t.Fatalf("%s/%s: unexpected data %T", c.label, tc.name, dataList[0])
+			}
+			if item[parser.FEED_KEY_TITLE] != c.title {
+				t.Errorf("%s/%s: title %q, want %q", c.label, tc.name, item[parser.FEED_KEY_TITLE], c.title)
+			}
+			if resp.Charset() != c.label {
+				t.Errorf("%s/%s: charset %q, want %q", c.label, tc.name, resp.Charset(), c.label)
+			}
+		}
+	}
+}
+
+func TestTranscodeHTML(t *testing.T) {
+	for _, c := range charsetCases {
+		var buf bytes.Buffer
+		buf.WriteString(`<html><head><meta charset="` + c.label + `"></head><body>`)
+		buf.Write(encode(t, c.encoding, c.title))
+		buf.WriteString(`</body></html>`)
+		mid, _ := module.GenMID(module.TYPE_ANALYZER, 1, nil)
+		var got string
+		var contentType string
+		a, _ := New(mid, []module.ParseResponse{func(httpResp *http.Response, depth uint32) ([]module.Data, []error) {
+			b, _ := ioutil.ReadAll(httpResp.Body)
+			got = string(b)
+			contentType = httpResp.Header.Get("Content-Type")
+			return nil, nil
+		}}, nil)
+		httpReq, _ := http.NewRequest("GET", "https://example.com/", nil)
+		httpResp := &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       ioutil.NopCloser(&buf),
+			Request:    httpReq,
+		}
+		a.Analyze(module.NewResponse(httpResp, 0))
+		if !bytes.Contains([]byte(got), []byte(c.title)) {
+			t.Errorf("%s: body %q doesn't contain %q", c.label, got, c.title)
+		}
+		if contentType != "text/html; charset=utf-8" {
+			t.Errorf("%s: content type %q", c.label, contentType)
+		}
+	}
+}
+
+func TestXMLWithoutCharsetIsUTF8(t *testing.T) {
+	body := []byte(`<?xml version="1.0"?><rss><channel><item><title>Ünïcödé</title></item></channel></rss>`)
+	resp, dataList := analyzeBody(t, "application/xml", body)
+	if resp.Charset() != "utf-8" {
+		t.Fatalf("charset %q, want utf-8", resp.Charset())
+	}
+	if title := dataList[0].(module.Item)[parser.FEED_KEY_TITLE]; title != "Ünïcödé" {
+		t.Fatalf("title %q", title)
+	}
+}
+
+func TestRewriteXMLDecl(t *testing.T) {
+	got, _ := ioutil.ReadAll(rewriteXMLDecl(bytes.NewReader([]byte(`<?xml version='1.0' encoding='GBK'?><a/>`))))
+	if string(got) != `<?xml version='1.0' encoding='utf-8'?><a/>` {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestSniffBeyondASCIIPrefix(t *testing.T) {
+	head := "<html><head><title>x</title></head><body>" + string(bytes.Repeat([]byte("a"), 2*sniffLen))
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        []byte
+		charset     string
+		want        string
+	}{
+		{"utf-8 html", "text/html", []byte(head + "中文内容</body></html>"), "utf-8", "中文内容"},
+		{"json", "application/json", []byte(`{"a":"` + head + `","b":"中文内容"}`), "utf-8", "中文内容"},
+		{"problem+json", "application/problem+json", []byte(`{"b":"中文内容"}`), "utf-8", "中文内容"},
+		{"windows-1252 html", "text/html",
+			append([]byte(head), encode(t, charmap.Windows1252, "Café déjà vu")...), "windows-1252", "Café déjà vu"},
+		{"ascii html", "text/html", []byte(head + "</body></html>"), "utf-8", "</body>"},
+	} {
+		mid, _ := module.GenMID(module.TYPE_ANALYZER, 1, nil)
+		var got []byte
+		a, _ := New(mid, []module.ParseResponse{func(httpResp *http.Response, depth uint32) ([]module.Data, []error) {
+			got, _ = ioutil.ReadAll(httpResp.Body)
+			return nil, nil
+		}}, nil)
+		httpReq, _ := http.NewRequest("GET", "https://example.com/", nil)
+		httpResp := &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {tc.contentType}},
+			Body:       ioutil.NopCloser(bytes.NewReader(tc.body)),
+			Request:    httpReq,
+		}
+		resp := module.NewResponse(httpResp, 0)
+		a.Analyze(resp)
+		if !bytes.Contains(got, []byte(tc.want)) {
+			t.Errorf("%s: body doesn't contain %q", tc.name, tc.want)
+		}
+		if resp.Charset() != tc.charset {
+			t.Errorf("%s: charset %q, want %q", tc.name, resp.Charset(), tc.charset)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package analyzer
+
+import (
+	"BeanGithub/crawler/module"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+)
+
+// responseMatcher 响应的匹配器。
+type responseMatcher struct {
+	// mediaTypes 接受的媒体类型列表（已转为小写）。
+	mediaTypes []string
+	// urlPatterns 接受的URL的正则表达式列表。
+	urlPatterns []*regexp.Regexp
+}
+
+// newResponseMatcher 创建响应的匹配器。
+// 两个列表都为空时返回nil，表示接受所有响应。
+func newResponseMatcher(mediaTypes, urlPatterns []string) (*responseMatcher, error) {
+	if len(mediaTypes) == 0 && len(urlPatterns) == 0 {
+		return nil, nil
+	}
+	matcher := &responseMatcher{}
+	for _, mediaType := range mediaTypes {
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		parts := strings.Split(mediaType, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" ||
+			(parts[0] == "*" && parts[1] != "*") {
+			return nil, fmt.Errorf("illegal media type: %q", mediaType)
+		}
+		matcher.mediaTypes = append(matcher.mediaTypes, mediaType)
+	}
+	for _, pattern := range urlPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("illegal URL pattern %q: %s", pattern, err)
+		}
+		matcher.urlPatterns = append(matcher.urlPatterns, re)
+	}
+	return matcher, nil
+}
+
+// match 判断是否接受给定的响应。
+func (matcher *responseMatcher) match(resp *module.Response) bool {
+	httpResp := resp.HTTPResp()
+	if httpResp == nil {
+		return false
+	}
+	if len(matcher.mediaTypes) > 0 && !matcher.matchMediaType(httpResp.Header.Get("Content-Type")) {
+		return false
+	}
+	if len(matcher.urlPatterns) > 0 {
+		finalURL := resp.FinalURL()
+		if finalURL == nil {
+			return false
+		}
+		for _, re := range matcher.urlPatterns {
+			if re.MatchString(finalURL.String()) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// matchMediaType 判断是否接受给定的内容类型。
+// 支持“*/*”和“image/*”这样的通配形式。
+func (matcher *responseMatcher) matchMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+	for _, accepted := range matcher.mediaTypes {
+		switch {
+		case accepted == "*/*", accepted == mediaType:
+			return true
+		case strings.HasSuffix(accepted, "/*") && mediaType != "" &&
+			strings.HasPrefix(mediaType, strings.TrimSuffix(accepted, "*")):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package analyzer
+
+import (
+	"BeanGithub/crawler/module"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// newMatchResponse 创建具有给定URL和内容类型的响应。
+func newMatchResponse(rawURL, contentType string) *module.Response {
+	httpReq, _ := http.NewRequest("GET", rawURL, nil)
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return module.NewResponse(&http.Response{StatusCode: 200, Header: header, Request: httpReq}, 0)
+}
+
+func newMatchAnalyzer(t *testing.T, mediaTypes, urlPatterns []string) module.Analyzer {
+	mid, _ := module.GenMID(module.TYPE_ANALYZER, 1, nil)
+	a, err := NewWithOptions(mid, []module.ParseResponse{nopParse},
+		Options{MediaTypes: mediaTypes, URLPatterns: urlPatterns}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func nopParse(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+	return nil, nil
+}
+
+func TestAcceptsMediaTypes(t *testing.T) {
+	a := newMatchAnalyzer(t, []string{" Text/HTML ", "image/*", "application/xml"}, nil)
+	matcher := a.(module.ResponseMatcher)
+	for contentType, want := range map[string]bool{
+		"text/html":                     true,
+		"TEXT/HTML; charset=utf-8":      true,
+		"image/png":                     true,
+		"image/svg+xml":                 true,
+		"application/xml":               true,
+		"application/xhtml+xml":         false,
+		"text/plain":                    false,
+		"imagery/png":                   false,
+		"":                              false,
+		"not a media type; ===":         false,
+		"application/json; charset=gbk": false,
+	} {
+		resp := newMatchResponse("https://example.com/", contentType)
+		if got := matcher.Accepts(resp); got != want {
+			t.Errorf("Accepts(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+	wildcard := newMatchAnalyzer(t, []string{"*/*"}, nil).(module.ResponseMatcher)
+	if !wildcard.Accepts(newMatchResponse("https://example.com/", "")) {
+		t.Error("*/* does not accept a response without content type")
+	}
+}
+
+func TestAcceptsURLPatterns(t *testing.T) {
+	a := newMatchAnalyzer(t, []string{"text/html"}, []string{`/articles/\d+$`, `^https://blog\.`})
+	matcher := a.(module.ResponseMatcher)
+	for _, tc := range []struct {
+		url         string
+		contentType string
+		want        bool
+	}{
+		{"https://example.com/articles/42", "text/html", true},
+		{"https://blog.example.com/", "text/html", true},
+		{"https://example.com/articles/latest", "text/html", false},
+		// 两个条件都要满足。
+		{"https://example.com/articles/42", "image/png", false},
+	} {
+		if got := matcher.Accepts(newMatchResponse(tc.url, tc.contentType)); got != tc.want {
+			t.Errorf("Accepts(%s, %s) = %v, want %v", tc.url, tc.contentType, got, tc.want)
+		}
+	}
+	// 重定向之后按照最终URL匹配。
+	resp := newMatchResponse("https://example.com/short", "text/html")
+	from, _ := url.Parse("https://example.com/short")
+	to, _ := url.Parse("https://example.com/articles/7")
+	resp.SetRedirects([]module.Redirect{{From: from, To: to, StatusCode: 301}})
+	if !matcher.Accepts(resp) {
+		t.Error("the final URL was not used for matching")
+	}
+}
+
+func TestAcceptsAll(t *testing.T) {
+	matcher := newMatchAnalyzer(t, nil, nil).(module.ResponseMatcher)
+	if !matcher.Accepts(newMatchResponse("https://example.com/", "application/octet-stream")) {
+		t.Error("an analyzer without restrictions rejected a response")
+	}
+	if matcher.Accepts(nil) {
+		t.Error("accepted a nil response")
+	}
+}
+
+func TestIllegalMatchOptions(t *testing.T) {
+	mid, _ := module.GenMID(module.TYPE_ANALYZER, 1, nil)
+	for _, opts := range []Options{
+		{MediaTypes: []string{"html"}},
+		{MediaTypes: []string{"text/"}},
+		{MediaTypes: []string{"*/html"}},
+		{MediaTypes: []string{"text/html/x"}},
+		{URLPatterns: []string{"("}},
+	} {
+		if _, err := NewWithOptions(mid, []module.ParseResponse{nopParse}, opts, nil); err == nil {
+			t.Errorf("no error for illegal options %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheSummaryStruct HTTP缓存的摘要类型。
+type CacheSummaryStruct struct {
+	// Hits 由缓存提供响应体的次数（服务端返回304）。
+	Hits uint64 `json:"hits"`
+	// Misses 需要完整下载的次数。
+	Misses uint64 `json:"misses"`
+	// Stored 写入缓存的次数。
+	Stored uint64 `json:"stored"`
+}
+
+// cacheMeta 缓存条目的元数据。
+type cacheMeta struct {
+	// URL 请求的URL。
+	URL string `json:"url"`
+	// StatusCode 缓存的响应的状态码。
+	StatusCode int `json:"status_code"`
+	// Header 缓存的响应的响应头。
+	Header http.Header `json:"header"`
+	// Body 缓存的响应体文件的名称。
+	Body string `json:"body"`
+	// Stored 写入缓存的时间。
+	Stored time.Time `json:"stored"`
+}
+
+// ETag 获取缓存的响应的ETag。
+func (meta *cacheMeta) ETag() string {
+	return meta.Header.Get("ETag")
+}
+
+// LastModified 获取缓存的响应的Last-Modified。
+func (meta *cacheMeta) LastModified() string {
+	return meta.Header.Get("Last-Modified")
+}
+
+// httpCache 基于磁盘的HTTP缓存。
+// 每个URL对应目录中的一个元数据文件，文件名为URL的SHA-256摘要。
+// 每次写入的响应体都保存在一个新的文件中，并由元数据记录其名称，
+// 因此替换元数据文件即可一次性地切换整个缓存条目，元数据与响应体不会错配。
+// 只缓存带有ETag或Last-Modified且没有Vary头的200响应，
+// 并且总是通过条件请求向服务端确认其有效性。
+type httpCache struct {
+	// dir 缓存目录。
+	dir string
+	// lock 串行化缓存条目的替换的互斥锁。
+	lock sync.Mutex
+	// hits 由缓存提供响应体的次数。
+	hits uint64
+	// misses 需要完整下载的次数。
+	misses uint64
+	// stored 写入缓存的次数。
+	stored uint64
+}
+
+// newHTTPCache 创建一个基于给定目录的HTTP缓存。
+func newHTTPCache(dir string) (*httpCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &httpCache{dir: dir}, nil
+}
+
+// name 获取给定URL对应的缓存文件的名称前缀。
+func (cache *httpCache) name(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+// metaPath 获取给定URL对应的元数据文件的路径。
+func (cache *httpCache) metaPath(url string) string {
+	return filepath.Join(cache.dir, cache.name(url)+".json")
+}
+
+// bodyPath 获取给定的缓存条目的响应体文件的路径。
+func (cache *httpCache) bodyPath(meta *cacheMeta) string {
+	return filepath.Join(cache.dir, meta.Body)
+}
+
+// load 读取给定URL的缓存条目的元数据。不存在或无法读取时返回nil。
+func (cache *httpCache) load(url string) *cacheMeta {
+	data, err := ioutil.ReadFile(cache.metaPath(url))
+	if err != nil {
+		return nil
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.URL != url {
+		return nil
+	}
+	// 响应体文件必须是缓存目录中属于该URL的文件。
+	if meta.Body != filepath.Base(meta.Body) || !strings.HasPrefix(meta.Body, cache.name(url)+".") {
+		return nil
+	}
+	return &meta
+}
+
+// prepare 为给定的请求添加条件请求头。
+// 若存在可用的缓存条目，则返回添加了条件请求头的新请求以及该条目的元数据。
+func (cache *httpCache) prepare(httpReq *http.Request) (*http.Request, *cacheMeta) {
+	if httpReq.Method != "" && httpReq.Method != http.MethodGet {
+		return httpReq, nil
+	}
+	meta := cache.load(httpReq.URL.String())
+	if meta == nil {
+		return httpReq, nil
+	}
+	condReq := httpReq.Clone(httpReq.Context())
+	if etag := meta.ETag(); etag != "" {
+		condReq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := meta.LastModified(); lastModified != "" {
+		condReq.Header.Set("If-Modified-Since", lastModified)
+	}
+	return condReq, meta
+}
+
+// handle 处理给定请求的响应。
+// 304响应会被转换为由缓存提供响应体的完整响应；
+// 可缓存的200响应会在其响应体被完整读取后写入缓存。
+// 参数origReq 原始的请求，转换后的响应会以它作为对应的请求。
+func (cache *httpCache) handle(
+	origReq *http.Request, httpResp *http.Response, meta *cacheMeta) *http.Response {
+	if httpResp.StatusCode == http.StatusNotModified && meta != nil {
+		if resp := cache.respond(origReq, httpResp, meta); resp != nil {
+			atomic.AddUint64(&cache.hits, 1)
+			return resp
+		}
+	}
+	atomic.AddUint64(&cache.misses, 1)
+	if origReq.Method != "" && origReq.Method != http.MethodGet {
+		return httpResp
+	}
+	if httpResp.StatusCode == http.StatusOK && cacheable(httpResp) {
+		cache.store(origReq.URL.String(), httpResp)
+	}
+	return httpResp
+}
+
+// respond 根据304响应和缓存条目生成完整的响应。
+// 304响应中的响应头会覆盖缓存的响应头。缓存的响应体无法读取时返回nil。
+func (cache *httpCache) respond(
+	origReq *http.Request, notModified *http.Response, meta *cacheMeta) *http.Response {
+	body, err := os.Open(cache.bodyPath(meta))
+	if err != nil {
+		return nil
+	}
+	info, err := body.Stat()
+	if err != nil {
+		body.Close()
+		return nil
+	}
+	io.Copy(ioutil.Discard, notModified.Body)
+	notModified.Body.Close()
+	header := http.Header{}
+	for key, values := range meta.Header {
+		header[key] = values
+	}
+	for key, values := range notModified.Header {
+		header[key] = values
+	}
+	header.Del("Content-Length")
+	statusCode := meta.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	return &http.Response{
+		Status:        http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          body,
+		ContentLength: info.Size(),
+		Request:       origReq,
+		TLS:           notModified.TLS,
+	}
+}
+
+// store 把给定的响应写入缓存。
+// 响应体会在被读取的同时写入一个新的响应体文件，
+// 只有在被完整读取之后才会写入指向该文件的元数据，从而替换原有的缓存条目。
+func (cache *httpCache) store(url string, httpResp *http.Response) {
+	if httpResp.Body == nil {
+		return
+	}
+	bodyFile, err := ioutil.TempFile(cache.dir, cache.name(url)+".*.body")
+	if err != nil {
+		return
+	}
+	meta := cacheMeta{
+		URL:        url,
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+		Body:       filepath.Base(bodyFile.Name()),
+	}
+	httpResp.Body = &cachingBody{
+		ReadCloser: httpResp.Body,
+		tmpFile:    bodyFile,
+		commit: func() error {
+			meta.Stored = time.Now()
+			return cache.replace(&meta)
+		},
+	}
+}
+
+// replace 用给定的元数据替换其URL的缓存条目，并删除原有条目的响应体文件。
+func (cache *httpCache) replace(meta *cacheMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	old := cache.load(meta.URL)
+	if err := writeFile(cache.metaPath(meta.URL), data); err != nil {
+		return err
+	}
+	if old != nil && old.Body != meta.Body {
+		os.Remove(cache.bodyPath(old))
+	}
+	atomic.AddUint64(&cache.stored, 1)
+	return nil
+}
+
+// Summary 获取缓存的摘要信息。
+func (cache *httpCache) Summary() CacheSummaryStruct {
+	return CacheSummaryStruct{
+		Hits:   atomic.LoadUint64(&cache.hits),
+		Misses: atomic.LoadUint64(&cache.misses),
+		Stored: atomic.LoadUint64(&cache.stored),
+	}
+}
+
+// cacheable 判断给定的响应是否可以被缓存。
+// 缓存条目只以URL为键，因此随请求头变化的响应（带有Vary头）不会被缓存。
+func cacheable(httpResp *http.Response) bool {
+	if httpResp.Header.Get("ETag") == "" && httpResp.Header.Get("Last-Modified") == "" {
+		return false
+	}
+	if httpResp.Header.Get("Vary") != "" {
+		return false
+	}
+	cacheControl := strings.ToLower(httpResp.Header.Get("Cache-Control"))
+	return !strings.Contains(cacheControl, "no-store")
+}
+
+// writeFile 先写入同目录下的临时文件再替换，以免留下不完整的文件。
+func writeFile(path string, data []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmpFile, bytes.NewReader(data))
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+	return err
+}
+
+// cachingBody 在被读取的同时把内容写入临时文件的响应体。
+type cachingBody struct {
+	io.ReadCloser
+	// tmpFile 临时文件。
+	tmpFile *os.File
+	// commit 响应体被完整读取后调用的函数。
+	commit func() error
+	// failed 写入临时文件是否失败。
+	failed bool
+	// done 是否已读取完毕或已关闭。
+	done bool
+}
+
+func (body *cachingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if n > 0 && !body.failed && !body.done {
+		if _, werr := body.tmpFile.Write(p[:n]); werr != nil {
+			body.failed = true
+		}
+	}
+	if err == io.EOF {
+		body.finish(true)
+	}
+	return n, err
+}
+
+func (body *cachingBody) Close() error {
+	body.finish(false)
+	return body.ReadCloser.Close()
+}
+
+// finish 结束写入临时文件。
+// 只有在响应体被完整读取且写入未失败时才会写入缓存，否则丢弃临时文件。
+func (body *cachingBody) finish(complete bool) {
+	if body.done {
+		return
+	}
+	body.done = true
+	err := body.tmpFile.Close()
+	if complete && !body.failed && err == nil && body.commit() == nil {
+		return
+	}
+	os.Remove(body.tmpFile.Name())
+}
@@ -0,0 +1,245 @@
+package downloader
+
+import (
+	"BeanGithub/crawler/module"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// cacheSite 测试HTTP缓存用的站点。
+// 每个路径的内容都有一个版本号，版本号即为其ETag。
+type cacheSite struct {
+	*httptest.Server
+	// versions 各个路径的内容的版本号。
+	versions map[string]int
+	// notModified 返回304响应的次数。
+	notModified int
+	// conditional 最近一次请求中的If-None-Match头。
+	conditional string
+	// lock 保护以上字段的互斥锁。
+	lock sync.Mutex
+}
+
+func newCacheSite() *cacheSite {
+	site := &cacheSite{versions: map[string]int{}}
+	site.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.lock.Lock()
+		defer site.lock.Unlock()
+		etag := fmt.Sprintf(`"v%d"`, site.versions[r.URL.Path])
+		site.conditional = r.Header.Get("If-None-Match")
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/no-validator":
+			fmt.Fprintf(w, "body of %s", r.URL.Path)
+			return
+		case "/vary":
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("X-Version", etag)
+		if site.conditional == etag {
+			site.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, "body of %s %s", r.URL.Path, etag)
+	}))
+	return site
+}
+
+// bump 更新给定路径的内容的版本号。
+func (site *cacheSite) bump(path string) {
+	site.lock.Lock()
+	defer site.lock.Unlock()
+	site.versions[path]++
+}
+
+// Conditional 获取最近一次请求中的If-None-Match头。
+func (site *cacheSite) Conditional() string {
+	site.lock.Lock()
+	defer site.lock.Unlock()
+	return site.conditional
+}
+
+// NotModified 获取返回304响应的次数。
+func (site *cacheSite) NotModified() int {
+	site.lock.Lock()
+	defer site.lock.Unlock()
+	return site.notModified
+}
+
+// download 下载给定的路径，并返回响应及其响应体。
+// 参数readAll 是否完整读取响应体，为false时只读取一个字节就关闭。
+func (site *cacheSite) download(t *testing.T, d module.Downloader, path string, readAll bool) (*http.Response, string) {
+	httpReq, _ := http.NewRequest("GET", site.URL+path, nil)
+	resp, err := d.Download(module.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpResp := resp.HTTPResp()
+	defer httpResp.Body.Close()
+	if !readAll {
+		httpResp.Body.Read(make([]byte, 1))
+		return httpResp, ""
+	}
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httpResp, string(body)
+}
+
+func newCacheDownloader(t *testing.T) (module.Downloader, func() CacheSummaryStruct) {
+	d, summary, _ := newCacheDownloaderIn(t)
+	return d, summary
+}
+
+// newCacheDownloaderIn 创建使用HTTP缓存的下载器，并返回其缓存目录。
+func newCacheDownloaderIn(t *testing.T) (module.Downloader, func() CacheSummaryStruct, string) {
+	dir, err := ioutil.TempDir("", "httpcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	d := newTestDownloader(t, &http.Client{}, Options{CacheDir: dir})
+	return d, func() CacheSummaryStruct {
+		return *d.Summary().Extra.(SummaryExtra).Cache
+	}, dir
+}
+
+func TestCacheNotModified(t *testing.T) {
+	site := newCacheSite()
+	defer site.Close()
+	d, summary := newCacheDownloader(t)
+	_, first := site.download(t, d, "/page", true)
+	if site.Conditional() != "" {
+		t.Fatalf("the first request was conditional: %q", site.Conditional())
+	}
+	httpResp, second := site.download(t, d, "/page", true)
+	if site.Conditional() != `"v0"` || site.NotModified() != 1 {
+		t.Fatalf("the second request was not answered by 304 (If-None-Match: %q)", site.Conditional())
+	}
+	// 304响应会被转换为由缓存提供响应体的完整响应。
+	if httpResp.StatusCode != http.StatusOK || second != first {
+		t.Fatalf("cached response: %d %q, want 200 %q", httpResp.StatusCode, second, first)
+	}
+	if httpResp.ContentLength != int64(len(first)) {
+		t.Errorf("content length %d, want %d", httpResp.ContentLength, len(first))
+	}
+	if httpResp.Header.Get("X-Version") != `"v0"` {
+		t.Errorf("cached header X-Version: %q", httpResp.Header.Get("X-Version"))
+	}
+	// 响应对应的是原始请求，而不是条件请求。
+	if httpResp.Request.Header.Get("If-None-Match") != "" {
+		t.Error("the response refers to the conditional request")
+	}
+	if s := summary(); s.Hits != 1 || s.Misses != 1 || s.Stored != 1 {
+		t.Fatalf("unexpected cache summary: %+v", s)
+	}
+	// 内容更新后会完整下载并替换缓存条目。
+	site.bump("/page")
+	httpResp, third := site.download(t, d, "/page", true)
+	if httpResp.StatusCode != http.StatusOK || third == first {
+		t.Fatalf("updated response: %d %q", httpResp.StatusCode, third)
+	}
+	_, fourth := site.download(t, d, "/page", true)
+	if site.Conditional() != `"v1"` || fourth != third {
+		t.Fatalf("the updated entry was not cached (If-None-Match: %q, body: %q)", site.Conditional(), fourth)
+	}
+	if s := summary(); s.Hits != 2 || s.Misses != 2 || s.Stored != 2 {
+		t.Fatalf("unexpected cache summary: %+v", s)
+	}
+}
+
+func TestCacheSkipped(t *testing.T) {
+	site := newCacheSite()
+	defer site.Close()
+	d, summary := newCacheDownloader(t)
+	for _, path := range []string{"/no-store", "/no-validator", "/vary"} {
+		site.download(t, d, path, true)
+		site.download(t, d, path, true)
+		if site.Conditional() != "" {
+			t.Errorf("%s was cached", path)
+		}
+	}
+	// 没有被完整读取的响应体不会被缓存。
+	site.download(t, d, "/partial", false)
+	site.download(t, d, "/partial", true)
+	if site.Conditional() != "" {
+		t.Error("a partially read body was cached")
+	}
+	site.download(t, d, "/partial", true)
+	if site.Conditional() != `"v0"` {
+		t.Error("a fully read body was not cached")
+	}
+	if s := summary(); s.Hits != 1 || s.Stored != 1 {
+		t.Fatalf("unexpected cache summary: %+v", s)
+	}
+	if site.NotModified() != 1 {
+		t.Fatalf("%d responses were 304, want 1", site.NotModified())
+	}
+}
+
+func TestCacheOnlyGet(t *testing.T) {
+	site := newCacheSite()
+	defer site.Close()
+	d, summary := newCacheDownloader(t)
+	for i := 0; i < 2; i++ {
+		httpReq, _ := http.NewRequest("POST", site.URL+"/form", nil)
+		resp, err := d.Download(module.NewRequest(httpReq, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.HTTPResp().Body)
+		resp.HTTPResp().Body.Close()
+	}
+	if site.Conditional() != "" || summary().Stored != 0 {
+		t.Fatal("a POST response was cached")
+	}
+}
+
+func TestCacheReplaceEntry(t *testing.T) {
+	site := newCacheSite()
+	defer site.Close()
+	d, _, dir := newCacheDownloaderIn(t)
+	countFiles := func(pattern string) int {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(matches)
+	}
+	_, first := site.download(t, d, "/page", true)
+	// 新版本的响应体没有被完整读取时，原有的缓存条目保持不变。
+	site.bump("/page")
+	site.download(t, d, "/page", false)
+	site.bump("/page")
+	site.download(t, d, "/page", false)
+	if countFiles("*.body") != 1 || countFiles("*.tmp") != 0 {
+		t.Fatalf("%d body files and %d temp files", countFiles("*.body"), countFiles("*.tmp"))
+	}
+	site.lock.Lock()
+	site.versions["/page"] = 0
+	site.lock.Unlock()
+	_, cached := site.download(t, d, "/page", true)
+	if site.Conditional() != `"v0"` || cached != first {
+		t.Fatalf("the entry was broken by partial reads (If-None-Match: %q, body: %q)", site.Conditional(), cached)
+	}
+	// 替换缓存条目后原有的响应体文件被删除，元数据与新的响应体相互对应。
+	site.bump("/page")
+	_, updated := site.download(t, d, "/page", true)
+	if n := countFiles("*.body"); n != 1 || countFiles("*.json") != 1 {
+		t.Fatalf("%d body files and %d meta files after replacing the entry", n, countFiles("*.json"))
+	}
+	_, cached = site.download(t, d, "/page", true)
+	if site.Conditional() != `"v1"` || cached != updated {
+		t.Fatalf("mismatched entry (If-None-Match: %q, body: %q, want %q)", site.Conditional(), cached, updated)
+	}
+}
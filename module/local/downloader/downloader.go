@@ -1,18 +1,57 @@
 package downloader
 
 import (
+	"BeanGithub/crawler/errors"
 	"BeanGithub/crawler/module"
 	"BeanGithub/crawler/module/stub"
+	"BeanGithub/crawler/toolkit/proxypool"
 	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 )
 
+// Options 下载器的可选项。
+// 各个字段为零值时表示不启用相应的功能。
+type Options struct {
+	// CacheDir HTTP缓存的目录。
+	// 不为空时会缓存带有ETag或Last-Modified的响应，并在之后的下载中发送条件请求。
+	CacheDir string `json:"cache_dir,omitempty"`
+	// CookieJar Cookie存储器。不为nil时会替换HTTP客户端中的Cookie存储器。
+	// 多个下载器可以通过共享同一个Cookie存储器来共享会话。
+	CookieJar http.CookieJar `json:"-"`
+	// Headers 请求头部配置的集合。会在发送每个请求之前为其设置User-Agent等头部。
+	// 为nil时使用DefaultHeaderProfiles，设置为空的集合时不设置任何头部。
+	Headers *HeaderProfiles `json:"headers,omitempty"`
+	// ProxyPool 代理池。不为nil时每个请求都会通过从中选择的代理发送，
+	// 此时HTTP客户端的传输器必须为nil或*http.Transport。
+	ProxyPool proxypool.Pool `json:"-"`
+	// MaxRedirects 最多跟随的重定向次数。
+	// 为0时使用DefaultMaxRedirects，为负数时不跟随重定向。
+	// 重定向出现循环或次数超出限制时下载会失败。
+	MaxRedirects int `json:"max_redirects,omitempty"`
+}
+
+// SummaryExtra 下载器摘要中的额外信息。
+type SummaryExtra struct {
+	// Cache HTTP缓存的摘要信息。未启用缓存时为nil。
+	Cache *CacheSummaryStruct `json:"cache,omitempty"`
+	// Proxies 各个代理的统计信息。未使用代理池时为nil。
+	Proxies []proxypool.ProxyStats `json:"proxies,omitempty"`
+}
+
 // myDownloader 下载器的实现类型。
 type myDownloader struct {
 	// stub.ModuleInternal 组件基础实例。
 	stub.ModuleInternal
 	// httpClient 下载用的HTTP客户端。
 	httpClient http.Client
+	// cache HTTP缓存。为nil时表示不缓存。
+	cache *httpCache
+	// headers 请求头部的应用器。
+	headers *headerApplier
+	// proxies 代理池。为nil时表示不使用代理池。
+	proxies proxypool.Pool
 }
 
 // New 创建一个下载器实例。
@@ -20,6 +59,15 @@ func New(
 	mid module.MID,
 	client *http.Client,
 	scoreCalculator module.CalculateScore) (module.Downloader, error) {
+	return NewWithOptions(mid, client, Options{}, scoreCalculator)
+}
+
+// NewWithOptions 根据给定的可选项创建一个下载器实例。
+func NewWithOptions(
+	mid module.MID,
+	client *http.Client,
+	opts Options,
+	scoreCalculator module.CalculateScore) (module.Downloader, error) {
 	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
 		return nil, err
@@ -27,10 +75,38 @@ func New(
 	if client == nil {
 		return nil, genParameterError("nil http client")
 	}
-	return &myDownloader{
+	downloader := &myDownloader{
 		ModuleInternal: moduleBase,
 		httpClient:     *client,
-	}, nil
+	}
+	maxRedirects := opts.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+	downloader.httpClient.CheckRedirect = genCheckRedirect(maxRedirects, client.CheckRedirect)
+	headers := opts.Headers
+	if headers == nil {
+		headers = DefaultHeaderProfiles()
+	}
+	if err := headers.Check(); err != nil {
+		return nil, err
+	}
+	downloader.headers = newHeaderApplier(*headers)
+	if opts.ProxyPool != nil {
+		if err := downloader.useProxyPool(opts.ProxyPool); err != nil {
+			return nil, err
+		}
+	}
+	if opts.CookieJar != nil {
+		downloader.httpClient.Jar = opts.CookieJar
+	}
+	if opts.CacheDir != "" {
+		downloader.cache, err = newHTTPCache(opts.CacheDir)
+		if err != nil {
+			return nil, genError(fmt.Sprintf("couldn't create HTTP cache: %s", err))
+		}
+	}
+	return downloader, nil
 }
 
 func (downloader *myDownloader) Download(req *module.Request) (*module.Response, error) {
@@ -46,10 +122,61 @@ func (downloader *myDownloader) Download(req *module.Request) (*module.Response,
 	}
 	downloader.ModuleInternal.IncrAcceptedCount()
 	fmt.Printf("Do the request (URL: %s, depth: %d)... \n", httpReq.URL, req.Depth())
-	httpResp, err := downloader.httpClient.Do(httpReq)
+	// HTTP客户端会把Cookie存储器中的Cookie添加到请求的头部，
+	// 因此需要深度复制请求，以免Cookie泄露到原请求以及检查点和死信之中。
+	doReq := httpReq.Clone(withCheckRedirect(req.Context(), req.CheckRedirect()))
+	doReq = downloader.headers.apply(doReq)
+	var meta *cacheMeta
+	if downloader.cache != nil {
+		doReq, meta = downloader.cache.prepare(doReq)
+	}
+	var proxyURL *url.URL
+	if downloader.proxies != nil {
+		var err error
+		proxyURL, err = downloader.proxies.Pick(doReq.URL)
+		if err != nil {
+			return nil, genError(fmt.Sprintf("couldn't pick a proxy: %s (URL: %s)", err, httpReq.URL))
+		}
+		doReq = doReq.WithContext(proxypool.NewContext(doReq.Context(), proxyURL))
+	}
+	start := time.Now()
+	httpResp, err := downloader.httpClient.Do(doReq)
+	if proxyURL != nil {
+		if report, proxyErr := proxyError(doReq.Context(), httpResp, err); report {
+			downloader.proxies.Report(proxyURL, proxyErr)
+		}
+	}
 	if err != nil {
+		if isTimeout(err) {
+			limit := timeoutLimit(doReq, start, downloader.httpClient.Timeout)
+			return nil, errors.NewTimeoutError(httpReq.URL.String(), limit, err)
+		}
 		return nil, err
 	}
+	redirects := redirectChain(httpResp)
+	if downloader.cache != nil {
+		httpResp = downloader.cache.handle(httpReq, httpResp, meta)
+	}
 	downloader.ModuleInternal.IncrCompletedCount()
-	return module.NewResponse(httpResp, req.Depth()), nil
+	resp := module.NewResponse(httpResp, req.Depth())
+	resp.SetRedirects(redirects)
+	return resp, nil
+}
+
+func (downloader *myDownloader) SetCookieJar(jar http.CookieJar) {
+	downloader.httpClient.Jar = jar
+}
+
+func (downloader *myDownloader) Summary() module.SummaryStruct {
+	summary := downloader.ModuleInternal.Summary()
+	extra := SummaryExtra{}
+	if downloader.cache != nil {
+		cacheSummary := downloader.cache.Summary()
+		extra.Cache = &cacheSummary
+	}
+	if downloader.proxies != nil {
+		extra.Proxies = downloader.proxies.Stats()
+	}
+	summary.Extra = extra
+	return summary
 }
@@ -0,0 +1,91 @@
+package downloader
+
+import (
+	crawlerErrors "BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestDownloader(t *testing.T, client *http.Client, opts Options) module.Downloader {
+	mid, _ := module.GenMID(module.TYPE_DOWNLOADER, 1, nil)
+	d, err := NewWithOptions(mid, client, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDownloadTimeoutLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	for _, tc := range []struct {
+		name          string
+		clientTimeout time.Duration
+		ctxTimeout    time.Duration
+		want          time.Duration
+	}{
+		{"context", 0, 200 * time.Millisecond, 200 * time.Millisecond},
+		{"client", 100 * time.Millisecond, 0, 100 * time.Millisecond},
+		{"client shorter", 100 * time.Millisecond, 5 * time.Second, 100 * time.Millisecond},
+	} {
+		d := newTestDownloader(t, &http.Client{Timeout: tc.clientTimeout}, Options{})
+		ctx := context.Background()
+		if tc.ctxTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tc.ctxTimeout)
+			defer cancel()
+		}
+		httpReq, _ := http.NewRequest("GET", srv.URL, nil)
+		_, err := d.Download(module.NewRequest(httpReq, 0).WithContext(ctx))
+		var te *crawlerErrors.TimeoutError
+		if !errors.As(err, &te) {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if diff := te.Limit - tc.want; diff < -10*time.Millisecond || diff > 10*time.Millisecond {
+			t.Errorf("%s: limit %s, want %s", tc.name, te.Limit, tc.want)
+		}
+	}
+}
+
+func TestDownloadCheckRedirect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/from" {
+			http.Redirect(w, r, "/to", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+	errRefused := errors.New("refused")
+	var checked []string
+	check := func(target *http.Request, via []*http.Request) error {
+		checked = append(checked, target.URL.Path)
+		return errRefused
+	}
+	d := newTestDownloader(t, &http.Client{}, Options{})
+	httpReq, _ := http.NewRequest("GET", srv.URL+"/from", nil)
+	_, err := d.Download(module.NewRequest(httpReq, 0).WithCheckRedirect(check))
+	if !errors.Is(err, errRefused) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(checked) != 1 || checked[0] != "/to" {
+		t.Fatalf("checked %v, want [/to]", checked)
+	}
+	// 未设置检查函数的请求照常跟随重定向。
+	resp, err := d.Download(module.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.HTTPResp().Body.Close()
+	if got := resp.FinalURL().Path; got != "/to" {
+		t.Fatalf("final path %q, want /to", got)
+	}
+}
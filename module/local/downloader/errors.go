@@ -2,6 +2,8 @@ package downloader
 
 import (
 	"BeanGithub/crawler/errors"
+	"net/http"
+	"time"
 )
 
 // genError 生成爬虫错误值。
@@ -14,3 +16,25 @@ func genParameterError(errMsg string) error {
 	return errors.NewCrawlerErrorBy(errors.ERROR_TYPE_DOWNLOADER,
 		errors.NewIllegalParameterError(errMsg))
 }
+
+// isTimeout 判断给定的下载错误是否代表超时。
+// HTTP客户端返回的*url.Error会据其底层错误判断是否超时。
+func isTimeout(err error) bool {
+	timeoutErr, ok := err.(interface{ Timeout() bool })
+	return ok && timeoutErr.Timeout()
+}
+
+// timeoutLimit 获取给定请求适用的超时时间，用于报告超时错误。
+// 请求的上下文带有截止时间时，以从start到该截止时间的时长为准，
+// 但HTTP客户端的超时时间更短时以后者为准。
+func timeoutLimit(httpReq *http.Request, start time.Time, clientTimeout time.Duration) time.Duration {
+	deadline, ok := httpReq.Context().Deadline()
+	if !ok {
+		return clientTimeout
+	}
+	limit := deadline.Sub(start).Round(time.Millisecond)
+	if clientTimeout > 0 && clientTimeout < limit {
+		return clientTimeout
+	}
+	return limit
+}
@@ -0,0 +1,219 @@
+package downloader
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// 默认的请求头部。
+const (
+	// DefaultUserAgent 默认的User-Agent头。
+	DefaultUserAgent = "Mozilla/5.0 (compatible; BeanCrawler/1.0)"
+	// DefaultAccept 默认的Accept头。
+	DefaultAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	// DefaultAcceptLanguage 默认的Accept-Language头。
+	DefaultAcceptLanguage = "zh-CN,zh;q=0.9,en;q=0.8"
+)
+
+// UARotation 代表User-Agent的轮换方式。
+type UARotation string
+
+const (
+	// UA_ROTATION_ROUND_ROBIN 代表依次轮换。
+	UA_ROTATION_ROUND_ROBIN UARotation = "round_robin"
+	// UA_ROTATION_RANDOM 代表随机选择。
+	UA_ROTATION_RANDOM UARotation = "random"
+	// UA_ROTATION_PER_HOST 代表每个主机固定使用其中一个。
+	UA_ROTATION_PER_HOST UARotation = "per_host"
+)
+
+// HeaderProfile 请求头部的配置。
+// 只会设置请求中尚未设置的头部，请求自身携带的头部总是优先。
+type HeaderProfile struct {
+	// UserAgents 轮换使用的User-Agent列表。只有一个时总是使用它。
+	UserAgents []string `json:"user_agents,omitempty"`
+	// Rotation User-Agent的轮换方式。为空时依次轮换。
+	Rotation UARotation `json:"rotation,omitempty"`
+	// Accept Accept头。
+	Accept string `json:"accept,omitempty"`
+	// AcceptLanguage Accept-Language头。
+	AcceptLanguage string `json:"accept_language,omitempty"`
+	// Header 其他的头部。
+	Header http.Header `json:"header,omitempty"`
+}
+
+// HeaderProfiles 请求头部配置的集合。
+type HeaderProfiles struct {
+	// Default 默认的头部配置。
+	Default HeaderProfile `json:"default"`
+	// Domains 域名与其专用的头部配置的字典。
+	// 请求的主机是某个域名或其子域名时使用该域名的配置，有多个时以最长的域名为准。
+	// 专用配置中未设置的字段沿用默认配置，Header中的头部会与默认配置中的合并。
+	Domains map[string]HeaderProfile `json:"domains,omitempty"`
+}
+
+// DefaultHeaderProfiles 获取默认的请求头部配置的集合。
+func DefaultHeaderProfiles() *HeaderProfiles {
+	return &HeaderProfiles{
+		Default: HeaderProfile{
+			UserAgents:     []string{DefaultUserAgent},
+			Accept:         DefaultAccept,
+			AcceptLanguage: DefaultAcceptLanguage,
+		},
+	}
+}
+
+// Check 检查请求头部配置的有效性。
+func (profiles *HeaderProfiles) Check() error {
+	if err := profiles.Default.check(); err != nil {
+		return err
+	}
+	for domain, profile := range profiles.Domains {
+		if strings.TrimSpace(domain) == "" {
+			return genParameterError("empty header profile domain")
+		}
+		if err := profile.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check 检查请求头部配置的有效性。
+func (profile HeaderProfile) check() error {
+	switch profile.Rotation {
+	case "", UA_ROTATION_ROUND_ROBIN, UA_ROTATION_RANDOM, UA_ROTATION_PER_HOST:
+	default:
+		return genParameterError(fmt.Sprintf("illegal user agent rotation: %q", profile.Rotation))
+	}
+	for _, ua := range profile.UserAgents {
+		if strings.TrimSpace(ua) == "" {
+			return genParameterError("empty user agent")
+		}
+	}
+	return nil
+}
+
+// merge 用给定的专用配置覆盖当前配置，并返回合并后的配置。
+func (profile HeaderProfile) merge(special HeaderProfile) HeaderProfile {
+	merged := profile
+	if len(special.UserAgents) > 0 {
+		merged.UserAgents = special.UserAgents
+	}
+	if special.Rotation != "" {
+		merged.Rotation = special.Rotation
+	}
+	if special.Accept != "" {
+		merged.Accept = special.Accept
+	}
+	if special.AcceptLanguage != "" {
+		merged.AcceptLanguage = special.AcceptLanguage
+	}
+	merged.Header = http.Header{}
+	for key, values := range profile.Header {
+		merged.Header[key] = values
+	}
+	for key, values := range special.Header {
+		merged.Header[key] = values
+	}
+	return merged
+}
+
+// headerApplier 请求头部的应用器。
+type headerApplier struct {
+	// defaultEntry 默认的配置项。
+	defaultEntry *profileEntry
+	// domainEntries 各个域名的配置项，按照域名长度从长到短排列。
+	domainEntries []*profileEntry
+}
+
+// profileEntry 请求头部的配置项。
+type profileEntry struct {
+	// domain 域名。默认配置项的域名为空。
+	domain string
+	// profile 合并后的头部配置。
+	profile HeaderProfile
+	// next 依次轮换时下一次使用的User-Agent的序号。
+	next uint64
+}
+
+// newHeaderApplier 根据给定的配置集合创建请求头部的应用器。
+func newHeaderApplier(profiles HeaderProfiles) *headerApplier {
+	applier := &headerApplier{
+		defaultEntry: &profileEntry{profile: profiles.Default.merge(HeaderProfile{})},
+	}
+	for domain, profile := range profiles.Domains {
+		domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+		applier.domainEntries = append(applier.domainEntries, &profileEntry{
+			domain:  domain,
+			profile: profiles.Default.merge(profile),
+		})
+	}
+	sort.Slice(applier.domainEntries, func(i, j int) bool {
+		return len(applier.domainEntries[i].domain) > len(applier.domainEntries[j].domain)
+	})
+	return applier
+}
+
+// apply 返回设置了相应头部的请求副本。
+func (applier *headerApplier) apply(httpReq *http.Request) *http.Request {
+	host := strings.ToLower(httpReq.URL.Hostname())
+	entry := applier.match(host)
+	profile := entry.profile
+	newReq := httpReq.Clone(httpReq.Context())
+	if newReq.Header == nil {
+		newReq.Header = http.Header{}
+	}
+	setHeader := func(key, value string) {
+		if value != "" && newReq.Header.Get(key) == "" {
+			newReq.Header.Set(key, value)
+		}
+	}
+	setHeader("User-Agent", entry.userAgent(host))
+	setHeader("Accept", profile.Accept)
+	setHeader("Accept-Language", profile.AcceptLanguage)
+	for key, values := range profile.Header {
+		if len(newReq.Header.Values(key)) == 0 {
+			newReq.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	return newReq
+}
+
+// match 获取与给定主机匹配的配置项。
+func (applier *headerApplier) match(host string) *profileEntry {
+	for _, entry := range applier.domainEntries {
+		if host == entry.domain || strings.HasSuffix(host, "."+entry.domain) {
+			return entry
+		}
+	}
+	return applier.defaultEntry
+}
+
+// userAgent 按照轮换方式选择一个User-Agent。
+func (entry *profileEntry) userAgent(host string) string {
+	uas := entry.profile.UserAgents
+	switch len(uas) {
+	case 0:
+		return ""
+	case 1:
+		return uas[0]
+	}
+	var index uint64
+	switch entry.profile.Rotation {
+	case UA_ROTATION_RANDOM:
+		index = uint64(rand.Intn(len(uas)))
+	case UA_ROTATION_PER_HOST:
+		h := fnv.New64a()
+		h.Write([]byte(host))
+		index = h.Sum64() % uint64(len(uas))
+	default:
+		index = (atomic.AddUint64(&entry.next, 1) - 1) % uint64(len(uas))
+	}
+	return uas[index]
+}
@@ -0,0 +1,179 @@
+package downloader
+
+import (
+	"BeanGithub/crawler/module"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newHeaderServer 创建会把收到的请求头部写回响应头部的测试服务器。
+func newHeaderServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range []string{"User-Agent", "Accept", "Accept-Language", "X-Token"} {
+			w.Header().Set("Echo-"+key, r.Header.Get(key))
+		}
+	}))
+}
+
+// downloadHeader 下载给定的URL并返回服务器收到的请求头部。
+func downloadHeader(t *testing.T, d module.Downloader, httpReq *http.Request) http.Header {
+	resp, err := d.Download(module.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpResp := resp.HTTPResp()
+	httpResp.Body.Close()
+	echoed := http.Header{}
+	for key, values := range httpResp.Header {
+		if name := strings.TrimPrefix(key, "Echo-"); name != key {
+			echoed[name] = values
+		}
+	}
+	return echoed
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	srv := newHeaderServer()
+	defer srv.Close()
+	mid, _ := module.GenMID(module.TYPE_DOWNLOADER, 1, nil)
+	d, err := New(mid, &http.Client{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq, _ := http.NewRequest("GET", srv.URL, nil)
+	header := downloadHeader(t, d, httpReq)
+	if ua := header.Get("User-Agent"); ua != DefaultUserAgent {
+		t.Errorf("User-Agent %q, want %q", ua, DefaultUserAgent)
+	}
+	if accept := header.Get("Accept"); accept != DefaultAccept {
+		t.Errorf("Accept %q, want %q", accept, DefaultAccept)
+	}
+	if lang := header.Get("Accept-Language"); lang != DefaultAcceptLanguage {
+		t.Errorf("Accept-Language %q, want %q", lang, DefaultAcceptLanguage)
+	}
+}
+
+func TestEmptyHeaderProfiles(t *testing.T) {
+	srv := newHeaderServer()
+	defer srv.Close()
+	d := newTestDownloader(t, &http.Client{}, Options{Headers: &HeaderProfiles{}})
+	httpReq, _ := http.NewRequest("GET", srv.URL, nil)
+	header := downloadHeader(t, d, httpReq)
+	if ua := header.Get("User-Agent"); ua == DefaultUserAgent {
+		t.Errorf("User-Agent %q set by empty profiles", ua)
+	}
+	if accept := header.Get("Accept"); accept != "" {
+		t.Errorf("Accept %q set by empty profiles", accept)
+	}
+}
+
+func TestDomainHeaderProfile(t *testing.T) {
+	srv := newHeaderServer()
+	defer srv.Close()
+	profiles := DefaultHeaderProfiles()
+	profiles.Domains = map[string]HeaderProfile{
+		"127.0.0.1": {
+			UserAgents: []string{"local-agent"},
+			Header:     http.Header{"X-Token": {"secret"}},
+		},
+	}
+	d := newTestDownloader(t, &http.Client{}, Options{Headers: profiles})
+	httpReq, _ := http.NewRequest("GET", srv.URL, nil)
+	header := downloadHeader(t, d, httpReq)
+	if ua := header.Get("User-Agent"); ua != "local-agent" {
+		t.Errorf("User-Agent %q, want %q", ua, "local-agent")
+	}
+	if token := header.Get("X-Token"); token != "secret" {
+		t.Errorf("X-Token %q, want %q", token, "secret")
+	}
+	// 专用配置中未设置的字段沿用默认配置。
+	if accept := header.Get("Accept"); accept != DefaultAccept {
+		t.Errorf("Accept %q, want %q", accept, DefaultAccept)
+	}
+}
+
+func TestRequestHeadersTakePriority(t *testing.T) {
+	srv := newHeaderServer()
+	defer srv.Close()
+	profiles := DefaultHeaderProfiles()
+	profiles.Default.Header = http.Header{"X-Token": {"profile"}}
+	d := newTestDownloader(t, &http.Client{}, Options{Headers: profiles})
+	httpReq, _ := http.NewRequest("GET", srv.URL, nil)
+	httpReq.Header.Set("User-Agent", "own-agent")
+	httpReq.Header.Set("X-Token", "own")
+	header := downloadHeader(t, d, httpReq)
+	if ua := header.Get("User-Agent"); ua != "own-agent" {
+		t.Errorf("User-Agent %q, want %q", ua, "own-agent")
+	}
+	if token := header.Get("X-Token"); token != "own" {
+		t.Errorf("X-Token %q, want %q", token, "own")
+	}
+	if lang := header.Get("Accept-Language"); lang != DefaultAcceptLanguage {
+		t.Errorf("Accept-Language %q, want %q", lang, DefaultAcceptLanguage)
+	}
+}
+
+func TestUserAgentRotation(t *testing.T) {
+	uas := []string{"ua-0", "ua-1", "ua-2"}
+	userAgent := func(applier *headerApplier, rawURL string) string {
+		httpReq, _ := http.NewRequest("GET", rawURL, nil)
+		return applier.apply(httpReq).Header.Get("User-Agent")
+	}
+	roundRobin := newHeaderApplier(HeaderProfiles{
+		Default: HeaderProfile{UserAgents: uas, Rotation: UA_ROTATION_ROUND_ROBIN},
+	})
+	for i := 0; i < 2*len(uas); i++ {
+		if ua := userAgent(roundRobin, "http://example.com/"); ua != uas[i%len(uas)] {
+			t.Fatalf("round_robin request %d: User-Agent %q, want %q", i, ua, uas[i%len(uas)])
+		}
+	}
+	perHost := newHeaderApplier(HeaderProfiles{
+		Default: HeaderProfile{UserAgents: uas, Rotation: UA_ROTATION_PER_HOST},
+	})
+	chosen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		host := string(rune('a'+i)) + ".example.com"
+		first := userAgent(perHost, "http://"+host+"/1")
+		if second := userAgent(perHost, "http://"+host+"/2"); second != first {
+			t.Fatalf("per_host %s: User-Agent changed from %q to %q", host, first, second)
+		}
+		chosen[first] = true
+	}
+	if len(chosen) < 2 {
+		t.Fatalf("per_host chose %d distinct User-Agents for 20 hosts", len(chosen))
+	}
+	random := newHeaderApplier(HeaderProfiles{
+		Default: HeaderProfile{UserAgents: uas, Rotation: UA_ROTATION_RANDOM},
+	})
+	for i := 0; i < 10; i++ {
+		ua := userAgent(random, "http://example.com/")
+		if ua != uas[0] && ua != uas[1] && ua != uas[2] {
+			t.Fatalf("random: unexpected User-Agent %q", ua)
+		}
+	}
+}
+
+func TestDomainProfileMatch(t *testing.T) {
+	applier := newHeaderApplier(HeaderProfiles{
+		Default: HeaderProfile{UserAgents: []string{"default"}},
+		Domains: map[string]HeaderProfile{
+			"example.com":     {UserAgents: []string{"example"}},
+			"api.example.com": {UserAgents: []string{"api"}},
+		},
+	})
+	for rawURL, want := range map[string]string{
+		"http://example.com/":         "example",
+		"http://www.example.com/":     "example",
+		"http://API.example.com/":     "api",
+		"http://v1.api.example.com/":  "api",
+		"http://notexample.com/":      "default",
+		"http://example.com.evil.io/": "default",
+	} {
+		httpReq, _ := http.NewRequest("GET", rawURL, nil)
+		if ua := applier.apply(httpReq).Header.Get("User-Agent"); ua != want {
+			t.Errorf("%s: User-Agent %q, want %q", rawURL, ua, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package downloader
+
+import (
+	"BeanGithub/crawler/toolkit/proxypool"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// errProxyAuthRequired 表示代理要求认证的错误。
+var errProxyAuthRequired = errors.New("proxy authentication required")
+
+// useProxyPool 让下载器通过给定的代理池发送请求。
+// 会复制HTTP客户端的传输器，并让其使用保存在请求上下文中的代理。
+func (downloader *myDownloader) useProxyPool(pool proxypool.Pool) error {
+	var transport *http.Transport
+	switch t := downloader.httpClient.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return genParameterError(fmt.Sprintf("unsupported transport type for proxy pool: %T", t))
+	}
+	transport.Proxy = proxypool.ProxyFunc(transport.Proxy)
+	// 通过HTTP代理访问HTTPS站点时，代理要求认证会以CONNECT请求的响应的形式出现。
+	next := transport.OnProxyConnectResponse
+	transport.OnProxyConnectResponse = func(
+		ctx context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error {
+		if connectRes.StatusCode == http.StatusProxyAuthRequired {
+			return errProxyAuthRequired
+		}
+		if next != nil {
+			return next(ctx, proxyURL, connectReq, connectRes)
+		}
+		return nil
+	}
+	downloader.httpClient.Transport = transport
+	downloader.proxies = pool
+	return nil
+}
+
+// proxyError 根据请求的结果判断代理是否失败。
+// 只有可归咎于代理的失败才算作代理失败，即无法连接代理（包括SOCKS握手失败）和代理要求认证。
+// 第一个结果值表示是否需要向代理池报告该结果：
+// 因上下文被取消或超时而失败的请求，以及因目标服务器等其他原因而失败的请求都不必报告。
+func proxyError(ctx context.Context, httpResp *http.Response, err error) (bool, error) {
+	if err == nil {
+		if httpResp != nil && httpResp.StatusCode == http.StatusProxyAuthRequired {
+			return true, errProxyAuthRequired
+		}
+		return true, nil
+	}
+	if ctx.Err() != nil ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false, nil
+	}
+	if errors.Is(err, errProxyAuthRequired) {
+		return true, err
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) &&
+		(opErr.Op == "proxyconnect" || strings.HasPrefix(opErr.Op, "socks")) {
+		return true, err
+	}
+	return false, nil
+}
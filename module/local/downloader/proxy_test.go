@@ -0,0 +1,130 @@
+package downloader
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/proxypool"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newStandInProxy 创建一个充当HTTP代理的测试服务器。
+// 它不会真正转发请求，而是直接以给定的状态码作出响应。
+// 参数delay 作出响应之前的停顿时间。
+func newStandInProxy(status int, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+	}))
+}
+
+// deadProxyURL 返回一个无法连接的代理的URL。
+func deadProxyURL(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return "http://" + addr
+}
+
+func newProxyDownloader(t *testing.T, proxyURL string) (module.Downloader, proxypool.Pool) {
+	pool, err := proxypool.New([]string{proxyURL}, proxypool.Options{
+		MaxFailures:    2,
+		RetestInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestDownloader(t, &http.Client{}, Options{ProxyPool: pool}), pool
+}
+
+func download(d module.Downloader, ctx context.Context) error {
+	return downloadURL(d, ctx, "http://example.invalid/")
+}
+
+func downloadURL(d module.Downloader, ctx context.Context, rawURL string) error {
+	httpReq, _ := http.NewRequest("GET", rawURL, nil)
+	resp, err := d.Download(module.NewRequest(httpReq, 0).WithContext(ctx))
+	if resp != nil && resp.HTTPResp() != nil {
+		resp.HTTPResp().Body.Close()
+	}
+	return err
+}
+
+func TestProxyUnreachable(t *testing.T) {
+	d, pool := newProxyDownloader(t, deadProxyURL(t))
+	for i := 0; i < 2; i++ {
+		if err := download(d, context.Background()); err == nil {
+			t.Fatal("download through a dead proxy succeeded")
+		}
+	}
+	stats := pool.Stats()[0]
+	if stats.Healthy || stats.Failures != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if err := download(d, context.Background()); err == nil {
+		t.Fatal("download without a healthy proxy succeeded")
+	}
+}
+
+func TestProxyAuthRequired(t *testing.T) {
+	proxy := newStandInProxy(http.StatusProxyAuthRequired, 0)
+	defer proxy.Close()
+	d, pool := newProxyDownloader(t, proxy.URL)
+	download(d, context.Background())
+	if stats := pool.Stats()[0]; stats.ConsecutiveFailures != 1 || !stats.Healthy {
+		t.Fatalf("unexpected stats after a 407: %+v", stats)
+	}
+	// 访问HTTPS站点时，代理要求认证会以CONNECT请求的响应的形式出现。
+	if err := downloadURL(d, context.Background(), "https://example.invalid/"); err == nil {
+		t.Fatal("download succeeded after a 407 to CONNECT")
+	}
+	if stats := pool.Stats()[0]; stats.Healthy {
+		t.Fatalf("the proxy is still healthy after two 407s: %+v", stats)
+	}
+}
+
+func TestProxyTargetFailure(t *testing.T) {
+	proxy := newStandInProxy(http.StatusBadGateway, 0)
+	defer proxy.Close()
+	d, pool := newProxyDownloader(t, proxy.URL)
+	for i := 0; i < 3; i++ {
+		download(d, context.Background())
+	}
+	if stats := pool.Stats()[0]; !stats.Healthy || stats.Failures != 0 {
+		t.Fatalf("target failures were counted against the proxy: %+v", stats)
+	}
+}
+
+func TestProxyCanceledAndDeadline(t *testing.T) {
+	proxy := newStandInProxy(http.StatusOK, 10*time.Second)
+	defer proxy.Close()
+	d, pool := newProxyDownloader(t, proxy.URL)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if err := download(d, ctx); err == nil {
+			t.Fatal("download succeeded after the deadline")
+		}
+		cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if err := download(d, ctx); err == nil {
+		t.Fatal("download succeeded after cancellation")
+	}
+	if stats := pool.Stats()[0]; !stats.Healthy || stats.Failures != 0 {
+		t.Fatalf("canceled requests were counted against the proxy: %+v", stats)
+	}
+}
@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"BeanGithub/crawler/module"
+	"context"
+	"errors"
+	"net/http"
+)
+
+// DefaultMaxRedirects 默认的最多跟随的重定向次数。
+const DefaultMaxRedirects = 10
+
+// ErrTooManyRedirects 表示重定向次数超出限制的错误。
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// ErrRedirectLoop 表示重定向出现循环的错误。
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// checkRedirectKey 上下文中请求的重定向检查函数的键类型。
+type checkRedirectKey struct{}
+
+// withCheckRedirect 返回带有给定请求的重定向检查函数的上下文。
+// 跟随重定向时HTTP客户端会沿用原始请求的上下文，因此可以借此找到该函数。
+func withCheckRedirect(ctx context.Context, check module.CheckRedirect) context.Context {
+	if check == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, checkRedirectKey{}, check)
+}
+
+// genCheckRedirect 生成HTTP客户端使用的重定向检查函数。
+// 请求自带的重定向检查函数会在次数和循环检查之后、HTTP客户端原有的检查函数之前被调用。
+// 参数maxRedirects 最多跟随的重定向次数。为负数时不跟随重定向。
+// 参数next HTTP客户端原有的重定向检查函数。为nil时忽略。
+func genCheckRedirect(
+	maxRedirects int,
+	next func(req *http.Request, via []*http.Request) error) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if maxRedirects < 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= maxRedirects {
+			return ErrTooManyRedirects
+		}
+		target := req.URL.String()
+		for _, prev := range via {
+			if prev.URL.String() == target {
+				return ErrRedirectLoop
+			}
+		}
+		if check, ok := req.Context().Value(checkRedirectKey{}).(module.CheckRedirect); ok {
+			if err := check(req, via); err != nil {
+				return err
+			}
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		return nil
+	}
+}
+
+// redirectChain 获取得到给定响应之前经过的重定向的列表。
+func redirectChain(httpResp *http.Response) []module.Redirect {
+	var redirects []module.Redirect
+	for req := httpResp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		redirectResp := req.Response
+		if redirectResp.Request == nil {
+			break
+		}
+		redirects = append(redirects, module.Redirect{
+			From:       redirectResp.Request.URL,
+			To:         req.URL,
+			StatusCode: redirectResp.StatusCode,
+		})
+	}
+	// 以上是从最后一次重定向开始倒序收集的。
+	for i, j := 0, len(redirects)-1; i < j; i, j = i+1, j-1 {
+		redirects[i], redirects[j] = redirects[j], redirects[i]
+	}
+	return redirects
+}
@@ -0,0 +1,347 @@
+package parser
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/link"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// 订阅源生成的条目中的键。
+const (
+	// FEED_KEY_TITLE 标题的键。
+	FEED_KEY_TITLE = "title"
+	// FEED_KEY_LINK 链接的键。
+	FEED_KEY_LINK = "link"
+	// FEED_KEY_PUBLISHED 发布时间的键。能够解析时为RFC 3339格式，否则为原始的值。
+	FEED_KEY_PUBLISHED = "published"
+	// FEED_KEY_AUTHOR 作者的键。
+	FEED_KEY_AUTHOR = "author"
+	// FEED_KEY_SUMMARY 摘要的键。没有摘要时为正文。
+	FEED_KEY_SUMMARY = "summary"
+)
+
+// feedDateLayouts 订阅源中的日期时间可以使用的格式。
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// FeedOptions 订阅源解析函数的可选项。
+type FeedOptions struct {
+	// NoFollow 是否不为条目的链接生成请求。
+	NoFollow bool `json:"no_follow,omitempty"`
+	// URLPatterns 条目链接的正则表达式列表，匹配其中之一才会生成请求。为空时不做限制。
+	URLPatterns []string `json:"url_patterns,omitempty"`
+}
+
+// ParseFeed 使用默认选项解析RSS和Atom订阅源的响应解析函数。
+var ParseFeed = mustFeedParser(FeedOptions{})
+
+// NewFeedParser 创建一个RSS和Atom订阅源的响应解析函数。
+// 该函数会为订阅源中的每个条目生成一个条目（module.Item），其中包括标题、链接、发布时间、作者以及摘要，
+// 并为条目的链接生成请求。
+// 订阅源通过内容类型或者根元素来识别，不是订阅源的响应会被忽略，因此可以与其他解析函数一起使用。
+func NewFeedParser(opts FeedOptions) (module.ParseResponse, error) {
+	urlPatterns, err := compilePatterns(opts.URLPatterns)
+	if err != nil {
+		return nil, err
+	}
+	fp := &feedParser{
+		noFollow:    opts.NoFollow,
+		urlPatterns: urlPatterns,
+	}
+	return fp.parse, nil
+}
+
+// mustFeedParser 创建一个订阅源的响应解析函数。创建失败时会引发运行时恐慌。
+func mustFeedParser(opts FeedOptions) module.ParseResponse {
+	parse, err := NewFeedParser(opts)
+	if err != nil {
+		panic(err)
+	}
+	return parse
+}
+
+// feedParser 订阅源的解析器。
+type feedParser struct {
+	// noFollow 是否不为条目的链接生成请求。
+	noFollow bool
+	// urlPatterns 条目链接的正则表达式列表。
+	urlPatterns []*regexp.Regexp
+}
+
+// feedEntry 订阅源中的条目。
+type feedEntry struct {
+	// title 标题。
+	title string
+	// link 链接。
+	link string
+	// published 发布时间的原始的值。
+	published string
+	// author 作者。
+	author string
+	// summary 摘要。
+	summary string
+}
+
+// rssDocument RSS 2.0（以及RSS 0.9x和RSS 1.0）订阅源的根元素。
+type rssDocument struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	// Items RSS 1.0的条目，它们与channel元素同级。
+	Items []rssItem `xml:"item"`
+}
+
+// rssItem RSS订阅源中的item元素。
+type rssItem struct {
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+	GUID  struct {
+		Value       string `xml:",chardata"`
+		IsPermaLink string `xml:"isPermaLink,attr"`
+	} `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Author      string `xml:"author"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+// atomFeed Atom订阅源的根元素。
+type atomFeed struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomEntry Atom订阅源中的entry元素。
+type atomEntry struct {
+	Title     atomText   `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Authors   []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Summary atomText `xml:"summary"`
+	Content atomText `xml:"content"`
+}
+
+// atomText Atom订阅源中的文本构造。
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// atomLink Atom订阅源中的link元素。
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+// parse 解析订阅源的响应。只解析状态码为2xx的响应。
+func (fp *feedParser) parse(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+	if httpResp == nil {
+		return nil, []error{fmt.Errorf("nil HTTP response")}
+	}
+	httpReq := httpResp.Request
+	if httpReq == nil || httpReq.URL == nil {
+		return nil, []error{fmt.Errorf("nil HTTP request")}
+	}
+	reqURL := httpReq.URL
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 || httpResp.Body == nil {
+		return nil, nil
+	}
+	contentType := httpResp.Header.Get("Content-Type")
+	if isHTML(contentType) {
+		return nil, nil
+	}
+	entries, ok, err := readFeed(httpResp.Body, isUTF8(contentType))
+	if !ok {
+		if err != nil && isFeed(contentType) {
+			return nil, []error{fmt.Errorf("couldn't parse feed (URL: %s): %s", reqURL, err)}
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, []error{fmt.Errorf("couldn't parse feed (URL: %s): %s", reqURL, err)}
+	}
+	dataList := []module.Data{}
+	var errs []error
+	for _, entry := range entries {
+		linkURL := link.Resolve(reqURL, entry.link)
+		item := module.Item{
+			ITEM_KEY_URL:       reqURL.String(),
+			FEED_KEY_TITLE:     entry.title,
+			FEED_KEY_LINK:      entry.link,
+			FEED_KEY_PUBLISHED: formatFeedDate(entry.published),
+			FEED_KEY_AUTHOR:    entry.author,
+			FEED_KEY_SUMMARY:   entry.summary,
+		}
+		if linkURL != nil {
+			item[FEED_KEY_LINK] = linkURL.String()
+		}
+		dataList = append(dataList, item)
+		if fp.noFollow || linkURL == nil || !matchAny(fp.urlPatterns, linkURL.String()) {
+			continue
+		}
+		httpReq, err := http.NewRequest("GET", linkURL.String(), nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		dataList = append(dataList, module.NewRequest(httpReq, respDepth))
+	}
+	return dataList, errs
+}
+
+// readFeed 读取订阅源中的条目。
+// 参数utf8 表示内容是否已经（例如由分析器）转换为UTF-8。为true时会忽略XML声明中的编码。
+// 第二个结果值表示内容是否为订阅源，只有在其为true时第一个结果值才有意义。
+func readFeed(reader io.Reader, utf8 bool) ([]feedEntry, bool, error) {
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = charset.NewReaderLabel
+	if utf8 {
+		decoder.CharsetReader = keepCharset
+	}
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, false, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(start.Name.Local) {
+		case "rss", "rdf":
+			var doc rssDocument
+			if err := decoder.DecodeElement(&doc, &start); err != nil {
+				return nil, true, err
+			}
+			items := append(doc.Channel.Items, doc.Items...)
+			entries := make([]feedEntry, 0, len(items))
+			for _, item := range items {
+				entries = append(entries, item.entry())
+			}
+			return entries, true, nil
+		case "feed":
+			var feed atomFeed
+			if err := decoder.DecodeElement(&feed, &start); err != nil {
+				return nil, true, err
+			}
+			entries := make([]feedEntry, 0, len(feed.Entries))
+			for _, entry := range feed.Entries {
+				entries = append(entries, entry.entry())
+			}
+			return entries, true, nil
+		default:
+			return nil, false, nil
+		}
+	}
+}
+
+// entry 把RSS条目转换为订阅源中的条目。
+func (item rssItem) entry() feedEntry {
+	entry := feedEntry{
+		title:     strings.TrimSpace(item.Title),
+		link:      strings.TrimSpace(item.Link),
+		published: firstNonEmpty(item.PubDate, item.Date),
+		author:    firstNonEmpty(item.Author, item.Creator),
+		summary:   firstNonEmpty(item.Description, item.Content),
+	}
+	if entry.link == "" && !strings.EqualFold(item.GUID.IsPermaLink, "false") {
+		entry.link = strings.TrimSpace(item.GUID.Value)
+	}
+	return entry
+}
+
+// entry 把Atom条目转换为订阅源中的条目。
+// 链接优先选用rel为alternate（或未设置rel）的link元素。
+func (atom atomEntry) entry() feedEntry {
+	entry := feedEntry{
+		title:     atom.Title.String(),
+		published: firstNonEmpty(atom.Published, atom.Updated),
+		summary:   firstNonEmpty(atom.Summary.String(), atom.Content.String()),
+	}
+	for _, link := range atom.Links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			entry.link = strings.TrimSpace(link.Href)
+			break
+		}
+	}
+	if entry.link == "" && len(atom.Links) > 0 {
+		entry.link = strings.TrimSpace(atom.Links[0].Href)
+	}
+	if len(atom.Authors) > 0 {
+		entry.author = strings.TrimSpace(atom.Authors[0].Name)
+	}
+	return entry
+}
+
+// String 获取文本构造的内容。XHTML类型的文本会保留其中的标签。
+func (text atomText) String() string {
+	if text.Type == "xhtml" {
+		return strings.TrimSpace(text.Inner)
+	}
+	return strings.TrimSpace(text.Text)
+}
+
+// formatFeedDate 把订阅源中的日期时间转换为RFC 3339格式。无法解析时返回原始的值。
+func formatFeedDate(value string) string {
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return value
+}
+
+// isFeed 判断给定的内容类型是否为订阅源。
+func isFeed(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.HasPrefix(contentType, "application/rss+xml") ||
+		strings.HasPrefix(contentType, "application/atom+xml") ||
+		strings.HasPrefix(contentType, "application/rdf+xml")
+}
+
+// isUTF8 判断给定的内容类型是否声明了UTF-8字符集。
+func isUTF8(contentType string) bool {
+	_, params, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.EqualFold(params["charset"], "utf-8")
+}
+
+// keepCharset 不做任何转换的字符集读取器，用于已经转换为UTF-8的内容。
+func keepCharset(label string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
+
+// firstNonEmpty 返回第一个去掉首尾空白之后不为空的值。
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
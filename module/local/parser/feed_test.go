@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"BeanGithub/crawler/module"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func newTestResponse(rawURL, contentType string, body []byte) *http.Response {
+	req, _ := http.NewRequest("GET", rawURL, nil)
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Request:    req,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}
+}
+
+func TestFeedRSS(t *testing.T) {
+	rss := `<?xml version="1.0"?><rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/"><channel><title>B</title>
+<item><title> Hello </title><link>/p/1</link><pubDate>Mon, 02 Jan 2006 15:04:05 -0700</pubDate><dc:creator>Ann</dc:creator><description>&lt;b&gt;x&lt;/b&gt;</description></item>
+<item><title>G</title><guid>https://blog.com/p/2</guid></item></channel></rss>`
+	dataList, errs := ParseFeed(newTestResponse("https://blog.com/feed", "text/xml", []byte(rss)), 0)
+	if len(errs) > 0 || len(dataList) != 4 {
+		t.Fatalf("data: %v, errors: %v", dataList, errs)
+	}
+	item := dataList[0].(module.Item)
+	want := module.Item{
+		ITEM_KEY_URL:       "https://blog.com/feed",
+		FEED_KEY_TITLE:     "Hello",
+		FEED_KEY_LINK:      "https://blog.com/p/1",
+		FEED_KEY_PUBLISHED: "2006-01-02T15:04:05-07:00",
+		FEED_KEY_AUTHOR:    "Ann",
+		FEED_KEY_SUMMARY:   "<b>x</b>",
+	}
+	for key, value := range want {
+		if item[key] != value {
+			t.Errorf("%s: %q, want %q", key, item[key], value)
+		}
+	}
+	if req := dataList[3].(*module.Request); req.HTTPReq().URL.String() != "https://blog.com/p/2" {
+		t.Errorf("guid link: %s", req.HTTPReq().URL)
+	}
+}
+
+func TestFeedAtom(t *testing.T) {
+	atom := `<feed xmlns="http://www.w3.org/2005/Atom"><entry><title type="html">T</title>
+<link rel="self" href="https://x/self"/><link href="https://blog.com/a"/><updated>2024-01-01T00:00:00Z</updated>
+<author><name>Bob</name></author><content type="xhtml"><div>c</div></content></entry></feed>`
+	dataList, errs := ParseFeed(newTestResponse("https://blog.com/atom", "application/atom+xml", []byte(atom)), 0)
+	if len(errs) > 0 || len(dataList) != 2 {
+		t.Fatalf("data: %v, errors: %v", dataList, errs)
+	}
+	item := dataList[0].(module.Item)
+	if item[FEED_KEY_LINK] != "https://blog.com/a" || item[FEED_KEY_AUTHOR] != "Bob" ||
+		item[FEED_KEY_SUMMARY] != "<div>c</div>" || item[FEED_KEY_PUBLISHED] != "2024-01-01T00:00:00Z" {
+		t.Fatalf("unexpected item: %v", item)
+	}
+}
+
+func TestFeedIgnored(t *testing.T) {
+	for _, c := range []struct{ contentType, body string }{
+		{"text/html", "<html/>"},
+		{"application/json", "{}"},
+		{"application/xml", "<urlset/>"},
+	} {
+		if dataList, errs := ParseFeed(newTestResponse("https://blog.com/", c.contentType, []byte(c.body)), 0); dataList != nil || errs != nil {
+			t.Errorf("%s: data: %v, errors: %v", c.contentType, dataList, errs)
+		}
+	}
+	if _, errs := ParseFeed(newTestResponse("https://blog.com/", "application/rss+xml", []byte("oops")), 0); errs == nil {
+		t.Error("expected an error for a malformed feed")
+	}
+}
+
+func TestFeedCharset(t *testing.T) {
+	const title = "中文标题"
+	gbkTitle, _ := simplifiedchinese.GBK.NewEncoder().String(title)
+	feed := func(decl, title string) []byte {
+		return []byte(`<?xml version="1.0" encoding="` + decl + `"?><rss><channel><item><title>` +
+			title + `</title></item></channel></rss>`)
+	}
+	for _, c := range []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		// 未经分析器转码：以XML声明为准。
+		{"raw gbk", "application/rss+xml", feed("gbk", gbkTitle)},
+		// 已经由分析器转码：忽略XML声明。
+		{"transcoded", "application/rss+xml; charset=utf-8", feed("gbk", title)},
+	} {
+		dataList, errs := ParseFeed(newTestResponse("https://blog.com/feed", c.contentType, c.body), 0)
+		if len(errs) > 0 || len(dataList) == 0 {
+			t.Fatalf("%s: data: %v, errors: %v", c.name, dataList, errs)
+		}
+		if got := dataList[0].(module.Item)[FEED_KEY_TITLE]; got != title {
+			t.Errorf("%s: title %q, want %q", c.name, got, title)
+		}
+	}
+}
+
+func TestFormatFeedDate(t *testing.T) {
+	for value, want := range map[string]string{
+		"Tue, 10 Jun 2003 04:00:00 GMT": "2003-06-10T04:00:00Z",
+		"2 Jan 2006 15:04:05 +0800":     "2006-01-02T15:04:05+08:00",
+		"not a date":                    "not a date",
+	} {
+		if got := formatFeedDate(value); got != want {
+			t.Errorf("%q: %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package parser
+
+import (
+	"BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/link"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// 规则生成的条目中的保留键。
+const (
+	// ITEM_KEY_URL 条目所在页面的URL的键。
+	ITEM_KEY_URL = "_url"
+	// ITEM_KEY_RULE 生成条目的规则的名称的键。
+	ITEM_KEY_RULE = "_rule"
+)
+
+// 字段后处理的操作。
+const (
+	// PROCESS_TRIM 去掉首尾的空白。
+	PROCESS_TRIM = "trim"
+	// PROCESS_SQUASH 把连续的空白合并为一个空格，并去掉首尾的空白。
+	PROCESS_SQUASH = "squash"
+	// PROCESS_LOWER 转为小写。
+	PROCESS_LOWER = "lower"
+	// PROCESS_UPPER 转为大写。
+	PROCESS_UPPER = "upper"
+	// PROCESS_ABS_URL 以页面中的base元素（没有时即为页面URL）为基准转为绝对URL。
+	PROCESS_ABS_URL = "abs_url"
+	// PROCESS_REGEX 取正则表达式的第一个分组（没有分组时取整个匹配）。不匹配时为空。
+	PROCESS_REGEX = "regex"
+	// PROCESS_REPLACE 把正则表达式的所有匹配替换为给定的值。
+	PROCESS_REPLACE = "replace"
+	// PROCESS_DEFAULT 为空时使用给定的值。
+	PROCESS_DEFAULT = "default"
+	// PROCESS_INT 转为整数。只能是最后一步，无法转换时字段值为nil。
+	PROCESS_INT = "int"
+	// PROCESS_FLOAT 转为浮点数。只能是最后一步，无法转换时字段值为nil。
+	PROCESS_FLOAT = "float"
+)
+
+// RuleSet 抽取规则的集合。
+type RuleSet struct {
+	// Rules 抽取规则的列表。
+	Rules []Rule `json:"rules"`
+}
+
+// Rule 抽取规则。
+// 一条规则会从适用的HTML页面中抽取条目，并生成需要跟进的请求。
+type Rule struct {
+	// Name 规则的名称。
+	Name string `json:"name"`
+	// URLPatterns 适用的页面URL的正则表达式列表，匹配其中之一即可。为空时适用于所有页面。
+	URLPatterns []string `json:"url_patterns,omitempty"`
+	// Scope 条目所在元素的CSS选择器。每个匹配的元素都会生成一个条目。
+	// 为空时整个页面生成一个条目。
+	Scope string `json:"scope,omitempty"`
+	// Fields 条目字段的规则列表。为空时不生成条目。
+	Fields []FieldRule `json:"fields,omitempty"`
+	// Required 必需的字段的名称列表。其中任何一个字段为空时都不会生成条目。
+	Required []string `json:"required,omitempty"`
+	// Follow 需要跟进的链接的规则列表。
+	Follow []FollowRule `json:"follow,omitempty"`
+}
+
+// FieldRule 条目字段的规则。
+type FieldRule struct {
+	// Name 字段的名称。
+	Name string `json:"name"`
+	// Selector 字段所在元素的CSS选择器，相对于条目所在的元素。为空时即为条目所在的元素。
+	Selector string `json:"selector,omitempty"`
+	// Attr 取值的属性。为空时取元素的文本。
+	Attr string `json:"attr,omitempty"`
+	// HTML 是否取元素的内部HTML。设置了Attr时忽略。
+	HTML bool `json:"html,omitempty"`
+	// Multiple 是否取所有匹配的元素的值。
+	// 为true时字段值为列表，否则只取第一个匹配的元素的值。
+	Multiple bool `json:"multiple,omitempty"`
+	// Process 依次执行的后处理步骤。
+	Process []ProcessStep `json:"process,omitempty"`
+}
+
+// ProcessStep 字段的后处理步骤。
+type ProcessStep struct {
+	// Op 操作。可选值见PROCESS_*常量。
+	Op string `json:"op"`
+	// Pattern regex和replace操作使用的正则表达式。
+	Pattern string `json:"pattern,omitempty"`
+	// Value replace操作使用的替换文本，或者default操作使用的默认值。
+	Value string `json:"value,omitempty"`
+}
+
+// FollowRule 需要跟进的链接的规则。
+type FollowRule struct {
+	// Selector 链接所在元素的CSS选择器。
+	Selector string `json:"selector"`
+	// Attr 链接所在的属性。为空时使用href。
+	Attr string `json:"attr,omitempty"`
+	// URLPatterns 链接的正则表达式列表，匹配其中之一才会跟进。为空时跟进所有链接。
+	URLPatterns []string `json:"url_patterns,omitempty"`
+	// Priority 生成的请求的优先级。
+	Priority float64 `json:"priority,omitempty"`
+}
+
+// LoadRuleSet 从给定的JSON文件中读取抽取规则的集合。
+func LoadRuleSet(path string) (RuleSet, error) {
+	var ruleSet RuleSet
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ruleSet, err
+	}
+	if err := json.Unmarshal(data, &ruleSet); err != nil {
+		return ruleSet, fmt.Errorf("couldn't parse rule set %q: %s", path, err)
+	}
+	return ruleSet, nil
+}
+
+// Compile 把给定的抽取规则的集合编译为响应解析函数的列表。
+// 每条规则对应一个响应解析函数。
+func Compile(ruleSet RuleSet) ([]module.ParseResponse, error) {
+	if len(ruleSet.Rules) == 0 {
+		return nil, errors.NewIllegalParameterError("empty rule list")
+	}
+	parsers := make([]module.ParseResponse, 0, len(ruleSet.Rules))
+	names := map[string]struct{}{}
+	for i, rule := range ruleSet.Rules {
+		if rule.Name == "" {
+			return nil, errors.NewIllegalParameterError(fmt.Sprintf("empty name of rule[%d]", i))
+		}
+		if _, ok := names[rule.Name]; ok {
+			return nil, errors.NewIllegalParameterError(fmt.Sprintf("duplicate rule name: %q", rule.Name))
+		}
+		names[rule.Name] = struct{}{}
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, errors.NewIllegalParameterError(
+				fmt.Sprintf("illegal rule %q: %s", rule.Name, err))
+		}
+		parsers = append(parsers, compiled.parse)
+	}
+	return parsers, nil
+}
+
+// compiledRule 编译后的抽取规则。
+type compiledRule struct {
+	// name 规则的名称。
+	name string
+	// urlPatterns 适用的页面URL的正则表达式列表。
+	urlPatterns []*regexp.Regexp
+	// scope 条目所在元素的CSS选择器。
+	scope string
+	// fields 编译后的字段规则列表。
+	fields []*compiledField
+	// required 必需的字段的名称列表。
+	required []string
+	// follow 编译后的跟进规则列表。
+	follow []*compiledFollow
+}
+
+// compiledField 编译后的字段规则。
+type compiledField struct {
+	FieldRule
+	// steps 编译后的后处理步骤列表。
+	steps []compiledStep
+}
+
+// compiledStep 编译后的后处理步骤。
+type compiledStep struct {
+	ProcessStep
+	// re 编译后的正则表达式。
+	re *regexp.Regexp
+}
+
+// compiledFollow 编译后的跟进规则。
+type compiledFollow struct {
+	FollowRule
+	// urlPatterns 链接的正则表达式列表。
+	urlPatterns []*regexp.Regexp
+}
+
+// compileRule 编译一条抽取规则。
+func compileRule(rule Rule) (*compiledRule, error) {
+	urlPatterns, err := compilePatterns(rule.URLPatterns)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Scope != "" {
+		if err := checkSelector(rule.Scope); err != nil {
+			return nil, err
+		}
+	}
+	compiled := &compiledRule{
+		name:        rule.Name,
+		urlPatterns: urlPatterns,
+		scope:       rule.Scope,
+		required:    rule.Required,
+	}
+	fieldNames := map[string]struct{}{}
+	for i, field := range rule.Fields {
+		if field.Name == "" {
+			return nil, fmt.Errorf("empty name of field[%d]", i)
+		}
+		if field.Name == ITEM_KEY_URL || field.Name == ITEM_KEY_RULE {
+			return nil, fmt.Errorf("reserved field name: %q", field.Name)
+		}
+		if _, ok := fieldNames[field.Name]; ok {
+			return nil, fmt.Errorf("duplicate field name: %q", field.Name)
+		}
+		fieldNames[field.Name] = struct{}{}
+		if field.Selector != "" {
+			if err := checkSelector(field.Selector); err != nil {
+				return nil, err
+			}
+		}
+		compiledField := &compiledField{FieldRule: field}
+		for j, step := range field.Process {
+			compiledStep, err := compileStep(step, j == len(field.Process)-1)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %s", field.Name, err)
+			}
+			compiledField.steps = append(compiledField.steps, compiledStep)
+		}
+		compiled.fields = append(compiled.fields, compiledField)
+	}
+	for _, name := range rule.Required {
+		if _, ok := fieldNames[name]; !ok {
+			return nil, fmt.Errorf("unknown required field: %q", name)
+		}
+	}
+	for i, follow := range rule.Follow {
+		if follow.Selector == "" {
+			return nil, fmt.Errorf("empty selector of follow[%d]", i)
+		}
+		if err := checkSelector(follow.Selector); err != nil {
+			return nil, err
+		}
+		patterns, err := compilePatterns(follow.URLPatterns)
+		if err != nil {
+			return nil, err
+		}
+		if follow.Attr == "" {
+			follow.Attr = "href"
+		}
+		compiled.follow = append(compiled.follow, &compiledFollow{FollowRule: follow, urlPatterns: patterns})
+	}
+	return compiled, nil
+}
+
+// compilePatterns 编译正则表达式列表。
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("illegal URL pattern %q: %s", pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// checkSelector 检查CSS选择器的有效性。
+func checkSelector(selector string) error {
+	if _, err := cascadia.Compile(selector); err != nil {
+		return fmt.Errorf("illegal selector %q: %s", selector, err)
+	}
+	return nil
+}
+
+// compileStep 编译一个后处理步骤。
+// 参数last 是否为最后一步。
+func compileStep(step ProcessStep, last bool) (compiledStep, error) {
+	compiled := compiledStep{ProcessStep: step}
+	switch step.Op {
+	case PROCESS_TRIM, PROCESS_SQUASH, PROCESS_LOWER, PROCESS_UPPER,
+		PROCESS_ABS_URL, PROCESS_DEFAULT:
+	case PROCESS_REGEX, PROCESS_REPLACE:
+		re, err := regexp.Compile(step.Pattern)
+		if err != nil {
+			return compiled, fmt.Errorf("illegal %s pattern %q: %s", step.Op, step.Pattern, err)
+		}
+		compiled.re = re
+	case PROCESS_INT, PROCESS_FLOAT:
+		if !last {
+			return compiled, fmt.Errorf("%q must be the last step", step.Op)
+		}
+	default:
+		return compiled, fmt.Errorf("unknown process op: %q", step.Op)
+	}
+	return compiled, nil
+}
+
+// parse 按照规则解析响应。
+// 只解析状态码为2xx且内容类型为HTML的响应，其他响应会被忽略。
+func (rule *compiledRule) parse(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+	if httpResp == nil {
+		return nil, []error{fmt.Errorf("nil HTTP response")}
+	}
+	httpReq := httpResp.Request
+	if httpReq == nil || httpReq.URL == nil {
+		return nil, []error{fmt.Errorf("nil HTTP request")}
+	}
+	reqURL := httpReq.URL
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 || httpResp.Body == nil {
+		return nil, nil
+	}
+	if !isHTML(httpResp.Header.Get("Content-Type")) || !rule.applies(reqURL) {
+		return nil, nil
+	}
+	doc, err := goquery.NewDocumentFromReader(httpResp.Body)
+	if err != nil {
+		return nil, []error{fmt.Errorf("couldn't parse HTML (rule: %s, URL: %s): %s", rule.name, reqURL, err)}
+	}
+	// 相对链接以页面中的base元素（没有时即为页面URL）为基准来解析。
+	baseURL := link.BaseURL(doc, reqURL)
+	dataList := []module.Data{}
+	var errs []error
+	if len(rule.fields) > 0 {
+		scopes := doc.Selection
+		if rule.scope != "" {
+			scopes = doc.Find(rule.scope)
+		}
+		scopes.Each(func(index int, sel *goquery.Selection) {
+			if item := rule.extract(sel, reqURL, baseURL); item != nil {
+				dataList = append(dataList, item)
+			}
+		})
+	}
+	for _, follow := range rule.follow {
+		doc.Find(follow.Selector).Each(func(index int, sel *goquery.Selection) {
+			href, ok := sel.Attr(follow.Attr)
+			if !ok {
+				return
+			}
+			linkURL := link.Resolve(baseURL, href)
+			if linkURL == nil || !matchAny(follow.urlPatterns, linkURL.String()) {
+				return
+			}
+			httpReq, err := http.NewRequest("GET", linkURL.String(), nil)
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			req := module.NewRequest(httpReq, respDepth)
+			req.SetPriority(follow.Priority)
+			dataList = append(dataList, req)
+		})
+	}
+	return dataList, errs
+}
+
+// applies 判断规则是否适用于给定的页面URL。
+func (rule *compiledRule) applies(pageURL *url.URL) bool {
+	return len(rule.urlPatterns) == 0 || matchAny(rule.urlPatterns, pageURL.String())
+}
+
+// extract 从给定的元素中抽取一个条目。缺少必需的字段时返回nil。
+// 参数baseURL 解析相对链接时使用的基准URL。
+func (rule *compiledRule) extract(scope *goquery.Selection, pageURL, baseURL *url.URL) module.Item {
+	item := module.Item{
+		ITEM_KEY_URL:  pageURL.String(),
+		ITEM_KEY_RULE: rule.name,
+	}
+	for _, field := range rule.fields {
+		sel := scope
+		if field.Selector != "" {
+			sel = scope.Find(field.Selector)
+		}
+		if field.Multiple {
+			values := []interface{}{}
+			sel.Each(func(index int, s *goquery.Selection) {
+				if value, ok := field.value(s, baseURL); ok {
+					values = append(values, value)
+				}
+			})
+			item[field.Name] = values
+			continue
+		}
+		value, _ := field.value(sel.First(), baseURL)
+		item[field.Name] = value
+	}
+	for _, name := range rule.required {
+		if isEmpty(item[name]) {
+			return nil
+		}
+	}
+	return item
+}
+
+// value 获取给定元素的字段值并执行后处理。
+// 元素不存在或者没有相应的属性时，第二个结果值为false。
+func (field *compiledField) value(sel *goquery.Selection, baseURL *url.URL) (interface{}, bool) {
+	var raw string
+	found := sel.Length() > 0
+	if found {
+		switch {
+		case field.Attr != "":
+			raw, found = sel.Attr(field.Attr)
+		case field.HTML:
+			raw, _ = sel.Html()
+		default:
+			raw = sel.Text()
+		}
+	}
+	var value interface{} = raw
+	for _, step := range field.steps {
+		value = step.apply(value.(string), baseURL)
+	}
+	if !found {
+		// 默认值（以及对其的后续处理）仍然适用于不存在的元素。
+		if isEmpty(value) {
+			return nil, false
+		}
+		return value, true
+	}
+	return value, true
+}
+
+// apply 执行后处理步骤。
+// 参数baseURL 解析相对链接时使用的基准URL。
+func (step compiledStep) apply(s string, baseURL *url.URL) interface{} {
+	switch step.Op {
+	case PROCESS_TRIM:
+		return strings.TrimSpace(s)
+	case PROCESS_SQUASH:
+		return strings.Join(strings.Fields(s), " ")
+	case PROCESS_LOWER:
+		return strings.ToLower(s)
+	case PROCESS_UPPER:
+		return strings.ToUpper(s)
+	case PROCESS_ABS_URL:
+		if u := link.Resolve(baseURL, s); u != nil {
+			return u.String()
+		}
+		return ""
+	case PROCESS_REGEX:
+		match := step.re.FindStringSubmatch(s)
+		switch {
+		case match == nil:
+			return ""
+		case len(match) > 1:
+			return match[1]
+		default:
+			return match[0]
+		}
+	case PROCESS_REPLACE:
+		return step.re.ReplaceAllString(s, step.Value)
+	case PROCESS_DEFAULT:
+		if s == "" {
+			return step.Value
+		}
+		return s
+	case PROCESS_INT:
+		n, err := strconv.ParseInt(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 10, 64)
+		if err != nil {
+			return nil
+		}
+		return n
+	case PROCESS_FLOAT:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 64)
+		if err != nil {
+			return nil
+		}
+		return f
+	}
+	return s
+}
+
+// matchAny 判断给定的字符串是否匹配其中任意一个正则表达式。列表为空时视为匹配。
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTML 判断给定的内容类型是否为HTML。
+func isHTML(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.HasPrefix(contentType, "text/html") ||
+		strings.HasPrefix(contentType, "application/xhtml+xml")
+}
+
+// isEmpty 判断字段值是否为空。
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
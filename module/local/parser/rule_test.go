@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"BeanGithub/crawler/module"
+	"strings"
+	"testing"
+)
+
+func TestCompileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		rule Rule
+		want string
+	}{
+		{"empty name", Rule{}, "empty name of rule[0]"},
+		{"url pattern", Rule{Name: "r", URLPatterns: []string{"("}}, "illegal URL pattern"},
+		{"scope", Rule{Name: "r", Scope: "div["}, "illegal selector"},
+		{"field name", Rule{Name: "r", Fields: []FieldRule{{}}}, "empty name of field[0]"},
+		{"reserved field", Rule{Name: "r", Fields: []FieldRule{{Name: ITEM_KEY_URL}}}, "reserved field name"},
+		{"duplicate field", Rule{Name: "r", Fields: []FieldRule{{Name: "a"}, {Name: "a"}}}, "duplicate field name"},
+		{"field selector", Rule{Name: "r", Fields: []FieldRule{{Name: "a", Selector: ">>"}}}, "illegal selector"},
+		{"unknown op", Rule{Name: "r", Fields: []FieldRule{{Name: "a",
+			Process: []ProcessStep{{Op: "strip"}}}}}, "unknown process op"},
+		{"regex pattern", Rule{Name: "r", Fields: []FieldRule{{Name: "a",
+			Process: []ProcessStep{{Op: PROCESS_REGEX, Pattern: "["}}}}}, "illegal regex pattern"},
+		{"int not last", Rule{Name: "r", Fields: []FieldRule{{Name: "a",
+			Process: []ProcessStep{{Op: PROCESS_INT}, {Op: PROCESS_TRIM}}}}}, "must be the last step"},
+		{"unknown required", Rule{Name: "r", Fields: []FieldRule{{Name: "a"}}, Required: []string{"b"}},
+			"unknown required field"},
+		{"follow selector", Rule{Name: "r", Follow: []FollowRule{{}}}, "empty selector of follow[0]"},
+		{"follow pattern", Rule{Name: "r", Follow: []FollowRule{{Selector: "a", URLPatterns: []string{"*"}}}},
+			"illegal URL pattern"},
+	} {
+		_, err := Compile(RuleSet{Rules: []Rule{tc.rule}})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error %v, want %q", tc.name, err, tc.want)
+		}
+	}
+	if _, err := Compile(RuleSet{}); err == nil {
+		t.Errorf("empty rule set: no error")
+	}
+	dup := RuleSet{Rules: []Rule{{Name: "r"}, {Name: "r"}}}
+	if _, err := Compile(dup); err == nil || !strings.Contains(err.Error(), "duplicate rule name") {
+		t.Errorf("duplicate rule: error %v", err)
+	}
+}
+
+// parseWithRule 编译给定的规则并用它解析给定的HTML页面。
+func parseWithRule(t *testing.T, rule Rule, rawURL, html string) []module.Data {
+	parsers, err := Compile(RuleSet{Rules: []Rule{rule}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataList, errs := parsers[0](newTestResponse(rawURL, "text/html; charset=utf-8", []byte(html)), 1)
+	if len(errs) > 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+	return dataList
+}
+
+func TestRuleFields(t *testing.T) {
+	rule := Rule{
+		Name:  "product",
+		Scope: "div.product",
+		Fields: []FieldRule{
+			{Name: "title", Selector: "h2", Process: []ProcessStep{{Op: PROCESS_SQUASH}}},
+			{Name: "sku", Selector: ".sku", Process: []ProcessStep{
+				{Op: PROCESS_REGEX, Pattern: `SKU:\s*(\w+)`}, {Op: PROCESS_LOWER}}},
+			{Name: "stock", Selector: ".stock", Process: []ProcessStep{
+				{Op: PROCESS_DEFAULT, Value: "0"}, {Op: PROCESS_INT}}},
+			{Name: "price", Selector: ".price", Process: []ProcessStep{
+				{Op: PROCESS_REPLACE, Pattern: `[^\d.,]`}, {Op: PROCESS_FLOAT}}},
+			{Name: "image", Selector: "img", Attr: "src", Process: []ProcessStep{{Op: PROCESS_ABS_URL}}},
+			{Name: "tags", Selector: ".tag", Multiple: true, Process: []ProcessStep{{Op: PROCESS_UPPER}}},
+		},
+		Required: []string{"title"},
+	}
+	html := `<html><head><base href="/static/"></head><body>
+<div class="product"><h2>  Blue
+  Shirt </h2><span class="sku">SKU: AB12</span><span class="price">$1,299.50</span>
+<img src="img/1.png#x"><i class="tag">a</i><i class="tag">b</i></div>
+<div class="product"><h2>Red Hat</h2><span class="stock">1,024</span><span class="price">n/a</span></div>
+<div class="product"><span class="sku">SKU: none</span></div>
+</body></html>`
+	dataList := parseWithRule(t, rule, "https://shop.com/list/1", html)
+	if len(dataList) != 2 {
+		t.Fatalf("got %d data, want 2: %v", len(dataList), dataList)
+	}
+	first := dataList[0].(module.Item)
+	for key, want := range map[string]interface{}{
+		ITEM_KEY_URL:  "https://shop.com/list/1",
+		ITEM_KEY_RULE: "product",
+		"title":       "Blue Shirt",
+		"sku":         "ab12",
+		"stock":       int64(0),
+		"price":       1299.5,
+		"image":       "https://shop.com/static/img/1.png",
+	} {
+		if first[key] != want {
+			t.Errorf("first item %s: %#v, want %#v", key, first[key], want)
+		}
+	}
+	if tags, _ := first["tags"].([]interface{}); len(tags) != 2 || tags[0] != "A" || tags[1] != "B" {
+		t.Errorf("first item tags: %#v", first["tags"])
+	}
+	second := dataList[1].(module.Item)
+	for key, want := range map[string]interface{}{
+		"title": "Red Hat",
+		"sku":   nil,
+		"stock": int64(1024),
+		"price": nil,
+		"image": nil,
+	} {
+		if second[key] != want {
+			t.Errorf("second item %s: %#v, want %#v", key, second[key], want)
+		}
+	}
+	if tags, _ := second["tags"].([]interface{}); len(tags) != 0 {
+		t.Errorf("second item tags: %#v", second["tags"])
+	}
+}
+
+func TestRuleFollow(t *testing.T) {
+	rule := Rule{
+		Name:        "list",
+		URLPatterns: []string{`/list/`},
+		Follow: []FollowRule{
+			{Selector: "a.next", Priority: 2},
+			{Selector: "a.item", URLPatterns: []string{`/item/\d+$`}},
+			{Selector: "div[data-url]", Attr: "data-url"},
+		},
+	}
+	html := `<html><head><base href="https://cdn.shop.com/base/"></head><body>
+<a class="next" href="/list/2#top">next</a>
+<a class="item" href="../item/1">1</a><a class="item" href="item/x">x</a>
+<a class="item" href="javascript:void(0)">js</a><a class="item" href="#">anchor</a>
+<div data-url="https://other.com/page"></div><div></div>
+</body></html>`
+	dataList := parseWithRule(t, rule, "https://shop.com/list/1", html)
+	want := []struct {
+		url      string
+		priority float64
+	}{
+		{"https://cdn.shop.com/list/2", 2},
+		{"https://cdn.shop.com/item/1", 0},
+		{"https://other.com/page", 0},
+	}
+	if len(dataList) != len(want) {
+		t.Fatalf("got %d data, want %d: %v", len(dataList), len(want), dataList)
+	}
+	for i, w := range want {
+		req, ok := dataList[i].(*module.Request)
+		if !ok {
+			t.Fatalf("data[%d] is %T, want *module.Request", i, dataList[i])
+		}
+		if got := req.HTTPReq().URL.String(); got != w.url {
+			t.Errorf("request[%d] URL %s, want %s", i, got, w.url)
+		}
+		if req.Priority() != w.priority {
+			t.Errorf("request[%d] priority %v, want %v", i, req.Priority(), w.priority)
+		}
+		if req.Depth() != 1 {
+			t.Errorf("request[%d] depth %d, want 1", i, req.Depth())
+		}
+	}
+	if dataList := parseWithRule(t, rule, "https://shop.com/item/1", html); len(dataList) != 0 {
+		t.Errorf("rule applied to a page not matching its URL patterns: %v", dataList)
+	}
+}
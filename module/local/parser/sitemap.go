@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/link"
+	"BeanGithub/crawler/toolkit/sitemap"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// SitemapOptions 站点地图解析函数的可选项。
+type SitemapOptions struct {
+	// URLPatterns 页面URL的正则表达式列表，匹配其中之一才会生成请求。为空时不做限制。
+	// 子站点地图的URL不受其限制。
+	URLPatterns []string `json:"url_patterns,omitempty"`
+	// ModifiedSince 只为在此时间之后修改过的页面生成请求。为零值时不做限制。
+	// 未声明最后修改时间的页面总会生成请求。
+	ModifiedSince time.Time `json:"modified_since,omitempty"`
+}
+
+// ParseSitemap 使用默认选项解析站点地图的响应解析函数。
+var ParseSitemap = mustSitemapParser(SitemapOptions{})
+
+// NewSitemapParser 创建一个站点地图的响应解析函数。
+// 该函数会为站点地图中的每个页面生成一个请求，并带有站点地图中声明的优先级和最后修改时间；
+// 对于站点地图索引，则会为其中的每个子站点地图生成一个请求，以便继续由该函数解析。
+// 不是站点地图的响应会被忽略，因此可以与其他解析函数一起使用。
+func NewSitemapParser(opts SitemapOptions) (module.ParseResponse, error) {
+	urlPatterns, err := compilePatterns(opts.URLPatterns)
+	if err != nil {
+		return nil, err
+	}
+	sp := &sitemapParser{
+		urlPatterns:   urlPatterns,
+		modifiedSince: opts.ModifiedSince,
+	}
+	return sp.parse, nil
+}
+
+// mustSitemapParser 创建一个站点地图的响应解析函数。创建失败时会引发运行时恐慌。
+func mustSitemapParser(opts SitemapOptions) module.ParseResponse {
+	parse, err := NewSitemapParser(opts)
+	if err != nil {
+		panic(err)
+	}
+	return parse
+}
+
+// sitemapParser 站点地图的解析器。
+type sitemapParser struct {
+	// urlPatterns 页面URL的正则表达式列表。
+	urlPatterns []*regexp.Regexp
+	// modifiedSince 页面的最早的最后修改时间。
+	modifiedSince time.Time
+}
+
+// parse 解析站点地图的响应。只解析状态码为2xx的响应。
+func (sp *sitemapParser) parse(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+	if httpResp == nil {
+		return nil, []error{fmt.Errorf("nil HTTP response")}
+	}
+	httpReq := httpResp.Request
+	if httpReq == nil || httpReq.URL == nil {
+		return nil, []error{fmt.Errorf("nil HTTP request")}
+	}
+	reqURL := httpReq.URL
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 || httpResp.Body == nil {
+		return nil, nil
+	}
+	parse := sitemap.Parse
+	if isUTF8(httpResp.Header.Get("Content-Type")) {
+		parse = sitemap.ParseUTF8
+	}
+	parsed, err := parse(httpResp.Body)
+	if err == sitemap.ErrNotSitemap {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, []error{fmt.Errorf("couldn't parse sitemap (URL: %s): %s", reqURL, err)}
+	}
+	dataList := []module.Data{}
+	var errs []error
+	for _, entry := range parsed.Entries {
+		linkURL := link.Resolve(reqURL, entry.Loc)
+		if linkURL == nil {
+			continue
+		}
+		if !parsed.Index {
+			if !matchAny(sp.urlPatterns, linkURL.String()) {
+				continue
+			}
+			if !sp.modifiedSince.IsZero() && !entry.LastMod.IsZero() &&
+				!entry.LastMod.After(sp.modifiedSince) {
+				continue
+			}
+		}
+		httpReq, err := http.NewRequest("GET", linkURL.String(), nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		req := module.NewRequest(httpReq, respDepth)
+		req.SetPriority(entry.Priority)
+		req.SetLastModified(entry.LastMod)
+		dataList = append(dataList, req)
+	}
+	return dataList, errs
+}
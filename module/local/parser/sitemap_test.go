@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"BeanGithub/crawler/module"
+	"testing"
+	"time"
+)
+
+func TestSitemapParser(t *testing.T) {
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://a.com/x</loc><lastmod>2024-01-01</lastmod><priority>0.9</priority></url>
+<url><loc>https://a.com/old</loc><lastmod>2020-01-01</lastmod></url>
+<url><loc>/rel</loc></url>
+</urlset>`
+	parse, err := NewSitemapParser(SitemapOptions{ModifiedSince: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataList, errs := parse(newTestResponse("https://a.com/sitemap.xml", "application/xml", []byte(body)), 0)
+	if len(errs) > 0 || len(dataList) != 2 {
+		t.Fatalf("data: %v, errors: %v", dataList, errs)
+	}
+	req := dataList[0].(*module.Request)
+	if req.Priority() != 0.9 || req.LastModified().Year() != 2024 {
+		t.Errorf("unexpected request: priority %v, last modified %v", req.Priority(), req.LastModified())
+	}
+	if u := dataList[1].(*module.Request).HTTPReq().URL.String(); u != "https://a.com/rel" {
+		t.Errorf("relative URL resolved to %s", u)
+	}
+}
+
+func TestSitemapParserIgnoresOthers(t *testing.T) {
+	dataList, errs := ParseSitemap(newTestResponse("https://a.com/", "text/html", []byte("<html><body>hi</body></html>")), 0)
+	if dataList != nil || errs != nil {
+		t.Fatalf("data: %v, errors: %v", dataList, errs)
+	}
+}
+
+func TestSitemapParserTranscoded(t *testing.T) {
+	body := `<?xml version="1.0" encoding="gbk"?><urlset><url><loc>https://a.com/中文</loc></url></urlset>`
+	dataList, errs := ParseSitemap(newTestResponse("https://a.com/sitemap.xml", "text/xml; charset=utf-8", []byte(body)), 0)
+	if len(errs) > 0 || len(dataList) != 1 {
+		t.Fatalf("data: %v, errors: %v", dataList, errs)
+	}
+	if u := dataList[0].(*module.Request).HTTPReq().URL.Path; u != "/中文" {
+		t.Fatalf("path %q", u)
+	}
+}
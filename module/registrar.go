@@ -15,6 +15,10 @@ type Registrar interface {
 	// Get 获取一个指定类型的组件实例。
 	// 基于负载均衡策略返回实例。
 	Get(moduleType Type) (Module, error)
+	// GetBy 在指定类型的组件实例中，获取一个能够通过给定过滤函数的实例。
+	// 基于负载均衡策略返回实例。参数filter为nil时等同于Get。
+	// 没有实例能够通过过滤函数时，两个结果值都为nil。
+	GetBy(moduleType Type, filter func(module Module) bool) (Module, error)
 	// GetAllByType 获取指定类型的所有组件实例。
 	GetAllByType(moduleType Type) (map[MID]Module, error)
 	// GetAll 获取所有组件实例。
@@ -85,6 +89,10 @@ func (registrar *myRegistrar) Unregister(mid MID) (bool, error) {
 }
 
 func (registrar *myRegistrar) Get(moduleType Type) (Module, error) {
+	return registrar.GetBy(moduleType, nil)
+}
+
+func (registrar *myRegistrar) GetBy(moduleType Type, filter func(module Module) bool) (Module, error) {
 	modules, err := registrar.GetAllByType(moduleType)
 	if err != nil {
 		return nil, err
@@ -92,6 +100,9 @@ func (registrar *myRegistrar) Get(moduleType Type) (Module, error) {
 	minScore := uint64(0)
 	var selectedModule Module
 	for _, module := range modules {
+		if filter != nil && !filter(module) {
+			continue
+		}
 		SetScore(module)
 		if err != nil {
 			return nil, err
@@ -2,6 +2,13 @@ package scheduler
 
 import (
 	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/canonicalizer"
+	"BeanGithub/crawler/toolkit/seenset"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
 )
 
 // Args 参数容器的接口类型。
@@ -19,6 +26,35 @@ type RequestArgs struct {
 	// MaxDepth 需要被爬取的最大深度。
 	// 实际深度大于此值的请求都会被忽略。
 	MaxDepth uint32 `json:"max_depth"`
+	// Canonical URL规范化相关的参数。
+	// URL会在去重和放入请求缓冲池之前被规范化。
+	Canonical CanonicalArgs `json:"canonical"`
+	// Strategy 爬取策略。为空时等同于先进先出。
+	Strategy CrawlStrategy `json:"strategy,omitempty"`
+	// ScoreRequest 最佳优先策略使用的请求得分计算函数。
+	// 为nil时以请求优先级作为得分。
+	ScoreRequest ScoreRequest `json:"-"`
+	// Politeness 礼貌爬取相关的参数。
+	Politeness PolitenessArgs `json:"politeness"`
+	// Robots robots.txt相关的参数。
+	Robots RobotsArgs `json:"robots"`
+	// Sitemap 站点地图相关的参数。
+	Sitemap SitemapArgs `json:"sitemap"`
+	// AutoStop 是否在爬取流程完成时自动停止调度器。
+	AutoStop bool `json:"auto_stop"`
+	// Budget 爬取预算相关的参数。
+	Budget BudgetArgs `json:"budget"`
+	// Retry 下载重试相关的参数。
+	Retry RetryArgs `json:"retry"`
+	// Session 会话相关的参数。
+	Session SessionArgs `json:"session"`
+	// RecordRedirects 是否把每次重定向作为条目放入条目缓冲池。
+	// 条目中包含重定向之前和之后的URL、状态码以及请求的深度。
+	RecordRedirects bool `json:"record_redirects"`
+	// DownloadTimeout 每次下载的超时时间。为0时不限制。
+	// 超时时间从开始下载时计算，到响应体被关闭时为止，即包括解析时读取响应体的时间。
+	// 超时的下载会以errors.TimeoutError的形式报告，并且可以被重试。
+	DownloadTimeout time.Duration `json:"download_timeout,omitempty"`
 }
 
 // Check 检查请求参数的有效性。
@@ -26,6 +62,271 @@ func (args *RequestArgs) Check() error {
 	if args.AcceptedDomains == nil {
 		return genError("nil accepted primary domain list")
 	}
+	if !legalStrategy(args.Strategy) {
+		return genError(fmt.Sprintf("illegal crawl strategy: %q", args.Strategy))
+	}
+	if err := args.Politeness.Check(); err != nil {
+		return err
+	}
+	if err := args.Budget.Check(); err != nil {
+		return err
+	}
+	if err := args.Retry.Check(); err != nil {
+		return err
+	}
+	if err := args.Session.Check(); err != nil {
+		return err
+	}
+	if args.DownloadTimeout < 0 {
+		return genError(fmt.Sprintf("negative download timeout: %s", args.DownloadTimeout))
+	}
+	return nil
+}
+
+// CanonicalArgs URL规范化相关的参数容器类型。
+// 默认会把协议和主机转为小写、去除默认端口和片段、
+// 清理路径中的“.”和“..”、去除跟踪参数并对查询参数排序。
+type CanonicalArgs struct {
+	// Disabled 是否禁用URL规范化。
+	Disabled bool `json:"disabled"`
+	// Rules URL规范化的规则。
+	canonicalizer.Rules
+}
+
+// RobotsArgs robots.txt相关的参数容器类型。
+type RobotsArgs struct {
+	// Enabled 是否遵守robots.txt。
+	Enabled bool `json:"enabled"`
+	// UserAgent 匹配robots.txt规则组时使用的用户代理，
+	// 同时也是获取robots.txt时使用的User-Agent头。
+	UserAgent string `json:"user_agent"`
+	// CacheTTL robots.txt缓存的有效期。为0时使用默认值（24小时）。
+	CacheTTL time.Duration `json:"cache_ttl"`
+	// IgnoreCrawlDelay 是否忽略robots.txt中声明的Crawl-delay。
+	IgnoreCrawlDelay bool `json:"ignore_crawl_delay"`
+}
+
+// SitemapArgs 站点地图相关的参数容器类型。
+type SitemapArgs struct {
+	// Discover 是否在启动时发现站点地图，并把其中的页面作为深度为0的初始请求。
+	// 站点地图来自首次请求所在站点的robots.txt中的声明以及/sitemap.xml。
+	// 从检查点恢复时不会再次发现。
+	Discover bool `json:"discover"`
+	// MaxSitemaps 最多获取的站点地图（包括站点地图索引）的数量。为0时使用默认值（100个）。
+	MaxSitemaps uint32 `json:"max_sitemaps,omitempty"`
+	// MaxURLs 最多从站点地图中放入的初始请求的数量。为0时不限制。
+	MaxURLs uint64 `json:"max_urls,omitempty"`
+}
+
+// BudgetArgs 爬取预算相关的参数容器类型。
+// 各个字段为0时表示不做相应的限制。
+type BudgetArgs struct {
+	// MaxRequests 可以被接受的请求的最大数量。
+	MaxRequests uint64 `json:"max_requests,omitempty"`
+	// MaxBytes 可以下载的响应体的最大总字节数。
+	MaxBytes uint64 `json:"max_bytes,omitempty"`
+	// MaxDuration 爬取的最长时长，从调度器启动时开始计算。
+	MaxDuration time.Duration `json:"max_duration,omitempty"`
+	// MaxPagesPerDomain 每个主域名下可以被接受的请求的最大数量。
+	// 某个主域名的预算耗尽后只会忽略该主域名下的请求。
+	MaxPagesPerDomain uint64 `json:"max_pages_per_domain,omitempty"`
+	// StopOnExhausted 是否在预算耗尽时停止调度器。
+	// 字节数或时长预算耗尽时会立即停止调度器。
+	// 请求数预算耗尽时只会停止接受新的请求，并在处理完已接受的请求后停止调度器。
+	// 为false时预算耗尽只会停止接受新的请求或停止下载，调度器会自然完成。
+	StopOnExhausted bool `json:"stop_on_exhausted"`
+}
+
+// Check 检查爬取预算参数的有效性。
+func (args *BudgetArgs) Check() error {
+	if args.MaxDuration < 0 {
+		return genError(fmt.Sprintf("negative max duration: %s", args.MaxDuration))
+	}
+	return nil
+}
+
+// RetryArgs 下载重试相关的参数容器类型。
+// 只有暂时性的失败才会被重试，包括超时、连接被重置、429以及5xx状态码。
+// 第n次重试之前的等待时长为BaseDelay*2^(n-1)，不超过MaxDelay，
+// 然后按照Jitter随机缩短，但不会短于服务端通过Retry-After头要求的时长。
+type RetryArgs struct {
+	// MaxAttempts 每个请求最多的下载尝试次数（包括首次下载）。
+	// 为0或1时不会重试。
+	MaxAttempts uint32 `json:"max_attempts"`
+	// BaseDelay 首次重试之前的等待时长。为0时使用默认值（1秒）。
+	BaseDelay time.Duration `json:"base_delay"`
+	// MaxDelay 重试之前的最长等待时长。为0时使用默认值（1分钟）。
+	// 服务端要求的等待时长超过此值时不会重试。
+	MaxDelay time.Duration `json:"max_delay"`
+	// Jitter 抖动系数，取值范围为[0, 1]。
+	// 等待时长会被随机缩短，最多缩短至原来的(1-Jitter)倍。
+	Jitter float64 `json:"jitter"`
+}
+
+// Check 检查下载重试参数的有效性。
+func (args *RetryArgs) Check() error {
+	if args.BaseDelay < 0 {
+		return genError(fmt.Sprintf("negative retry base delay: %s", args.BaseDelay))
+	}
+	if args.MaxDelay < 0 {
+		return genError(fmt.Sprintf("negative retry max delay: %s", args.MaxDelay))
+	}
+	if args.Jitter < 0 || args.Jitter > 1 {
+		return genError(fmt.Sprintf("illegal retry jitter: %f", args.Jitter))
+	}
+	return nil
+}
+
+// SessionArgs 会话相关的参数容器类型。
+type SessionArgs struct {
+	// Enabled 是否启用爬取范围内的Cookie存储器。
+	// 启用后所有实现了module.CookieJarUser接口的下载器都会共享该存储器。
+	Enabled bool `json:"enabled"`
+	// Isolated 是否按主机隔离Cookie。为false时按主域名（eTLD+1）隔离。
+	Isolated bool `json:"isolated"`
+	// Login 登录相关的参数。为nil时不登录。
+	Login *LoginArgs `json:"login,omitempty"`
+}
+
+// Check 检查会话参数的有效性。
+func (args *SessionArgs) Check() error {
+	if args.Login == nil {
+		return nil
+	}
+	if !args.Enabled {
+		return genError("login requires an enabled session")
+	}
+	return args.Login.Check()
+}
+
+// LoginArgs 登录相关的参数容器类型。
+// 调度器会在放入首次请求之前执行登录请求，
+// 并在下载到符合“已登出”条件的响应时重新登录，然后重新下载相应的请求。
+type LoginArgs struct {
+	// URL 登录请求的URL。
+	URL string `json:"url"`
+	// Method 登录请求的方法。为空时使用POST。
+	Method string `json:"method,omitempty"`
+	// Header 登录请求的额外的头部。
+	Header http.Header `json:"header,omitempty"`
+	// Form 以表单形式提交的登录数据。
+	Form url.Values `json:"form,omitempty"`
+	// JSON 以JSON形式提交的登录数据。不能与Form同时设置。
+	JSON json.RawMessage `json:"json,omitempty"`
+	// LoggedOutStatus 代表已登出的响应状态码列表，例如401。
+	LoggedOutStatus []int `json:"logged_out_status,omitempty"`
+	// LoggedOutURLPrefix 代表已登出的最终URL的前缀，通常是登录页面的URL。
+	// 重定向之后的最终URL以此为前缀的响应会被视为已登出。
+	LoggedOutURLPrefix string `json:"logged_out_url_prefix,omitempty"`
+	// MaxRelogins 最多连续重新登录的次数。为0时使用默认值（3次）。
+	// 重新登录之后下载到正常的响应时会重新计数，因此会话在长时间的爬取中多次过期也不会受其限制。
+	MaxRelogins uint32 `json:"max_relogins,omitempty"`
+}
+
+// redactedValue 摘要中代替凭据的值。
+const redactedValue = "[REDACTED]"
+
+// Redacted 返回把登录数据和头部的值都替换为占位符之后的副本，
+// 用于摘要等会被输出的场合，以免泄露密码或令牌。
+func (args LoginArgs) Redacted() LoginArgs {
+	if args.Header != nil {
+		header := make(http.Header, len(args.Header))
+		for key := range args.Header {
+			header[key] = []string{redactedValue}
+		}
+		args.Header = header
+	}
+	if args.Form != nil {
+		form := make(url.Values, len(args.Form))
+		for key := range args.Form {
+			form[key] = []string{redactedValue}
+		}
+		args.Form = form
+	}
+	if args.JSON != nil {
+		args.JSON = json.RawMessage(`"` + redactedValue + `"`)
+	}
+	return args
+}
+
+// Check 检查登录参数的有效性。
+func (args *LoginArgs) Check() error {
+	loginURL, err := url.Parse(args.URL)
+	if err != nil {
+		return genError(fmt.Sprintf("illegal login URL %q: %s", args.URL, err))
+	}
+	if loginURL.Scheme != "http" && loginURL.Scheme != "https" {
+		return genError(fmt.Sprintf("illegal login URL scheme: %q", loginURL.Scheme))
+	}
+	if args.Form != nil && args.JSON != nil {
+		return genError("both form and JSON login data are set")
+	}
+	if args.JSON != nil && !json.Valid(args.JSON) {
+		return genError("illegal JSON login data")
+	}
+	return nil
+}
+
+// PolitenessRule 针对单个主机（或主域名）的礼貌爬取规则。
+// 各字段为零值时表示不做相应的限制。
+type PolitenessRule struct {
+	// MinDelay 相邻两次请求之间的最小间隔。
+	MinDelay time.Duration `json:"min_delay"`
+	// MaxInFlight 同时进行中的请求的最大数量。
+	MaxInFlight uint32 `json:"max_in_flight"`
+	// Rate 令牌桶每秒填充的令牌数，即每秒最多发出的请求数。
+	Rate float64 `json:"rate"`
+	// Burst 令牌桶的容量。为0时视为1。
+	Burst uint32 `json:"burst"`
+}
+
+// burst 获取实际生效的令牌桶容量。
+func (rule PolitenessRule) burst() uint32 {
+	if rule.Burst == 0 {
+		return 1
+	}
+	return rule.Burst
+}
+
+// Check 检查礼貌爬取规则的有效性。
+func (rule PolitenessRule) Check() error {
+	if rule.MinDelay < 0 {
+		return genError(fmt.Sprintf("negative min delay: %s", rule.MinDelay))
+	}
+	if rule.Rate < 0 {
+		return genError(fmt.Sprintf("negative rate: %f", rule.Rate))
+	}
+	return nil
+}
+
+// PolitenessArgs 礼貌爬取相关的参数容器类型。
+type PolitenessArgs struct {
+	// ByHost 是否按主机进行控制。
+	// 默认按URL的主域名进行控制。
+	ByHost bool `json:"by_host"`
+	// Default 默认的礼貌爬取规则。
+	Default PolitenessRule `json:"default"`
+	// Rules 主机或主域名与专属规则的映射。
+	// 按主机控制时，未找到主机的专属规则会再尝试其主域名的专属规则。
+	Rules map[string]PolitenessRule `json:"rules,omitempty"`
+	// MaxHosts 保留礼貌爬取状态的主机（或主域名）的最大数量。
+	// 超出时会淘汰最久未使用的空闲主机的状态。为0时使用默认值10000。
+	MaxHosts int `json:"max_hosts,omitempty"`
+}
+
+// Check 检查礼貌爬取参数的有效性。
+func (args *PolitenessArgs) Check() error {
+	if args.MaxHosts < 0 {
+		return genError("negative max politeness hosts")
+	}
+	if err := args.Default.Check(); err != nil {
+		return err
+	}
+	for _, rule := range args.Rules {
+		if err := rule.Check(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -47,6 +348,23 @@ type DataArgs struct {
 	ErrorBufferCap uint32 `json:"error_buffer_cap"`
 	// ErrorMaxBufferNumber 错误缓冲器的最大数量。
 	ErrorMaxBufferNumber uint32 `json:"error_max_buffer_number"`
+	// CheckpointPath 检查点文件的路径。
+	// 为空时不会写入检查点。
+	CheckpointPath string `json:"checkpoint_path,omitempty"`
+	// CheckpointInterval 周期性写入检查点的间隔。
+	// 为0时只在调度器停止时写入检查点。
+	CheckpointInterval time.Duration `json:"checkpoint_interval,omitempty"`
+	// SeenSet 已处理的URL的集合相关的参数。
+	SeenSet SeenSetArgs `json:"seen_set"`
+	// DeadLetterPath 死信存储文件的路径。
+	// 最终下载失败的请求会被记入其中。为空时不记录死信。
+	DeadLetterPath string `json:"dead_letter_path,omitempty"`
+	// DownloadWorkers 下载阶段的工作者数量。为0时只有一个工作者。
+	DownloadWorkers uint32 `json:"download_workers,omitempty"`
+	// AnalyzeWorkers 分析阶段的工作者数量。为0时只有一个工作者。
+	AnalyzeWorkers uint32 `json:"analyze_workers,omitempty"`
+	// PickWorkers 条目处理阶段的工作者数量。为0时只有一个工作者。
+	PickWorkers uint32 `json:"pick_workers,omitempty"`
 }
 
 // Check 检查数据参数的有效性。
@@ -75,9 +393,61 @@ func (args *DataArgs) Check() error {
 	if args.ErrorMaxBufferNumber == 0 {
 		return genError("zero max error buffer number")
 	}
+	if args.CheckpointInterval < 0 {
+		return genError(fmt.Sprintf("negative checkpoint interval: %s", args.CheckpointInterval))
+	}
+	if err := args.SeenSet.Check(); err != nil {
+		return err
+	}
 	return nil
 }
 
+// SeenSetArgs 已处理的URL的集合相关的参数容器类型。
+type SeenSetArgs struct {
+	// Kind 集合的种类。为空时使用精确的内存集合。
+	Kind seenset.Kind `json:"kind,omitempty"`
+	// ExpectedNumber 预期的URL数量。仅用于布隆过滤器。
+	ExpectedNumber uint64 `json:"expected_number,omitempty"`
+	// FalsePositiveRate 可以容忍的误判率。仅用于布隆过滤器。
+	FalsePositiveRate float64 `json:"false_positive_rate,omitempty"`
+	// Dir 存放数据文件的目录。仅用于基于磁盘的集合。
+	Dir string `json:"dir,omitempty"`
+}
+
+// Check 检查已处理的URL的集合相关参数的有效性。
+func (args *SeenSetArgs) Check() error {
+	switch args.Kind {
+	case "", seenset.KIND_EXACT:
+	case seenset.KIND_BLOOM:
+		if args.ExpectedNumber == 0 {
+			return genError("zero expected URL number for bloom filter")
+		}
+		if args.FalsePositiveRate <= 0 || args.FalsePositiveRate >= 1 {
+			return genError(fmt.Sprintf("illegal false positive rate for bloom filter: %f",
+				args.FalsePositiveRate))
+		}
+	case seenset.KIND_DISK:
+		if args.Dir == "" {
+			return genError("empty directory for disk seen URL set")
+		}
+	default:
+		return genError(fmt.Sprintf("illegal seen URL set kind: %q", args.Kind))
+	}
+	return nil
+}
+
+// newSeenSet 按照参数创建已处理的URL的集合。
+func (args *SeenSetArgs) newSeenSet() (seenset.SeenSet, error) {
+	switch args.Kind {
+	case seenset.KIND_BLOOM:
+		return seenset.NewBloomFilter(args.ExpectedNumber, args.FalsePositiveRate)
+	case seenset.KIND_DISK:
+		return seenset.NewDiskSet(args.Dir)
+	default:
+		return seenset.NewExactSet(), nil
+	}
+}
+
 // ModuleArgs 组件相关的参数容器类型。
 type ModuleArgs struct {
 	// 下载器列表。
@@ -0,0 +1,303 @@
+package scheduler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// BUDGET_REQUESTS 请求数预算。
+	BUDGET_REQUESTS = "requests"
+	// BUDGET_BYTES 响应字节数预算。
+	BUDGET_BYTES = "bytes"
+	// BUDGET_DURATION 爬取时长预算。
+	BUDGET_DURATION = "duration"
+)
+
+// BudgetSummaryStruct 爬取预算的摘要类型。
+type BudgetSummaryStruct struct {
+	// Requests 已接受的请求的数量。
+	Requests uint64 `json:"requests"`
+	// Bytes 已下载的响应体的总字节数。
+	Bytes uint64 `json:"bytes"`
+	// Elapsed 已经过的爬取时长。
+	Elapsed time.Duration `json:"elapsed"`
+	// Exhausted 已耗尽的预算的名称列表。
+	Exhausted []string `json:"exhausted"`
+	// ExhaustedDomains 预算已耗尽的主域名的列表。
+	ExhaustedDomains []string `json:"exhausted_domains"`
+}
+
+// BudgetState 爬取预算的用量的类型，会被写入检查点以便继续爬取时恢复。
+type BudgetState struct {
+	// Requests 已接受的请求的数量。
+	Requests uint64 `json:"requests"`
+	// Bytes 已下载的响应体的总字节数。
+	Bytes uint64 `json:"bytes"`
+	// Elapsed 已经过的爬取时长，不含暂停的时间。
+	Elapsed time.Duration `json:"elapsed"`
+	// DomainPages 各个主域名下已接受的请求的数量。
+	DomainPages map[string]uint64 `json:"domain_pages,omitempty"`
+}
+
+// budget 爬取预算的类型。
+type budget struct {
+	// args 爬取预算相关的参数。
+	args BudgetArgs
+	// onExhausted 各个全局预算首次耗尽时调用的函数。
+	onExhausted func(name string)
+	// requests 已接受的请求的数量。
+	requests uint64
+	// bytes 已下载的响应体的总字节数。需要以原子操作的方式访问。
+	bytes uint64
+	// elapsed 此前各段运行时间的累计时长，不含暂停的时间。
+	elapsed time.Duration
+	// runStart 本段运行开始的时间。暂停或停止时为零值。
+	runStart time.Time
+	// timer 时长预算的定时器。
+	timer *time.Timer
+	// exhausted 已耗尽的预算的集合。
+	exhausted map[string]bool
+	// domainPages 各个主域名下已接受的请求的数量。
+	domainPages map[string]uint64
+	// lock 保护以上字段（bytes除外）的互斥锁。
+	lock sync.Mutex
+}
+
+// newBudget 创建一个爬取预算。
+// 参数onExhausted 会在请求数、字节数或时长预算各自首次耗尽时被调用。
+func newBudget(args BudgetArgs, onExhausted func(name string)) *budget {
+	return &budget{
+		args:        args,
+		onExhausted: onExhausted,
+		exhausted:   map[string]bool{},
+		domainPages: map[string]uint64{},
+	}
+}
+
+// Start 开始计算爬取时长。
+// 从检查点恢复的时长会被累计在内。
+func (b *budget) Start() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.run()
+}
+
+// Stop 停止计算爬取时长。
+func (b *budget) Stop() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.halt()
+}
+
+// Pause 暂停计算爬取时长。暂停的时间不计入时长预算。
+func (b *budget) Pause() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.halt()
+}
+
+// Resume 继续计算爬取时长。
+func (b *budget) Resume() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.run()
+}
+
+// run 开始一段运行时间，并按剩余的时长预算设置定时器。调用方需持有锁。
+func (b *budget) run() {
+	if !b.runStart.IsZero() {
+		return
+	}
+	b.runStart = time.Now()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.args.MaxDuration > 0 && !b.exhausted[BUDGET_DURATION] {
+		remaining := b.args.MaxDuration - b.elapsed
+		if remaining < 0 {
+			remaining = 0
+		}
+		b.timer = time.AfterFunc(remaining, func() {
+			b.exhaust(BUDGET_DURATION)
+		})
+	}
+}
+
+// halt 结束当前的一段运行时间，并停止定时器。调用方需持有锁。
+func (b *budget) halt() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if !b.runStart.IsZero() {
+		b.elapsed += time.Since(b.runStart)
+		b.runStart = time.Time{}
+	}
+}
+
+// State 获取爬取预算的用量。
+func (b *budget) State() BudgetState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state := BudgetState{
+		Requests: b.requests,
+		Bytes:    atomic.LoadUint64(&b.bytes),
+		Elapsed:  b.elapsed,
+	}
+	if !b.runStart.IsZero() {
+		state.Elapsed += time.Since(b.runStart)
+	}
+	if len(b.domainPages) > 0 {
+		state.DomainPages = make(map[string]uint64, len(b.domainPages))
+		for domain, pages := range b.domainPages {
+			state.DomainPages[domain] = pages
+		}
+	}
+	return state
+}
+
+// Restore 用检查点中的用量恢复爬取预算。应在Start之前调用。
+// 恢复时已经耗尽的字节数或时长预算会被直接标记为已耗尽，而不会调用onExhausted。
+func (b *budget) Restore(state BudgetState) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.requests = state.Requests
+	atomic.StoreUint64(&b.bytes, state.Bytes)
+	b.elapsed = state.Elapsed
+	b.domainPages = make(map[string]uint64, len(state.DomainPages))
+	for domain, pages := range state.DomainPages {
+		b.domainPages[domain] = pages
+	}
+	if b.args.MaxBytes > 0 && state.Bytes >= b.args.MaxBytes {
+		b.exhausted[BUDGET_BYTES] = true
+	}
+	if b.args.MaxDuration > 0 && state.Elapsed >= b.args.MaxDuration {
+		b.exhausted[BUDGET_DURATION] = true
+	}
+}
+
+// Reserve 为给定主域名下的一个请求预留预算。
+// 若预算不足，则返回相应的错误值。
+// 预留的预算在请求最终未被接受时需要通过Cancel归还。
+func (b *budget) Reserve(primaryDomain string) error {
+	b.lock.Lock()
+	for _, name := range []string{BUDGET_REQUESTS, BUDGET_BYTES, BUDGET_DURATION} {
+		if b.exhausted[name] {
+			b.lock.Unlock()
+			return fmt.Errorf("the %s budget is exhausted", name)
+		}
+	}
+	if b.args.MaxRequests > 0 && b.requests >= b.args.MaxRequests {
+		b.lock.Unlock()
+		b.exhaust(BUDGET_REQUESTS)
+		return fmt.Errorf("the %s budget is exhausted", BUDGET_REQUESTS)
+	}
+	if b.args.MaxPagesPerDomain > 0 && b.domainPages[primaryDomain] >= b.args.MaxPagesPerDomain {
+		b.lock.Unlock()
+		return fmt.Errorf("the page budget of primary domain %q is exhausted", primaryDomain)
+	}
+	b.requests++
+	b.domainPages[primaryDomain]++
+	b.lock.Unlock()
+	return nil
+}
+
+// Cancel 归还为给定主域名下的一个请求预留的预算。
+func (b *budget) Cancel(primaryDomain string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.requests > 0 {
+		b.requests--
+	}
+	if b.domainPages[primaryDomain] > 0 {
+		b.domainPages[primaryDomain]--
+	}
+}
+
+// DownloadAllowed 判断是否还可以继续下载。
+// 字节数或时长预算耗尽后，已接受但尚未下载的请求也不会再被下载。
+func (b *budget) DownloadAllowed() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return !b.exhausted[BUDGET_BYTES] && !b.exhausted[BUDGET_DURATION]
+}
+
+// CountReader 包装给定的响应体，以便统计读取的字节数。
+func (b *budget) CountReader(body io.ReadCloser) io.ReadCloser {
+	return &countingReader{ReadCloser: body, budget: b}
+}
+
+// addBytes 增加已下载的字节数，并在超出预算时将其标记为已耗尽。
+func (b *budget) addBytes(n int) {
+	if n <= 0 {
+		return
+	}
+	total := atomic.AddUint64(&b.bytes, uint64(n))
+	if b.args.MaxBytes > 0 && total >= b.args.MaxBytes {
+		b.exhaust(BUDGET_BYTES)
+	}
+}
+
+// exhaust 把给定的预算标记为已耗尽。
+// 在该预算首次耗尽时会调用onExhausted。
+func (b *budget) exhaust(name string) {
+	b.lock.Lock()
+	if b.exhausted[name] {
+		b.lock.Unlock()
+		return
+	}
+	b.exhausted[name] = true
+	b.lock.Unlock()
+	fmt.Printf("The %s budget is exhausted.\n", name)
+	if b.onExhausted != nil {
+		b.onExhausted(name)
+	}
+}
+
+// Summary 获取爬取预算的摘要信息。
+func (b *budget) Summary() BudgetSummaryStruct {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	summary := BudgetSummaryStruct{
+		Requests:         b.requests,
+		Bytes:            atomic.LoadUint64(&b.bytes),
+		Exhausted:        []string{},
+		ExhaustedDomains: []string{},
+	}
+	summary.Elapsed = b.elapsed
+	if !b.runStart.IsZero() {
+		summary.Elapsed += time.Since(b.runStart)
+	}
+	for name := range b.exhausted {
+		summary.Exhausted = append(summary.Exhausted, name)
+	}
+	sort.Strings(summary.Exhausted)
+	if b.args.MaxPagesPerDomain > 0 {
+		for domain, pages := range b.domainPages {
+			if pages >= b.args.MaxPagesPerDomain {
+				summary.ExhaustedDomains = append(summary.ExhaustedDomains, domain)
+			}
+		}
+		sort.Strings(summary.ExhaustedDomains)
+	}
+	return summary
+}
+
+// countingReader 统计读取的字节数的响应体。
+type countingReader struct {
+	io.ReadCloser
+	// budget 爬取预算。
+	budget *budget
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	reader.budget.addBytes(n)
+	return n, err
+}
@@ -0,0 +1,179 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBudgetDurationPaused(t *testing.T) {
+	exhausted := make(chan string, 1)
+	b := newBudget(BudgetArgs{MaxDuration: 100 * time.Millisecond}, func(name string) {
+		exhausted <- name
+	})
+	b.Start()
+	b.Pause()
+	select {
+	case <-exhausted:
+		t.Fatal("the duration budget was exhausted while paused")
+	case <-time.After(300 * time.Millisecond):
+	}
+	if elapsed := b.Summary().Elapsed; elapsed > 50*time.Millisecond {
+		t.Fatalf("elapsed %s includes the paused time", elapsed)
+	}
+	if !b.DownloadAllowed() {
+		t.Fatal("download is not allowed")
+	}
+	b.Resume()
+	select {
+	case name := <-exhausted:
+		if name != BUDGET_DURATION {
+			t.Fatalf("%s budget exhausted", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the duration budget wasn't exhausted after resume")
+	}
+	if b.DownloadAllowed() {
+		t.Fatal("download is allowed after the duration budget is exhausted")
+	}
+	b.Stop()
+	elapsed := b.Summary().Elapsed
+	time.Sleep(20 * time.Millisecond)
+	if b.Summary().Elapsed != elapsed {
+		t.Fatal("elapsed keeps growing after stop")
+	}
+}
+
+func TestBudgetRestore(t *testing.T) {
+	exhausted := make(chan string, 3)
+	b := newBudget(BudgetArgs{MaxBytes: 10, MaxDuration: time.Hour, MaxPagesPerDomain: 2},
+		func(name string) {
+			exhausted <- name
+		})
+	b.Restore(BudgetState{
+		Requests:    3,
+		Bytes:       10,
+		Elapsed:     30 * time.Minute,
+		DomainPages: map[string]uint64{"a.com": 2, "b.com": 1},
+	})
+	b.Start()
+	defer b.Stop()
+	if b.DownloadAllowed() {
+		t.Fatal("download is allowed after restoring an exhausted byte budget")
+	}
+	if err := b.Reserve("a.com"); err == nil {
+		t.Fatal("the restored page budget of a.com was ignored")
+	}
+	state := b.State()
+	if state.Requests != 3 || state.Bytes != 10 || state.DomainPages["b.com"] != 1 {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	if state.Elapsed < 30*time.Minute {
+		t.Fatalf("elapsed %s, want at least 30m", state.Elapsed)
+	}
+	select {
+	case name := <-exhausted:
+		t.Fatalf("onExhausted was called for the restored %s budget", name)
+	default:
+	}
+}
+
+func TestBudgetRestoreDuration(t *testing.T) {
+	b := newBudget(BudgetArgs{MaxDuration: time.Second}, nil)
+	b.Restore(BudgetState{Elapsed: time.Second})
+	b.Start()
+	defer b.Stop()
+	if b.DownloadAllowed() {
+		t.Fatal("a resumed crawl got the full duration budget again")
+	}
+}
+
+func TestBudgetStopOnRequestsExhausted(t *testing.T) {
+	site := newTestSite(20)
+	defer site.Close()
+	var picked int64
+	requestArgs := RequestArgs{Budget: BudgetArgs{MaxRequests: 5, StopOnExhausted: true}}
+	sched := startTestScheduler(t, requestArgs, testDataArgs(),
+		testModules(t, &picked), site.URL+"/page/0")
+	deadline := time.Now().Add(20 * time.Second)
+	for sched.Status() != SCHED_STATUS_STOPPED {
+		if time.Now().After(deadline) {
+			t.Fatalf("status %s, want stopped", GetStatusDescription(sched.Status()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt64(&picked); n != 5 {
+		t.Fatalf("picked %d items before stopping, want 5", n)
+	}
+	summary := sched.(*myScheduler).budget.Summary()
+	if len(summary.Exhausted) != 1 || summary.Exhausted[0] != BUDGET_REQUESTS {
+		t.Fatalf("exhausted budgets %v, want [%s]", summary.Exhausted, BUDGET_REQUESTS)
+	}
+}
+
+func TestBudgetResumeFromCheckpoint(t *testing.T) {
+	site := newTestSite(20)
+	defer site.Close()
+	var picked int64
+	requestArgs := RequestArgs{Budget: BudgetArgs{MaxRequests: 8}}
+	sched := startTestScheduler(t, requestArgs, testDataArgs(),
+		testModules(t, &picked), site.URL+"/page/0")
+	waitTestScheduler(t, sched, 20*time.Second)
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := sched.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pd, _ := getPrimaryDomain(strings.TrimPrefix(site.URL, "http://"))
+	if cp.Budget == nil || cp.Budget.Requests != 8 || cp.Budget.DomainPages[pd] != 8 ||
+		cp.Budget.Bytes == 0 || cp.Budget.Elapsed == 0 {
+		t.Fatalf("unexpected budget in checkpoint: %+v", cp.Budget)
+	}
+
+	requestArgs = RequestArgs{
+		AcceptedDomains: []string{},
+		MaxDepth:        100,
+		Budget:          BudgetArgs{MaxRequests: 20, MaxPagesPerDomain: 9},
+	}
+	resumed := NewScheduler()
+	if err := resumed.Init(requestArgs, testDataArgs(), testModules(t, &picked)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resumed.Stop() })
+	go func() {
+		for range resumed.ErrorChan() {
+		}
+	}()
+	if err := resumed.StartFrom(cp); err != nil {
+		t.Fatal(err)
+	}
+	var reqs []*module.Request
+	for _, n := range []int{15, 16, 17} {
+		httpReq, _ := http.NewRequest("GET", fmt.Sprintf("%s/page/%d", site.URL, n), nil)
+		reqs = append(reqs, module.NewRequest(httpReq, 1))
+	}
+	if n, err := resumed.Inject(reqs...); err != nil || n != 1 {
+		t.Fatalf("injected %d requests (%v), want 1 within the restored page budget", n, err)
+	}
+	// 检查点中没有尚未完成的请求，恢复后的爬取流程在注入之前就已完成，因此只能等待注入的请求被处理。
+	deadline := time.Now().Add(20 * time.Second)
+	for atomic.LoadInt64(&picked) < 9 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the injected request")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	state := resumed.(*myScheduler).budget.State()
+	if state.Requests != 9 || state.DomainPages[pd] != 9 {
+		t.Fatalf("unexpected budget after resuming: %+v", state)
+	}
+	if state.Bytes <= cp.Budget.Bytes || state.Elapsed < cp.Budget.Elapsed {
+		t.Fatalf("the restored usage was reset: %+v", state)
+	}
+}
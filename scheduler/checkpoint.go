@@ -0,0 +1,294 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/seenset"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Checkpoint 调度器检查点的类型。
+// 包含了从中断处继续爬取所需的全部状态。
+type Checkpoint struct {
+	// Time 生成检查点的时间。
+	Time time.Time `json:"time"`
+	// Pending 尚未完成下载的请求列表。
+	Pending []CheckpointRequest `json:"pending"`
+	// SeenKind 已处理的URL的集合的种类。
+	SeenKind seenset.Kind `json:"seen_kind"`
+	// SeenSet 已处理的URL的集合的快照。
+	SeenSet []byte `json:"seen_set"`
+	// AcceptedDomains 可以接受的URL主域名列表。
+	AcceptedDomains []string `json:"accepted_domains"`
+	// Counts 调度器内部计数。
+	Counts CountsStruct `json:"counts"`
+	// Budget 爬取预算的用量。为nil时只按已接受的请求数恢复请求数预算。
+	Budget *BudgetState `json:"budget,omitempty"`
+}
+
+// CheckpointRequest 检查点中的请求类型。
+type CheckpointRequest struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header,omitempty"`
+	Depth    uint32      `json:"depth"`
+	Priority float64     `json:"priority,omitempty"`
+	Attempt  uint32      `json:"attempt,omitempty"`
+	// Body 请求体，在JSON中以base64编码。
+	Body []byte `json:"body,omitempty"`
+	// LastModified 请求的资源的已知的最后修改时间。
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	// Redirects 已被该请求的重定向加入已处理的URL的集合的URL。
+	Redirects []string `json:"redirects,omitempty"`
+}
+
+// newCheckpointRequest 根据给定请求创建检查点中的请求。
+// 请求头部中的凭据会被去掉。
+// 请求体无法被重新读取或者过长时返回错误，因为不带请求体的请求无法从中断处继续。
+func newCheckpointRequest(req *module.Request) (CheckpointRequest, error) {
+	httpReq := req.HTTPReq()
+	body, err := module.PersistedBody(httpReq)
+	if err != nil {
+		return CheckpointRequest{}, genError(fmt.Sprintf("couldn't save the body of %s %s: %s",
+			httpReq.Method, httpReq.URL, err))
+	}
+	cr := CheckpointRequest{
+		Method:   httpReq.Method,
+		URL:      httpReq.URL.String(),
+		Header:   module.StripCredentials(httpReq.Header),
+		Depth:    req.Depth(),
+		Priority: req.Priority(),
+		Attempt:  req.Attempt(),
+		Body:     body,
+	}
+	if lastModified := req.LastModified(); !lastModified.IsZero() {
+		cr.LastModified = &lastModified
+	}
+	return cr, nil
+}
+
+// Request 根据检查点中的请求重建请求。
+func (cr CheckpointRequest) Request() (*module.Request, error) {
+	method := cr.Method
+	if method == "" {
+		method = "GET"
+	}
+	var body io.Reader
+	if len(cr.Body) > 0 {
+		body = bytes.NewReader(cr.Body)
+	}
+	httpReq, err := http.NewRequest(method, cr.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range cr.Header {
+		httpReq.Header[key] = values
+	}
+	req := module.NewRequest(httpReq, cr.Depth).WithAttempt(cr.Attempt)
+	req.SetPriority(cr.Priority)
+	if cr.LastModified != nil {
+		req.SetLastModified(*cr.LastModified)
+	}
+	return req, nil
+}
+
+// NewCheckpoint 根据给定的请求创建一个检查点。
+// 检查点中不包含已处理的URL的集合，其中的主域名列表由请求的URL得出。
+// 可用于让新的调度器从这些请求开始爬取，例如重新爬取死信中的请求。
+func NewCheckpoint(reqs []*module.Request) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		Time:            time.Now(),
+		Pending:         []CheckpointRequest{},
+		AcceptedDomains: []string{},
+	}
+	domainMap := map[string]struct{}{}
+	for _, req := range reqs {
+		if req == nil || !req.Valid() {
+			return nil, genParameterError("invalid request")
+		}
+		pd, err := getPrimaryDomain(req.HTTPReq().URL.Host)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := domainMap[pd]; !ok {
+			domainMap[pd] = struct{}{}
+			cp.AcceptedDomains = append(cp.AcceptedDomains, pd)
+		}
+		cr, err := newCheckpointRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		cp.Pending = append(cp.Pending, cr)
+	}
+	sort.Strings(cp.AcceptedDomains)
+	return cp, nil
+}
+
+// LoadCheckpoint 从给定的文件中读取检查点。
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, genErrorByError(err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, genError(fmt.Sprintf("couldn't parse checkpoint %q: %s", path, err))
+	}
+	return &checkpoint, nil
+}
+
+// Save 把检查点写入给定的文件。
+// 会先写入同目录下的临时文件再替换，以免留下不完整的检查点。
+func (cp *Checkpoint) Save(path string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return genErrorByError(err)
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return genErrorByError(err)
+	}
+	tmpPath := tmpFile.Name()
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return genErrorByError(err)
+	}
+	return nil
+}
+
+// checkpoint 生成当前调度器的检查点。
+func (sched *myScheduler) checkpoint() (*Checkpoint, error) {
+	seenData, err := sched.urlSet.MarshalBinary()
+	if err != nil {
+		return nil, genErrorByError(err)
+	}
+	cp := &Checkpoint{
+		Time:            time.Now(),
+		Pending:         []CheckpointRequest{},
+		SeenKind:        sched.urlSet.Kind(),
+		SeenSet:         seenData,
+		AcceptedDomains: []string{},
+		Counts:          sched.counts.Struct(),
+	}
+	budgetState := sched.budget.State()
+	cp.Budget = &budgetState
+	sched.pendingReqMap.Range(func(key, value interface{}) bool {
+		cr, err := newCheckpointRequest(value.(*module.Request))
+		if err != nil {
+			// 无法完整保存的请求不会被写入检查点，以免恢复出内容不同的请求。
+			fmt.Printf("Skip a pending request in checkpoint: %s\n", err)
+			return true
+		}
+		cr.Redirects = sched.redirectClaimURLs(key.(string))
+		cp.Pending = append(cp.Pending, cr)
+		return true
+	})
+	sort.Slice(cp.Pending, func(i, j int) bool {
+		if cp.Pending[i].Depth != cp.Pending[j].Depth {
+			return cp.Pending[i].Depth < cp.Pending[j].Depth
+		}
+		return cp.Pending[i].URL < cp.Pending[j].URL
+	})
+	sched.acceptedDomainMap.Range(func(key, value interface{}) bool {
+		cp.AcceptedDomains = append(cp.AcceptedDomains, key.(string))
+		return true
+	})
+	sort.Strings(cp.AcceptedDomains)
+	return cp, nil
+}
+
+// saveCheckpoint 生成检查点并写入预设的文件。
+// 若未设置检查点文件的路径则什么也不做。
+func (sched *myScheduler) saveCheckpoint() error {
+	if sched.checkpointPath == "" {
+		return nil
+	}
+	cp, err := sched.checkpoint()
+	if err != nil {
+		return err
+	}
+	return cp.Save(sched.checkpointPath)
+}
+
+// restore 用给定的检查点恢复调度器的状态。
+// 返回检查点中尚未完成下载的请求。
+func (sched *myScheduler) restore(cp *Checkpoint) ([]*module.Request, error) {
+	for _, domain := range cp.AcceptedDomains {
+		sched.acceptedDomainMap.Store(domain, struct{}{})
+	}
+	// 由NewCheckpoint创建的检查点不包含已处理的URL的集合。
+	if cp.SeenKind != "" {
+		if cp.SeenKind != sched.urlSet.Kind() {
+			errMsg := fmt.Sprintf("mismatched seen URL set kind: %q (checkpoint) != %q",
+				cp.SeenKind, sched.urlSet.Kind())
+			return nil, genError(errMsg)
+		}
+		if err := sched.urlSet.UnmarshalBinary(cp.SeenSet); err != nil {
+			return nil, genErrorByError(err)
+		}
+	}
+	sched.counts.Restore(cp.Counts)
+	if cp.Budget != nil {
+		sched.budget.Restore(*cp.Budget)
+	} else {
+		sched.budget.Restore(BudgetState{Requests: cp.Counts.Admitted})
+	}
+	reqs := make([]*module.Request, 0, len(cp.Pending))
+	for _, cr := range cp.Pending {
+		req, err := cr.Request()
+		if err != nil {
+			return nil, genError(fmt.Sprintf("illegal pending request in checkpoint: %s", err))
+		}
+		sched.pendingReqMap.Store(req.HTTPReq().URL.String(), req)
+		if len(cr.Redirects) > 0 {
+			sched.redirectClaims.Store(req.HTTPReq().URL.String(), redirectClaim{urls: cr.Redirects})
+		}
+		if cp.SeenKind == "" {
+			if _, err := sched.urlSet.Add(req.HTTPReq().URL.String()); err != nil {
+				return nil, genErrorByError(err)
+			}
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// keepCheckpointing 按照预设的间隔周期性地写入检查点，直到调度器停止。
+func (sched *myScheduler) keepCheckpointing() {
+	if sched.checkpointPath == "" || sched.checkpointInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(sched.checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sched.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := sched.saveCheckpoint(); err != nil {
+					fmt.Printf("An error occurs when saving checkpoint: %s\n", err)
+					sendError(err, "", sched.errorBufferPool, sched.flights)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,211 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckpointRequestStripsCredentials(t *testing.T) {
+	httpReq, _ := http.NewRequest("GET", "https://a.com/x", nil)
+	httpReq.Header.Set("Cookie", "sid=1")
+	httpReq.Header.Set("Authorization", "Bearer secret")
+	httpReq.Header.Set("Proxy-Authorization", "Basic secret")
+	httpReq.Header.Set("Referer", "https://a.com/")
+	cr, err := newCheckpointRequest(module.NewRequest(httpReq, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range module.CredentialHeaders {
+		if cr.Header.Get(key) != "" {
+			t.Errorf("%s was saved", key)
+		}
+	}
+	if cr.Header.Get("Referer") != "https://a.com/" {
+		t.Errorf("Referer was dropped")
+	}
+	if httpReq.Header.Get("Cookie") == "" {
+		t.Errorf("the original request was modified")
+	}
+}
+
+func TestCheckpointRequestBody(t *testing.T) {
+	httpReq, _ := http.NewRequest("POST", "https://a.com/search", strings.NewReader("q=crawler"))
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req := module.NewRequest(httpReq, 2)
+	lastModified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	req.SetLastModified(lastModified)
+	cr, err := newCheckpointRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 请求体不会因为被写入检查点而被消耗。
+	if data, _ := ioutil.ReadAll(httpReq.Body); string(data) != "q=crawler" {
+		t.Fatalf("the original body was consumed: %q", data)
+	}
+	data, err := json.Marshal(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded CheckpointRequest
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := loaded.Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredHTTPReq := restored.HTTPReq()
+	body, _ := ioutil.ReadAll(restoredHTTPReq.Body)
+	if restoredHTTPReq.Method != "POST" || string(body) != "q=crawler" ||
+		restoredHTTPReq.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Fatalf("restored %s with body %q", restoredHTTPReq.Method, body)
+	}
+	if restoredHTTPReq.GetBody == nil {
+		t.Error("the restored body can't be replayed")
+	}
+	if !restored.LastModified().Equal(lastModified) {
+		t.Errorf("restored last modified time %s, want %s", restored.LastModified(), lastModified)
+	}
+	// 没有请求体和最后修改时间的请求不会保存它们。
+	httpReq, _ = http.NewRequest("GET", "https://a.com/", nil)
+	if cr, err := newCheckpointRequest(module.NewRequest(httpReq, 0)); err != nil || cr.Body != nil || cr.LastModified != nil {
+		t.Fatalf("unexpected checkpoint request of GET: %+v, %v", cr, err)
+	}
+}
+
+func TestCheckpointRequestUnsavableBody(t *testing.T) {
+	large := strings.Repeat("x", int(module.MaxPersistedBodySize)+1)
+	httpReq, _ := http.NewRequest("POST", "https://a.com/upload", strings.NewReader(large))
+	if _, err := newCheckpointRequest(module.NewRequest(httpReq, 0)); err == nil {
+		t.Error("a too large body was saved")
+	}
+	if _, err := NewCheckpoint([]*module.Request{module.NewRequest(httpReq, 0)}); err == nil {
+		t.Error("created a checkpoint with a too large body")
+	}
+	httpReq, _ = http.NewRequest("POST", "https://a.com/stream", nil)
+	httpReq.Body = ioutil.NopCloser(strings.NewReader("data"))
+	if _, err := newCheckpointRequest(module.NewRequest(httpReq, 0)); err == nil {
+		t.Error("a body that can't be replayed was saved")
+	}
+}
+
+func TestCheckpointKeepsUnanalyzedRequests(t *testing.T) {
+	site := newTestSite(3)
+	defer site.Close()
+	release := make(chan struct{})
+	parse := func(httpResp *http.Response, depth uint32) ([]module.Data, []error) {
+		if strings.HasSuffix(httpResp.Request.URL.Path, "/page/2") {
+			<-release
+		}
+		return testParseLinks(httpResp, depth)
+	}
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, testDataArgs(),
+		testModules(t, &picked, parse), site.URL+"/page/0")
+	ms := sched.(*myScheduler)
+	slowURL := site.URL + "/page/2"
+	pendingSlow := func() bool {
+		cp, err := ms.checkpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cr := range cp.Pending {
+			if cr.URL == slowURL {
+				return true
+			}
+		}
+		return false
+	}
+	deadline := time.Now().Add(20 * time.Second)
+	for atomic.LoadUint64(&ms.counts.downloaded) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for downloads")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !pendingSlow() {
+		t.Fatal("a downloaded but unanalyzed request was dropped from the checkpoint")
+	}
+	close(release)
+	waitTestScheduler(t, sched, 20*time.Second)
+	if pendingSlow() {
+		t.Fatal("an analyzed request is still pending")
+	}
+}
+
+func TestCheckpointStopWhileAnalyzing(t *testing.T) {
+	site := newTestSite(10)
+	defer site.Close()
+	dir, err := ioutil.TempDir("", "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dataArgs := testDataArgs()
+	dataArgs.CheckpointPath = filepath.Join(dir, "checkpoint.json")
+	analyzing := make(chan struct{})
+	release := make(chan struct{})
+	parse := func(httpResp *http.Response, depth uint32) ([]module.Data, []error) {
+		if strings.HasSuffix(httpResp.Request.URL.Path, "/page/0") {
+			close(analyzing)
+			<-release
+		}
+		return testParseLinks(httpResp, depth)
+	}
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, dataArgs,
+		testModules(t, &picked, parse), site.URL+"/page/0")
+	select {
+	case <-analyzing:
+	case <-time.After(20 * time.Second):
+		t.Fatal("timeout waiting for analysis")
+	}
+	stopped := make(chan error, 1)
+	go func() { stopped <- sched.Stop() }()
+	deadline := time.Now().Add(5 * time.Second)
+	for !sched.(*myScheduler).canceled() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for cancellation")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// 此时从首页提取的请求都会因调度器停止而被拒绝。
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	cp, err := LoadCheckpoint(dataArgs.CheckpointPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.Pending) != 1 || cp.Pending[0].URL != site.URL+"/page/0" {
+		t.Fatalf("unexpected pending requests: %+v", cp.Pending)
+	}
+
+	var resumedPicked int64
+	resumed := NewScheduler()
+	requestArgs := RequestArgs{AcceptedDomains: []string{}, MaxDepth: 100}
+	if err := resumed.Init(requestArgs, testDataArgs(), testModules(t, &resumedPicked)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resumed.Stop() })
+	go func() {
+		for range resumed.ErrorChan() {
+		}
+	}()
+	if err := resumed.StartFrom(cp); err != nil {
+		t.Fatal(err)
+	}
+	waitTestScheduler(t, resumed, 20*time.Second)
+	if n := atomic.LoadInt64(&resumedPicked); n != 10 {
+		t.Fatalf("picked %d items after resuming, want 10", n)
+	}
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"sync/atomic"
+)
+
+// CountsStruct 调度器内部计数的结构。
+type CountsStruct struct {
+	// Admitted 被接受并放入请求缓冲池的请求数。
+	Admitted uint64 `json:"admitted"`
+	// Downloaded 下载成功的请求数。
+	Downloaded uint64 `json:"downloaded"`
+	// Analyzed 被分析过的响应数。
+	Analyzed uint64 `json:"analyzed"`
+	// Picked 被条目处理管道处理过的条目数。
+	Picked uint64 `json:"picked"`
+	// Retried 被安排重试的下载次数。
+	Retried uint64 `json:"retried"`
+	// Redirected 经过重定向的响应数。
+	Redirected uint64 `json:"redirected"`
+	// RedirectFiltered 因重定向的目标URL未通过检查而被放弃的请求数。
+	RedirectFiltered uint64 `json:"redirect_filtered"`
+	// Unclaimed 没有分析器接受而被丢弃的响应数。
+	Unclaimed uint64 `json:"unclaimed"`
+}
+
+// schedCounts 调度器内部计数的类型。
+// 各个字段都需要以原子操作的方式访问。
+type schedCounts struct {
+	admitted   uint64
+	downloaded uint64
+	analyzed   uint64
+	picked     uint64
+	retried    uint64
+	// redirected 经过重定向的响应数。
+	redirected uint64
+	// redirectFiltered 因重定向的目标URL未通过检查而被放弃的请求数。
+	redirectFiltered uint64
+	// unclaimed 没有分析器接受而被丢弃的响应数。
+	unclaimed uint64
+}
+
+// Struct 获取计数的结构化形式。
+func (counts *schedCounts) Struct() CountsStruct {
+	return CountsStruct{
+		Admitted:         atomic.LoadUint64(&counts.admitted),
+		Downloaded:       atomic.LoadUint64(&counts.downloaded),
+		Analyzed:         atomic.LoadUint64(&counts.analyzed),
+		Picked:           atomic.LoadUint64(&counts.picked),
+		Retried:          atomic.LoadUint64(&counts.retried),
+		Redirected:       atomic.LoadUint64(&counts.redirected),
+		RedirectFiltered: atomic.LoadUint64(&counts.redirectFiltered),
+		Unclaimed:        atomic.LoadUint64(&counts.unclaimed),
+	}
+}
+
+// Restore 用给定的结构恢复计数。
+func (counts *schedCounts) Restore(cs CountsStruct) {
+	atomic.StoreUint64(&counts.admitted, cs.Admitted)
+	atomic.StoreUint64(&counts.downloaded, cs.Downloaded)
+	atomic.StoreUint64(&counts.analyzed, cs.Analyzed)
+	atomic.StoreUint64(&counts.picked, cs.Picked)
+	atomic.StoreUint64(&counts.retried, cs.Retried)
+	atomic.StoreUint64(&counts.redirected, cs.Redirected)
+	atomic.StoreUint64(&counts.redirectFiltered, cs.RedirectFiltered)
+	atomic.StoreUint64(&counts.unclaimed, cs.Unclaimed)
+}
@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/deadletter"
+	"fmt"
+	"net/http"
+)
+
+// recordDeadLetter 把最终下载失败的请求记入死信存储。
+// 下载出错或者以暂时性失败的状态码结束（且不再重试）都被视为最终下载失败。
+// 下载成功时，相同URL的死信（例如重新注入的死信）会被删除。
+func (sched *myScheduler) recordDeadLetter(
+	req *module.Request, resp *module.Response, err error, mid module.MID) {
+	if sched.deadLetters == nil {
+		return
+	}
+	var crawlerError errors.CrawlerError
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.HTTPResp()
+	}
+	if err != nil {
+		crawlerError = toCrawlerError(err, mid)
+	} else if httpResp != nil && retryableStatus(httpResp.StatusCode) {
+		errMsg := fmt.Sprintf("unavailable status code %d (URL: %s)",
+			httpResp.StatusCode, req.HTTPReq().URL)
+		crawlerError = errors.NewCrawlerError(errors.ERROR_TYPE_DOWNLOADER, errMsg)
+	} else {
+		if _, err := sched.deadLetters.Remove(req.HTTPReq().URL.String()); err != nil {
+			sendError(err, "", sched.errorBufferPool, sched.flights)
+		}
+		return
+	}
+	letter := deadletter.NewLetter(req, crawlerError, req.Attempt()+1)
+	if err := sched.deadLetters.Add(letter); err != nil {
+		sendError(err, "", sched.errorBufferPool, sched.flights)
+	}
+}
+
+// getDeadLetterNumber 获取死信的数量。
+func getDeadLetterNumber(store deadletter.Store) int {
+	if store == nil {
+		return 0
+	}
+	return store.Len()
+}
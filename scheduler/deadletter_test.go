@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/deadletter"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterRemovedAfterSuccess(t *testing.T) {
+	site := newTestSite(3)
+	defer site.Close()
+	dir, err := ioutil.TempDir("", "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "letters.jsonl")
+	store, err := deadletter.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq, _ := http.NewRequest("GET", site.URL+"/page/1", nil)
+	crawlerError := errors.NewCrawlerError(errors.ERROR_TYPE_DOWNLOADER, "boom")
+	store.Add(deadletter.NewLetter(module.NewRequest(httpReq, 1), crawlerError, 3))
+	store.Close()
+
+	dataArgs := testDataArgs()
+	dataArgs.DeadLetterPath = path
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, dataArgs, testModules(t, &picked), site.URL+"/page/0")
+	waitTestScheduler(t, sched, 20*time.Second)
+	if n := atomic.LoadInt64(&picked); n != 3 {
+		t.Fatalf("picked %d items, want 3", n)
+	}
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	// 调度器停止时应关闭死信存储。
+	if err := sched.(*myScheduler).deadLetters.Add(deadletter.Letter{URL: "https://a.com/"}); err != deadletter.ErrClosedStore {
+		t.Fatalf("the dead letter store is still open: %v", err)
+	}
+	store, err = deadletter.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if n := store.Len(); n != 0 {
+		t.Fatalf("%d dead letters, want 0", n)
+	}
+}
@@ -24,38 +24,48 @@ func genParameterError(errMsg string) error {
 }
 
 // sendError 向错误缓冲池发送错误值。
-func sendError(err error, mid module.MID, errorBufferPool buffer.Pool) bool {
+// 参数flights 在途数据的计数器，为nil时不计数。
+func sendError(err error, mid module.MID, errorBufferPool buffer.Pool, flights *inFlight) bool {
 	if err == nil || errorBufferPool == nil || errorBufferPool.Closed() {
 		return false
 	}
-	var crawlerError errors.CrawlerError
-	var ok bool
-	crawlerError, ok = err.(errors.CrawlerError)
-	if !ok {
-		var moduleType module.Type
-		var errorType errors.ErrorType
-		ok, moduleType = module.GetType(mid)
-		if !ok {
-			errorType = errors.ERROR_TYPE_SCHEDULER
-		} else {
-			switch moduleType {
-			case module.TYPE_DOWNLOADER:
-				errorType = errors.ERROR_TYPE_DOWNLOADER
-			case module.TYPE_ANALYZER:
-				errorType = errors.ERROR_TYPE_ANALYZER
-			case module.TYPE_PIPELINE:
-				errorType = errors.ERROR_TYPE_PIPELINE
-			}
-		}
-		crawlerError = errors.NewCrawlerError(errorType, err.Error())
-	}
+	crawlerError := toCrawlerError(err, mid)
 	if errorBufferPool.Closed() {
 		return false
 	}
+	if flights != nil {
+		flights.Add(1)
+	}
 	go func(crawlerError errors.CrawlerError) {
+		if flights != nil {
+			defer flights.Done()
+		}
 		if err := errorBufferPool.Put(crawlerError); err != nil {
 			fmt.Println("The error buffer pool was closed. Ignore error sending.")
 		}
 	}(crawlerError)
 	return true
 }
+
+// toCrawlerError 把给定的错误值转换为爬虫错误值。
+// 错误类型由给定的组件ID决定，无法确定时视为调度器错误。
+func toCrawlerError(err error, mid module.MID) errors.CrawlerError {
+	if crawlerError, ok := err.(errors.CrawlerError); ok {
+		return crawlerError
+	}
+	var errorType errors.ErrorType
+	ok, moduleType := module.GetType(mid)
+	if !ok {
+		errorType = errors.ERROR_TYPE_SCHEDULER
+	} else {
+		switch moduleType {
+		case module.TYPE_DOWNLOADER:
+			errorType = errors.ERROR_TYPE_DOWNLOADER
+		case module.TYPE_ANALYZER:
+			errorType = errors.ERROR_TYPE_ANALYZER
+		case module.TYPE_PIPELINE:
+			errorType = errors.ERROR_TYPE_PIPELINE
+		}
+	}
+	return errors.NewCrawlerErrorBy(errorType, err)
+}
@@ -0,0 +1,253 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/buffer"
+	"container/heap"
+	"fmt"
+	"sync"
+)
+
+// CrawlStrategy 爬取策略的类型。
+// 决定请求缓冲池中的请求被取出的顺序。
+type CrawlStrategy string
+
+const (
+	// STRATEGY_FIFO 先进先出。请求按照到达的顺序被爬取。
+	STRATEGY_FIFO CrawlStrategy = "fifo"
+	// STRATEGY_BREADTH_FIRST 广度优先。深度较小的请求先被爬取。
+	STRATEGY_BREADTH_FIRST CrawlStrategy = "breadth_first"
+	// STRATEGY_DEPTH_FIRST 深度优先。深度较大的请求先被爬取。
+	STRATEGY_DEPTH_FIRST CrawlStrategy = "depth_first"
+	// STRATEGY_BEST_FIRST 最佳优先。得分较高的请求先被爬取。
+	STRATEGY_BEST_FIRST CrawlStrategy = "best_first"
+)
+
+// legalStrategy 判断给定的爬取策略是否合法。
+// 空字符串等同于先进先出。
+func legalStrategy(strategy CrawlStrategy) bool {
+	switch strategy {
+	case "", STRATEGY_FIFO, STRATEGY_BREADTH_FIRST,
+		STRATEGY_DEPTH_FIRST, STRATEGY_BEST_FIRST:
+		return true
+	}
+	return false
+}
+
+// ScoreRequest 计算请求得分的函数类型。
+// 用于最佳优先策略，得分越高的请求越先被爬取。
+type ScoreRequest func(req *module.Request) float64
+
+// ScoreRequestByPriority 以请求优先级作为得分的计算函数。
+func ScoreRequestByPriority(req *module.Request) float64 {
+	return req.Priority()
+}
+
+// newReqBufferPool 按照爬取策略创建请求缓冲池。
+// 先进先出策略使用普通的数据缓冲池，其他策略使用优先级队列。
+func newReqBufferPool(
+	strategy CrawlStrategy,
+	scoreRequest ScoreRequest,
+	bufferCap uint32,
+	maxBufferNumber uint32) (buffer.Pool, error) {
+	if strategy == "" || strategy == STRATEGY_FIFO {
+		return buffer.NewPool(bufferCap, maxBufferNumber)
+	}
+	return newFrontier(strategy, scoreRequest, bufferCap, maxBufferNumber)
+}
+
+// frontierEntry 优先级队列中的条目。
+type frontierEntry struct {
+	// req 请求。
+	req *module.Request
+	// score 请求的得分。
+	score float64
+	// seq 请求放入的序号。
+	seq uint64
+}
+
+// frontierHeap 优先级队列使用的堆。
+type frontierHeap struct {
+	entries []*frontierEntry
+	less    func(e1, e2 *frontierEntry) bool
+}
+
+func (h *frontierHeap) Len() int           { return len(h.entries) }
+func (h *frontierHeap) Less(i, j int) bool { return h.less(h.entries[i], h.entries[j]) }
+func (h *frontierHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *frontierHeap) Push(x interface{}) { h.entries = append(h.entries, x.(*frontierEntry)) }
+func (h *frontierHeap) Pop() interface{} {
+	n := len(h.entries)
+	entry := h.entries[n-1]
+	h.entries[n-1] = nil
+	h.entries = h.entries[:n-1]
+	return entry
+}
+
+// myFrontier 基于优先级队列的请求缓冲池的实现类型。
+// 实现了数据缓冲池的接口，只接受*module.Request类型的数据。
+type myFrontier struct {
+	// bufferCap 缓冲器的统一容量。
+	bufferCap uint32
+	// maxBufferNumber 缓冲器的最大数量。
+	// 二者之积即为优先级队列的容量。
+	maxBufferNumber uint32
+	// scoreRequest 请求得分的计算函数。
+	scoreRequest ScoreRequest
+	// heap 存放请求的堆。
+	heap *frontierHeap
+	// seq 下一个请求的序号。
+	seq uint64
+	// closed 是否已关闭。
+	closed bool
+	// lock 保护以上字段的互斥锁。
+	lock sync.Mutex
+	// notEmpty 用于等待队列非空的条件变量。
+	notEmpty *sync.Cond
+	// notFull 用于等待队列未满的条件变量。
+	notFull *sync.Cond
+}
+
+// newFrontier 创建一个基于优先级队列的请求缓冲池。
+func newFrontier(
+	strategy CrawlStrategy,
+	scoreRequest ScoreRequest,
+	bufferCap uint32,
+	maxBufferNumber uint32) (buffer.Pool, error) {
+	if bufferCap == 0 {
+		errMsg := fmt.Sprintf("illegal buffer cap for frontier: %d", bufferCap)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+	if maxBufferNumber == 0 {
+		errMsg := fmt.Sprintf("illegal max buffer number for frontier: %d", maxBufferNumber)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+	if scoreRequest == nil {
+		scoreRequest = ScoreRequestByPriority
+	}
+	var less func(e1, e2 *frontierEntry) bool
+	switch strategy {
+	case STRATEGY_BREADTH_FIRST:
+		less = func(e1, e2 *frontierEntry) bool {
+			if d1, d2 := e1.req.Depth(), e2.req.Depth(); d1 != d2 {
+				return d1 < d2
+			}
+			if e1.score != e2.score {
+				return e1.score > e2.score
+			}
+			return e1.seq < e2.seq
+		}
+	case STRATEGY_DEPTH_FIRST:
+		less = func(e1, e2 *frontierEntry) bool {
+			if d1, d2 := e1.req.Depth(), e2.req.Depth(); d1 != d2 {
+				return d1 > d2
+			}
+			if e1.score != e2.score {
+				return e1.score > e2.score
+			}
+			return e1.seq > e2.seq
+		}
+	case STRATEGY_BEST_FIRST:
+		less = func(e1, e2 *frontierEntry) bool {
+			if e1.score != e2.score {
+				return e1.score > e2.score
+			}
+			return e1.seq < e2.seq
+		}
+	default:
+		errMsg := fmt.Sprintf("unsupported crawl strategy for frontier: %q", strategy)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+	frontier := &myFrontier{
+		bufferCap:       bufferCap,
+		maxBufferNumber: maxBufferNumber,
+		scoreRequest:    scoreRequest,
+		heap:            &frontierHeap{less: less},
+	}
+	frontier.notEmpty = sync.NewCond(&frontier.lock)
+	frontier.notFull = sync.NewCond(&frontier.lock)
+	return frontier, nil
+}
+
+func (frontier *myFrontier) BufferCap() uint32 {
+	return frontier.bufferCap
+}
+
+func (frontier *myFrontier) MaxBufferNumber() uint32 {
+	return frontier.maxBufferNumber
+}
+
+func (frontier *myFrontier) BufferNumber() uint32 {
+	total := uint32(frontier.Total())
+	number := (total + frontier.bufferCap - 1) / frontier.bufferCap
+	if number == 0 {
+		number = 1
+	}
+	return number
+}
+
+func (frontier *myFrontier) Total() uint64 {
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	return uint64(frontier.heap.Len())
+}
+
+func (frontier *myFrontier) Put(datum interface{}) error {
+	req, ok := datum.(*module.Request)
+	if !ok {
+		errMsg := fmt.Sprintf("incorrect request type for frontier: %T", datum)
+		return errors.NewIllegalParameterError(errMsg)
+	}
+	score := frontier.scoreRequest(req)
+	capacity := int(frontier.bufferCap) * int(frontier.maxBufferNumber)
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	for !frontier.closed && frontier.heap.Len() >= capacity {
+		frontier.notFull.Wait()
+	}
+	if frontier.closed {
+		return buffer.ErrClosedBufferPool
+	}
+	heap.Push(frontier.heap, &frontierEntry{
+		req:   req,
+		score: score,
+		seq:   frontier.seq,
+	})
+	frontier.seq++
+	frontier.notEmpty.Signal()
+	return nil
+}
+
+func (frontier *myFrontier) Get() (interface{}, error) {
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	for !frontier.closed && frontier.heap.Len() == 0 {
+		frontier.notEmpty.Wait()
+	}
+	if frontier.closed {
+		return nil, buffer.ErrClosedBufferPool
+	}
+	entry := heap.Pop(frontier.heap).(*frontierEntry)
+	frontier.notFull.Signal()
+	return entry.req, nil
+}
+
+func (frontier *myFrontier) Close() bool {
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	if frontier.closed {
+		return false
+	}
+	frontier.closed = true
+	frontier.heap.entries = nil
+	frontier.notEmpty.Broadcast()
+	frontier.notFull.Broadcast()
+	return true
+}
+
+func (frontier *myFrontier) Closed() bool {
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	return frontier.closed
+}
@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/buffer"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newFrontierRequest 创建测试优先级队列用的请求。
+// 请求的URL路径由名称构成，以便检查取出的顺序。
+func newFrontierRequest(name string, depth uint32, priority float64) *module.Request {
+	httpReq, _ := http.NewRequest("GET", "http://example.com/"+name, nil)
+	req := module.NewRequest(httpReq, depth)
+	req.SetPriority(priority)
+	return req
+}
+
+func TestFrontierOrder(t *testing.T) {
+	// 名称、深度、优先级，按照放入的顺序排列。
+	reqs := []struct {
+		name     string
+		depth    uint32
+		priority float64
+	}{
+		{"a", 1, 0},
+		{"b", 0, 0},
+		{"c", 2, 1},
+		{"d", 1, 2},
+		{"e", 2, 1},
+		{"f", 0, 3},
+		{"g", 1, 0},
+	}
+	for _, tc := range []struct {
+		strategy CrawlStrategy
+		want     string
+	}{
+		{STRATEGY_FIFO, "abcdefg"},
+		// 深度相同时得分高的先取出，得分也相同时先放入的先取出。
+		{STRATEGY_BREADTH_FIRST, "fbdagce"},
+		// 深度相同时得分高的先取出，得分也相同时后放入的先取出。
+		{STRATEGY_DEPTH_FIRST, "ecdgafb"},
+		// 得分相同时先放入的先取出。
+		{STRATEGY_BEST_FIRST, "fdceabg"},
+	} {
+		// 普通的数据缓冲池只有一个缓冲器时才严格先进先出。
+		pool, err := newReqBufferPool(tc.strategy, nil, 10, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.strategy, err)
+		}
+		for _, r := range reqs {
+			if err := pool.Put(newFrontierRequest(r.name, r.depth, r.priority)); err != nil {
+				t.Fatalf("%s: %v", tc.strategy, err)
+			}
+		}
+		if n := pool.Total(); n != uint64(len(reqs)) {
+			t.Fatalf("%s: total %d, want %d", tc.strategy, n, len(reqs))
+		}
+		var got string
+		for range reqs {
+			datum, err := pool.Get()
+			if err != nil {
+				t.Fatalf("%s: %v", tc.strategy, err)
+			}
+			got += datum.(*module.Request).HTTPReq().URL.Path[1:]
+		}
+		if got != tc.want {
+			t.Errorf("%s: order %q, want %q", tc.strategy, got, tc.want)
+		}
+		pool.Close()
+	}
+}
+
+func TestFrontierScoreRequest(t *testing.T) {
+	// 以URL路径的长度作为得分，越长越优先。
+	score := func(req *module.Request) float64 {
+		return float64(len(req.HTTPReq().URL.Path))
+	}
+	pool, err := newReqBufferPool(STRATEGY_BEST_FIRST, score, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	for _, name := range []string{"bb", "a", "dddd", "ccc"} {
+		pool.Put(newFrontierRequest(name, 0, 100-float64(len(name))))
+	}
+	var got []string
+	for i := 0; i < 4; i++ {
+		datum, _ := pool.Get()
+		got = append(got, datum.(*module.Request).HTTPReq().URL.Path[1:])
+	}
+	if fmt.Sprint(got) != "[dddd ccc bb a]" {
+		t.Fatalf("order %v, want [dddd ccc bb a]", got)
+	}
+}
+
+func TestFrontierCapacity(t *testing.T) {
+	pool, err := newFrontier(STRATEGY_BEST_FIRST, nil, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		pool.Put(newFrontierRequest(fmt.Sprint(i), 0, 0))
+	}
+	if n := pool.BufferNumber(); n != 2 {
+		t.Fatalf("buffer number %d, want 2", n)
+	}
+	pool.Put(newFrontierRequest("3", 0, 0))
+	put := make(chan error, 1)
+	go func() {
+		put <- pool.Put(newFrontierRequest("4", 0, 0))
+	}()
+	select {
+	case err := <-put:
+		t.Fatalf("put into a full frontier: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := pool.Get(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-put:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("put blocked after a get")
+	}
+	if err := pool.Put("not a request"); err == nil {
+		t.Fatal("put a non-request without error")
+	}
+	// 关闭后等待中的放入和取出都会返回错误。
+	go func() {
+		put <- pool.Put(newFrontierRequest("5", 0, 0))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if !pool.Close() || pool.Close() {
+		t.Fatal("unexpected results of closing twice")
+	}
+	if err := <-put; err != buffer.ErrClosedBufferPool {
+		t.Fatalf("unexpected put error after closing: %v", err)
+	}
+	if _, err := pool.Get(); err != buffer.ErrClosedBufferPool {
+		t.Fatalf("unexpected get error after closing: %v", err)
+	}
+}
+
+func TestFrontierIllegalParameters(t *testing.T) {
+	if _, err := newFrontier(STRATEGY_BEST_FIRST, nil, 0, 1); err == nil {
+		t.Error("no error for zero buffer cap")
+	}
+	if _, err := newFrontier(STRATEGY_BEST_FIRST, nil, 1, 0); err == nil {
+		t.Error("no error for zero max buffer number")
+	}
+	if _, err := newFrontier("random", nil, 1, 1); err == nil {
+		t.Error("no error for an unsupported strategy")
+	}
+}
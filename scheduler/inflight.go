@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"sync"
+)
+
+// inFlight 在途数据的计数器。
+// 已发送但尚未放入缓冲池的数据，以及已从缓冲池取出但尚未处理完毕的数据都算作在途数据。
+// 计数器被启用后，在途数据的数量一旦归零就意味着爬取流程已经完成。
+type inFlight struct {
+	// count 在途数据的数量。
+	count int64
+	// armed 是否已启用完成检测。
+	armed bool
+	// stopped 是否已停止完成检测。
+	stopped bool
+	// done 爬取流程完成时会被关闭的通道。
+	done chan struct{}
+	// lock 保护以上字段的互斥锁。
+	lock sync.Mutex
+}
+
+// newInFlight 创建一个在途数据的计数器。
+func newInFlight() *inFlight {
+	return &inFlight{done: make(chan struct{})}
+}
+
+// Add 增加在途数据的数量。
+func (f *inFlight) Add(delta int64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.count += delta
+	if f.count < 0 {
+		f.count = 0
+	}
+	f.checkDone()
+}
+
+// Done 把在途数据的数量减一。
+func (f *inFlight) Done() {
+	f.Add(-1)
+}
+
+// Count 获取在途数据的数量。
+func (f *inFlight) Count() int64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.count
+}
+
+// Arm 启用完成检测。
+// 应在初始数据都已发送之后调用，以免在途数据的数量在启动过程中归零而被误判为完成。
+func (f *inFlight) Arm() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.armed = true
+	f.checkDone()
+}
+
+// Armed 判断是否已启用完成检测。
+func (f *inFlight) Armed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.armed
+}
+
+// Stop 停止完成检测。
+// 调度器被停止后被丢弃的数据会使在途数据的数量归零，但那并不代表爬取流程已完成。
+func (f *inFlight) Stop() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.stopped = true
+}
+
+// Chan 获取爬取流程完成时会被关闭的通道。
+func (f *inFlight) Chan() <-chan struct{} {
+	return f.done
+}
+
+// checkDone 在满足条件时关闭完成通道。调用方需持有锁。
+func (f *inFlight) checkDone() {
+	if !f.armed || f.stopped || f.count > 0 {
+		return
+	}
+	select {
+	case <-f.done:
+	default:
+		close(f.done)
+	}
+}
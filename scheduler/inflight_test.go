@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closed 判断给定的通道是否已被关闭。
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestInFlightDone(t *testing.T) {
+	f := newInFlight()
+	// 启用之前计数归零不算完成。
+	f.Add(1)
+	f.Done()
+	if closed(f.Chan()) {
+		t.Fatal("done before being armed")
+	}
+	f.Add(2)
+	f.Arm()
+	if !f.Armed() || closed(f.Chan()) {
+		t.Fatal("done with data in flight")
+	}
+	f.Done()
+	if closed(f.Chan()) {
+		t.Fatal("done with data in flight")
+	}
+	f.Done()
+	if !closed(f.Chan()) {
+		t.Fatal("not done when nothing is in flight")
+	}
+	// 完成之后计数的变化不会导致重复关闭通道。
+	f.Add(1)
+	f.Done()
+	f.Done()
+	if n := f.Count(); n != 0 {
+		t.Fatalf("count %d, want 0", n)
+	}
+}
+
+func TestInFlightArmWhenEmpty(t *testing.T) {
+	f := newInFlight()
+	f.Arm()
+	if !closed(f.Chan()) {
+		t.Fatal("not done after arming with nothing in flight")
+	}
+}
+
+func TestInFlightStopped(t *testing.T) {
+	f := newInFlight()
+	f.Add(1)
+	f.Arm()
+	f.Stop()
+	f.Done()
+	if closed(f.Chan()) {
+		t.Fatal("done after the detection was stopped")
+	}
+}
+
+func TestSchedulerDoneAndWait(t *testing.T) {
+	site := newTestSite(30)
+	defer site.Close()
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, testDataArgs(), testModules(t, &picked), site.URL+"/page/0")
+	select {
+	case <-sched.Done():
+	case <-time.After(30 * time.Second):
+		t.Fatal("the crawl was not completed in time")
+	}
+	// 完成时所有数据都必须已经处理完毕。
+	if n := atomic.LoadInt64(&picked); n != 30 {
+		t.Fatalf("picked %d items when done, want 30", n)
+	}
+	if !sched.Idle() {
+		t.Fatal("not idle when done")
+	}
+	if err := sched.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error of waiting a completed crawl: %v", err)
+	}
+	if sched.Status() != SCHED_STATUS_STARTED {
+		t.Fatalf("status %s, want started", GetStatusDescription(sched.Status()))
+	}
+}
+
+func TestSchedulerWaitStopped(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer site.Close()
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, testDataArgs(), testModules(t, &picked), site.URL+"/page/0")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := sched.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error of waiting with a deadline: %v", err)
+	}
+	waited := make(chan error, 1)
+	go func() {
+		waited <- sched.Wait(context.Background())
+	}()
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Fatal("no error of waiting a stopped scheduler")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("waiting was not interrupted by stopping")
+	}
+	if closed(sched.Done()) {
+		t.Fatal("done after being stopped before completion")
+	}
+}
@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate 暂停闸门。
+// 闸门关闭时，各个阶段的工作者都会在获取新数据之前等待，直到闸门重新打开。
+type pauseGate struct {
+	// paused 闸门是否已关闭。
+	paused bool
+	// resumeCh 闸门重新打开时会被关闭的通道。
+	resumeCh chan struct{}
+	// lock 保护以上字段的互斥锁。
+	lock sync.Mutex
+}
+
+// newPauseGate 创建一个处于打开状态的暂停闸门。
+func newPauseGate() *pauseGate {
+	return &pauseGate{}
+}
+
+// Pause 关闭闸门。
+func (gate *pauseGate) Pause() {
+	gate.lock.Lock()
+	defer gate.lock.Unlock()
+	if gate.paused {
+		return
+	}
+	gate.paused = true
+	gate.resumeCh = make(chan struct{})
+}
+
+// Resume 打开闸门，并唤醒所有正在等待的工作者。
+func (gate *pauseGate) Resume() {
+	gate.lock.Lock()
+	defer gate.lock.Unlock()
+	if !gate.paused {
+		return
+	}
+	gate.paused = false
+	close(gate.resumeCh)
+}
+
+// Wait 在闸门关闭时等待其重新打开。
+// 若给定的上下文先结束，则结果值为false。
+func (gate *pauseGate) Wait(ctx context.Context) bool {
+	gate.lock.Lock()
+	paused, resumeCh := gate.paused, gate.resumeCh
+	gate.lock.Unlock()
+	if !paused {
+		return true
+	}
+	select {
+	case <-resumeCh:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
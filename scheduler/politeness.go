@@ -0,0 +1,372 @@
+package scheduler
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// politeness 礼貌爬取控制器的接口类型。
+// 用于按主机或主域名限制请求的发送节奏与并发量。
+// 该接口的实现类型必须是并发安全的！
+type politeness interface {
+	// Acquire 为给定的HTTP请求获取下载许可。
+	// 在满足相应规则之前本方法会一直阻塞，除非上下文被取消。
+	// 获取成功后，调用方必须在下载结束时调用返回的释放函数。
+	Acquire(ctx context.Context, httpReq *http.Request) (release func(), err error)
+	// SetCrawlDelay 为给定HTTP请求对应的主机（或主域名）设置额外的抓取间隔。
+	// 实际生效的最小间隔为此值与规则中最小间隔的较大者。
+	SetCrawlDelay(httpReq *http.Request, delay time.Duration)
+	// Held 返回表明已持有给定HTTP请求的下载许可的上下文。
+	// 在该上下文中为同一主机（或主域名）获取下载许可时不会等待，
+	// 例如在跟随重定向时获取同一主域名下另一主机的robots.txt。
+	Held(ctx context.Context, httpReq *http.Request) context.Context
+	// Summary 获取主机（或主域名）的礼貌爬取摘要。
+	// 只包含有请求正在进行中的以及放行请求最多的若干个主机，按键排序。
+	Summary() []PolitenessSummaryStruct
+}
+
+// defaultMaxPolitenessHosts 默认的保留状态的主机（或主域名）的最大数量。
+const defaultMaxPolitenessHosts = 10000
+
+// maxPolitenessSummaries 摘要中最多包含的空闲主机（或主域名）的数量。
+const maxPolitenessSummaries = 20
+
+// heldKey 上下文中已持有下载许可的控制键的键类型。
+type heldKey struct{}
+
+// PolitenessSummaryStruct 单个主机（或主域名）的礼貌爬取摘要类型。
+type PolitenessSummaryStruct struct {
+	Key         string        `json:"key"`
+	InFlight    uint32        `json:"in_flight"`
+	Acquired    uint64        `json:"acquired"`
+	Waited      uint64        `json:"waited"`
+	WaitedTotal time.Duration `json:"waited_total"`
+}
+
+// newPoliteness 根据给定参数创建一个礼貌爬取控制器。
+func newPoliteness(args PolitenessArgs) politeness {
+	rules := map[string]PolitenessRule{}
+	for key, rule := range args.Rules {
+		rules[strings.ToLower(strings.TrimSpace(key))] = rule
+	}
+	maxHosts := args.MaxHosts
+	if maxHosts <= 0 {
+		maxHosts = defaultMaxPolitenessHosts
+	}
+	return &myPoliteness{
+		byHost:      args.ByHost,
+		defaultRule: args.Default,
+		rules:       rules,
+		maxHosts:    maxHosts,
+		hostMap:     map[string]*hostState{},
+		hostList:    list.New(),
+	}
+}
+
+// myPoliteness 礼貌爬取控制器的实现类型。
+type myPoliteness struct {
+	// byHost 是否按主机（而非主域名）进行控制。
+	byHost bool
+	// defaultRule 默认规则。
+	defaultRule PolitenessRule
+	// rules 主机或主域名与专属规则的映射。
+	rules map[string]PolitenessRule
+	// maxHosts 保留状态的主机（或主域名）的最大数量。
+	// 超出时会淘汰最久未使用的空闲状态。
+	maxHosts int
+	// hostMap 键与其状态的映射。
+	hostMap map[string]*hostState
+	// hostList 状态的列表，元素的值为*hostState。越靠前的越是最近使用过的。
+	hostList *list.List
+	// lock 保护hostMap、hostList以及各个状态的elem和refs字段的互斥锁。
+	lock sync.Mutex
+}
+
+// hostState 单个主机（或主域名）的礼貌爬取状态。
+type hostState struct {
+	// key 控制键。
+	key string
+	// elem 状态在hostList中的元素。
+	elem *list.Element
+	// refs 正在使用该状态的调用的数量。大于0时不会被淘汰。
+	refs int
+	// rule 适用的规则。
+	rule PolitenessRule
+	// crawlDelay 额外的抓取间隔，例如robots.txt中声明的Crawl-delay。
+	crawlDelay time.Duration
+	// inFlight 正在进行中的请求数。
+	inFlight uint32
+	// tokens 令牌桶中当前的令牌数。
+	tokens float64
+	// lastRefill 上次填充令牌的时间。
+	lastRefill time.Time
+	// lastStart 上次放行请求的时间。
+	lastStart time.Time
+	// acquired 已放行的请求总数。
+	acquired uint64
+	// waited 曾经等待过的请求总数。
+	waited uint64
+	// waitedTotal 累计的等待时长。
+	waitedTotal time.Duration
+	// released 用于通知有请求结束的通道。
+	released chan struct{}
+	// lock 保护以上字段的互斥锁。
+	lock sync.Mutex
+}
+
+func (p *myPoliteness) Acquire(
+	ctx context.Context, httpReq *http.Request) (func(), error) {
+	key := p.key(httpReq)
+	if held, _ := ctx.Value(heldKey{}).(string); held == key {
+		return func() {}, nil
+	}
+	state := p.getState(key)
+	defer p.putState(state)
+	var waited time.Duration
+	for {
+		state.lock.Lock()
+		wait, released := state.check(time.Now())
+		if wait == 0 && released == nil {
+			state.inFlight++
+			state.acquired++
+			if waited > 0 {
+				state.waited++
+				state.waitedTotal += waited
+			}
+			state.lock.Unlock()
+			break
+		}
+		state.lock.Unlock()
+		begin := time.Now()
+		if released != nil {
+			select {
+			case <-released:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		} else {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+		waited += time.Since(begin)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(state.release)
+	}, nil
+}
+
+func (p *myPoliteness) Held(ctx context.Context, httpReq *http.Request) context.Context {
+	return context.WithValue(ctx, heldKey{}, p.key(httpReq))
+}
+
+func (p *myPoliteness) SetCrawlDelay(httpReq *http.Request, delay time.Duration) {
+	state := p.getState(p.key(httpReq))
+	defer p.putState(state)
+	state.lock.Lock()
+	state.crawlDelay = delay
+	state.lock.Unlock()
+}
+
+func (p *myPoliteness) Summary() []PolitenessSummaryStruct {
+	p.lock.Lock()
+	summaries := make([]PolitenessSummaryStruct, 0, len(p.hostMap))
+	for key, state := range p.hostMap {
+		state.lock.Lock()
+		summaries = append(summaries, PolitenessSummaryStruct{
+			Key:         key,
+			InFlight:    state.inFlight,
+			Acquired:    state.acquired,
+			Waited:      state.waited,
+			WaitedTotal: state.waitedTotal,
+		})
+		state.lock.Unlock()
+	}
+	p.lock.Unlock()
+	// 主机的数量可能很多，因此只保留有请求正在进行中的以及放行请求最多的那些。
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].InFlight != summaries[j].InFlight {
+			return summaries[i].InFlight > summaries[j].InFlight
+		}
+		if summaries[i].Acquired != summaries[j].Acquired {
+			return summaries[i].Acquired > summaries[j].Acquired
+		}
+		return summaries[i].Key < summaries[j].Key
+	})
+	limit := maxPolitenessSummaries
+	for limit < len(summaries) && summaries[limit].InFlight > 0 {
+		limit++
+	}
+	if len(summaries) > limit {
+		summaries = summaries[:limit]
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Key < summaries[j].Key
+	})
+	return summaries
+}
+
+// key 获取给定HTTP请求对应的控制键。
+func (p *myPoliteness) key(httpReq *http.Request) string {
+	host := strings.ToLower(httpReq.URL.Hostname())
+	if host == "" {
+		host = strings.ToLower(httpReq.Host)
+	}
+	if p.byHost {
+		return host
+	}
+	if pd, err := getPrimaryDomain(host); err == nil {
+		return pd
+	}
+	return host
+}
+
+// getState 获取给定键的状态，必要时新建。
+// 调用方必须在使用完毕后调用putState。
+func (p *myPoliteness) getState(key string) *hostState {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	state, ok := p.hostMap[key]
+	if ok {
+		state.refs++
+		p.hostList.MoveToFront(state.elem)
+		return state
+	}
+	rule, ok := p.rules[key]
+	if !ok {
+		if pd, err := getPrimaryDomain(key); err == nil {
+			rule, ok = p.rules[pd]
+		}
+	}
+	if !ok {
+		rule = p.defaultRule
+	}
+	state = &hostState{
+		key:      key,
+		refs:     1,
+		rule:     rule,
+		tokens:   float64(rule.burst()),
+		released: make(chan struct{}),
+	}
+	state.elem = p.hostList.PushFront(state)
+	p.hostMap[key] = state
+	p.evict(time.Now())
+	return state
+}
+
+// putState 结束对给定状态的使用。
+func (p *myPoliteness) putState(state *hostState) {
+	p.lock.Lock()
+	state.refs--
+	p.lock.Unlock()
+}
+
+// evict 在状态的数量超出上限时，从最久未使用的开始淘汰空闲的状态。
+// 被淘汰的状态与新建的状态没有区别，因此淘汰不会影响爬取的节奏。
+// 调用方必须持有p.lock。
+func (p *myPoliteness) evict(now time.Time) {
+	elem := p.hostList.Back()
+	for len(p.hostMap) > p.maxHosts && elem != nil {
+		prev := elem.Prev()
+		state := elem.Value.(*hostState)
+		if state.refs == 0 {
+			state.lock.Lock()
+			idle := state.idle(now)
+			state.lock.Unlock()
+			if idle {
+				p.hostList.Remove(elem)
+				delete(p.hostMap, state.key)
+			}
+		}
+		elem = prev
+	}
+}
+
+// check 检查在给定时刻是否可以放行一个请求。
+// 若需要等待一段时间，则第一个结果值为等待时长；
+// 若需要等待某个请求结束，则第二个结果值为相应的通知通道。
+// 调用方必须持有状态的锁。
+func (state *hostState) check(now time.Time) (time.Duration, <-chan struct{}) {
+	rule := state.rule
+	if rule.MaxInFlight > 0 && state.inFlight >= rule.MaxInFlight {
+		return 0, state.released
+	}
+	var wait time.Duration
+	minDelay := rule.MinDelay
+	if state.crawlDelay > minDelay {
+		minDelay = state.crawlDelay
+	}
+	if minDelay > 0 && !state.lastStart.IsZero() {
+		if d := minDelay - now.Sub(state.lastStart); d > wait {
+			wait = d
+		}
+	}
+	if rule.Rate > 0 {
+		if !state.lastRefill.IsZero() {
+			state.tokens += now.Sub(state.lastRefill).Seconds() * rule.Rate
+			if max := float64(rule.burst()); state.tokens > max {
+				state.tokens = max
+			}
+		}
+		state.lastRefill = now
+		if state.tokens < 1 {
+			d := time.Duration((1 - state.tokens) / rule.Rate * float64(time.Second))
+			if d > wait {
+				wait = d
+			}
+		}
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+	if rule.Rate > 0 {
+		state.tokens--
+	}
+	state.lastStart = now
+	return 0, nil
+}
+
+// idle 判断状态在给定时刻是否空闲，即与新建的状态相比不会让请求多等待。
+// 被淘汰的状态中的额外抓取间隔会在下次检查robots.txt时重新设置。
+// 调用方必须持有状态的锁。
+func (state *hostState) idle(now time.Time) bool {
+	if state.inFlight > 0 {
+		return false
+	}
+	rule := state.rule
+	minDelay := rule.MinDelay
+	if state.crawlDelay > minDelay {
+		minDelay = state.crawlDelay
+	}
+	if minDelay > 0 && !state.lastStart.IsZero() && now.Sub(state.lastStart) < minDelay {
+		return false
+	}
+	if rule.Rate > 0 && !state.lastRefill.IsZero() {
+		tokens := state.tokens + now.Sub(state.lastRefill).Seconds()*rule.Rate
+		if tokens < float64(rule.burst()) {
+			return false
+		}
+	}
+	return true
+}
+
+// release 释放一个下载许可，并通知等待中的请求。
+func (state *hostState) release() {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.inFlight > 0 {
+		state.inFlight--
+	}
+	close(state.released)
+	state.released = make(chan struct{})
+}
@@ -0,0 +1,261 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPolitenessRequest 创建测试礼貌爬取用的HTTP请求。
+func newPolitenessRequest(t *testing.T, rawURL string) *http.Request {
+	httpReq, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httpReq
+}
+
+// acquireNow 获取下载许可并立即释放，返回获取许可所花的时间。
+func acquireNow(t *testing.T, p politeness, httpReq *http.Request) time.Duration {
+	begin := time.Now()
+	release, err := p.Acquire(context.Background(), httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	return time.Since(begin)
+}
+
+func TestPolitenessMinDelay(t *testing.T) {
+	const minDelay = 50 * time.Millisecond
+	p := newPoliteness(PolitenessArgs{Default: PolitenessRule{MinDelay: minDelay}})
+	httpReq := newPolitenessRequest(t, "http://a.example.com/")
+	begin := time.Now()
+	if d := acquireNow(t, p, httpReq); d >= minDelay {
+		t.Fatalf("the first request waited %s", d)
+	}
+	// 从首个请求被放行时算起，之后的每个请求都至少间隔最小间隔。
+	for i := 1; i <= 3; i++ {
+		acquireNow(t, p, httpReq)
+		if d, want := time.Since(begin), time.Duration(i)*minDelay; d < want {
+			t.Fatalf("request %d was let through after %s, want at least %s", i, d, want)
+		}
+	}
+	// 其他主域名不受影响。
+	if d := acquireNow(t, p, newPolitenessRequest(t, "http://other.com/")); d >= minDelay {
+		t.Fatalf("another domain waited %s", d)
+	}
+	summary := p.Summary()
+	if len(summary) != 2 || summary[0].Key != "example.com" || summary[0].Acquired != 4 ||
+		summary[0].Waited != 3 || summary[1].Key != "other.com" || summary[1].Waited != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+}
+
+func TestPolitenessCrawlDelay(t *testing.T) {
+	const crawlDelay = 80 * time.Millisecond
+	p := newPoliteness(PolitenessArgs{Default: PolitenessRule{MinDelay: 10 * time.Millisecond}})
+	httpReq := newPolitenessRequest(t, "http://example.com/")
+	p.SetCrawlDelay(httpReq, crawlDelay)
+	begin := time.Now()
+	acquireNow(t, p, httpReq)
+	acquireNow(t, p, httpReq)
+	if d := time.Since(begin); d < crawlDelay {
+		t.Fatalf("the second request was let through after %s, want at least the crawl delay %s", d, crawlDelay)
+	}
+}
+
+func TestPolitenessMaxInFlight(t *testing.T) {
+	p := newPoliteness(PolitenessArgs{Default: PolitenessRule{MaxInFlight: 1}})
+	httpReq := newPolitenessRequest(t, "http://example.com/")
+	release, err := p.Acquire(context.Background(), httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan func())
+	go func() {
+		release, err := p.Acquire(context.Background(), httpReq)
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired beyond the in-flight limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	// 多次调用释放函数只有一次生效。
+	release()
+	select {
+	case release := <-acquired:
+		if release == nil {
+			return
+		}
+		if n := p.Summary()[0].InFlight; n != 1 {
+			t.Fatalf("%d requests in flight, want 1", n)
+		}
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("not acquired after the release")
+	}
+	if n := p.Summary()[0].InFlight; n != 0 {
+		t.Fatalf("%d requests in flight, want 0", n)
+	}
+}
+
+func TestPolitenessRate(t *testing.T) {
+	const rate = 20
+	p := newPoliteness(PolitenessArgs{Default: PolitenessRule{Rate: rate, Burst: 3}})
+	httpReq := newPolitenessRequest(t, "http://example.com/")
+	begin := time.Now()
+	for i := 0; i < 3; i++ {
+		acquireNow(t, p, httpReq)
+	}
+	if d := time.Since(begin); d >= time.Second/rate {
+		t.Fatalf("the burst took %s", d)
+	}
+	begin = time.Now()
+	for i := 0; i < 2; i++ {
+		acquireNow(t, p, httpReq)
+	}
+	if d, want := time.Since(begin), 2*time.Second/rate; d < want-10*time.Millisecond {
+		t.Fatalf("2 requests beyond the burst took %s, want at least %s", d, want)
+	}
+}
+
+func TestPolitenessKeys(t *testing.T) {
+	rules := map[string]PolitenessRule{
+		"Slow.com":     {MinDelay: time.Hour},
+		"api.fast.com": {MinDelay: time.Hour},
+	}
+	byDomain := newPoliteness(PolitenessArgs{Rules: rules})
+	for _, rawURL := range []string{"http://a.fast.com/", "http://api.fast.com/", "http://b.fast.com:8080/"} {
+		// 按主域名控制时，api.fast.com的专属规则不适用。
+		if d := acquireNow(t, byDomain, newPolitenessRequest(t, rawURL)); d > time.Second {
+			t.Fatalf("%s waited %s", rawURL, d)
+		}
+	}
+	if summary := byDomain.Summary(); len(summary) != 1 || summary[0].Key != "fast.com" {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	byHost := newPoliteness(PolitenessArgs{ByHost: true, Rules: rules})
+	acquireNow(t, byHost, newPolitenessRequest(t, "http://a.slow.com/"))
+	acquireNow(t, byHost, newPolitenessRequest(t, "http://b.slow.com/"))
+	acquireNow(t, byHost, newPolitenessRequest(t, "http://api.fast.com/"))
+	// 按主机控制时，未找到主机的专属规则会再尝试其主域名的专属规则。
+	for _, rawURL := range []string{"http://a.slow.com/x", "http://api.fast.com/y"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := byHost.Acquire(ctx, newPolitenessRequest(t, rawURL))
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("%s: unexpected error: %v", rawURL, err)
+		}
+	}
+	if d := acquireNow(t, byHost, newPolitenessRequest(t, "http://a.fast.com/")); d > time.Second {
+		t.Fatalf("a host without rules waited %s", d)
+	}
+	summary := byHost.Summary()
+	if len(summary) != 4 || summary[0].Key != "a.fast.com" || summary[1].Key != "a.slow.com" {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+}
+
+func TestPolitenessHeld(t *testing.T) {
+	p := newPoliteness(PolitenessArgs{Default: PolitenessRule{MaxInFlight: 1, MinDelay: time.Hour}})
+	httpReq := newPolitenessRequest(t, "http://www.example.com/")
+	release, err := p.Acquire(context.Background(), httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(p.Held(context.Background(), httpReq), time.Second)
+	defer cancel()
+	// 同一主域名下的另一主机也不需要等待。
+	heldRelease, err := p.Acquire(ctx, newPolitenessRequest(t, "http://example.com/robots.txt"))
+	if err != nil {
+		t.Fatalf("unexpected error with a held permit: %v", err)
+	}
+	heldRelease()
+	if n := p.Summary()[0].InFlight; n != 1 {
+		t.Fatalf("%d requests in flight, want 1", n)
+	}
+	otherRelease, err := p.Acquire(ctx, newPolitenessRequest(t, "http://other.com/"))
+	if err != nil {
+		t.Fatalf("unexpected error for another domain: %v", err)
+	}
+	otherRelease()
+}
+
+func TestPolitenessEvictIdleHosts(t *testing.T) {
+	p := newPoliteness(PolitenessArgs{ByHost: true, MaxHosts: 3,
+		Default: PolitenessRule{MinDelay: 50 * time.Millisecond}})
+	busy := newPolitenessRequest(t, "http://busy.com/")
+	release, err := p.Acquire(context.Background(), busy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		acquireNow(t, p, newPolitenessRequest(t, fmt.Sprintf("http://h%d.com/", i)))
+	}
+	// 仍在最小间隔之内或者有请求正在进行中的主机不会被淘汰。
+	if n := len(p.(*myPoliteness).hostMap); n != 6 {
+		t.Fatalf("%d hosts kept, want 6", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	acquireNow(t, p, newPolitenessRequest(t, "http://new.com/"))
+	mp := p.(*myPoliteness)
+	mp.lock.Lock()
+	kept := make([]string, 0, len(mp.hostMap))
+	for key := range mp.hostMap {
+		kept = append(kept, key)
+	}
+	mp.lock.Unlock()
+	sort.Strings(kept)
+	if strings.Join(kept, ",") != "busy.com,h4.com,new.com" {
+		t.Fatalf("unexpected hosts kept: %v", kept)
+	}
+	// 被淘汰的主机的状态会在需要时重新建立。
+	if d := acquireNow(t, p, newPolitenessRequest(t, "http://h0.com/")); d > 20*time.Millisecond {
+		t.Fatalf("an evicted host waited %s", d)
+	}
+	release()
+}
+
+func TestPolitenessSummaryLimit(t *testing.T) {
+	p := newPoliteness(PolitenessArgs{ByHost: true})
+	busy := newPolitenessRequest(t, "http://busy.com/")
+	release, err := p.Acquire(context.Background(), busy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	for i := 0; i < maxPolitenessSummaries+10; i++ {
+		acquireNow(t, p, newPolitenessRequest(t, fmt.Sprintf("http://h%02d.com/", i)))
+	}
+	top := newPolitenessRequest(t, "http://top.com/")
+	for i := 0; i < 3; i++ {
+		acquireNow(t, p, top)
+	}
+	summary := p.Summary()
+	if len(summary) != maxPolitenessSummaries {
+		t.Fatalf("%d hosts in summary, want %d", len(summary), maxPolitenessSummaries)
+	}
+	keys := map[string]bool{}
+	for i, s := range summary {
+		keys[s.Key] = true
+		if i > 0 && summary[i-1].Key >= s.Key {
+			t.Fatalf("the summary is not sorted by key: %+v", summary)
+		}
+	}
+	if !keys["busy.com"] || !keys["top.com"] {
+		t.Fatalf("the active or most used host is missing: %+v", summary)
+	}
+}
@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// 重定向条目中的键。
+const (
+	// REDIRECT_ITEM_KIND 重定向条目的种类键，其值为“redirect”。
+	REDIRECT_ITEM_KIND = "kind"
+	// REDIRECT_ITEM_FROM 重定向之前的URL的键。
+	REDIRECT_ITEM_FROM = "from"
+	// REDIRECT_ITEM_TO 重定向之后的URL的键。
+	REDIRECT_ITEM_TO = "to"
+	// REDIRECT_ITEM_STATUS_CODE 重定向响应的状态码的键。
+	REDIRECT_ITEM_STATUS_CODE = "status_code"
+	// REDIRECT_ITEM_DEPTH 发生重定向的请求的深度的键。
+	REDIRECT_ITEM_DEPTH = "depth"
+)
+
+// redirectRefusedError 重定向的目标URL未通过检查的错误类型。
+type redirectRefusedError struct {
+	// target 重定向的目标URL。
+	target string
+	// reason 未通过检查的原因。
+	reason string
+}
+
+func (err *redirectRefusedError) Error() string {
+	return fmt.Sprintf("the redirect to %s is refused: %s", err.target, err.reason)
+}
+
+// redirectClaim 请求的重定向对已处理的URL的集合的占用记录。
+type redirectClaim struct {
+	// urls 由该请求的重定向加入已处理的URL的集合的URL。
+	urls []string
+	// anyURL 是否允许重定向到已处理过的URL。注入的请求即是如此。
+	anyURL bool
+}
+
+// genCheckRedirect 生成给定请求在下载时使用的重定向检查函数。
+func (sched *myScheduler) genCheckRedirect(req *module.Request) module.CheckRedirect {
+	reqKey := req.HTTPReq().URL.String()
+	return func(target *http.Request, via []*http.Request) error {
+		return sched.checkRedirect(reqKey, target)
+	}
+}
+
+// checkRedirect 在跟随重定向之前检查其目标。
+// 目标URL需要通过与新请求相同的主域名、robots.txt和去重检查，
+// 否则不会被跟随，下载会以redirectRefusedError失败。
+// 跟随重定向同样要遵守目标主机（或主域名）的请求节奏。
+// 参数reqKey 发生重定向的请求在pendingReqMap中的键。
+func (sched *myScheduler) checkRedirect(reqKey string, target *http.Request) error {
+	if sched.canonicalizer != nil {
+		target.URL = sched.canonicalizer.Canonicalize(target.URL)
+		target.Host = target.URL.Host
+	}
+	targetURL := target.URL.String()
+	refuse := func(reason string) error {
+		return &redirectRefusedError{target: targetURL, reason: reason}
+	}
+	scheme := strings.ToLower(target.URL.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return refuse(fmt.Sprintf("its scheme is %q", scheme))
+	}
+	pd, _ := getPrimaryDomain(target.URL.Host)
+	if v, _ := sched.acceptedDomainMap.Load(pd); v == nil {
+		return refuse(fmt.Sprintf("its host %q is not in accepted primary domain map", target.URL.Host))
+	}
+	if sched.robots != nil && !sched.checkRobots(target.Context(), target) {
+		return refuse("it is disallowed by robots.txt")
+	}
+	release, err := sched.politeness.Acquire(target.Context(), target)
+	if err != nil {
+		return err
+	}
+	release()
+	// 登出后通常都会被重定向到同一个登录页面，它需要交给会话处理，因此不做去重检查。
+	if targetURL == reqKey || sched.session.LoggedOutURL(target.URL) {
+		return nil
+	}
+	claimed, err := sched.claimRedirect(reqKey, targetURL)
+	if err != nil {
+		sendError(err, "", sched.errorBufferPool, sched.flights)
+		return nil
+	}
+	if !claimed {
+		return refuse("it is repeated")
+	}
+	return nil
+}
+
+// claimRedirect 把重定向的目标URL加入已处理的URL的集合，并记为被给定的请求占用。
+// 已被同一请求占用的URL可以再次通过，因此该请求在重试或从检查点恢复之后仍然可以重定向到这些URL。
+// 结果值为false时表示该URL已被处理过。
+func (sched *myScheduler) claimRedirect(reqKey, targetURL string) (bool, error) {
+	var claim redirectClaim
+	if v, ok := sched.redirectClaims.Load(reqKey); ok {
+		claim = v.(redirectClaim)
+	}
+	for _, u := range claim.urls {
+		if u == targetURL {
+			return true, nil
+		}
+	}
+	added, err := sched.urlSet.Add(targetURL)
+	if err != nil {
+		return false, err
+	}
+	if !added && !claim.anyURL {
+		return false, nil
+	}
+	urls := make([]string, len(claim.urls), len(claim.urls)+1)
+	copy(urls, claim.urls)
+	claim.urls = append(urls, targetURL)
+	sched.redirectClaims.Store(reqKey, claim)
+	return true, nil
+}
+
+// redirectClaimURLs 获取被给定请求的重定向占用的URL。
+func (sched *myScheduler) redirectClaimURLs(reqKey string) []string {
+	if v, ok := sched.redirectClaims.Load(reqKey); ok {
+		return v.(redirectClaim).urls
+	}
+	return nil
+}
+
+// refuseRedirect 处理重定向未通过检查的下载。
+// 被拒绝的重定向不会被跟随，因此不会下载到任何响应，相应的请求会被放弃。
+// 结果值为false时表示给定的错误值并非因重定向被拒绝而产生。
+func (sched *myScheduler) refuseRedirect(req *module.Request, err error) bool {
+	var refused *redirectRefusedError
+	if !errors.As(err, &refused) {
+		return false
+	}
+	fmt.Printf("Ignore the request! The redirect to %s is refused, because %s. (URL: %s)\n",
+		refused.target, refused.reason, req.HTTPReq().URL)
+	atomic.AddUint64(&sched.counts.redirectFiltered, 1)
+	sched.forgetReq(req.HTTPReq().URL.String())
+	return true
+}
+
+// noteRedirects 统计经过重定向的响应。
+// 若需记录重定向，则每次重定向都会作为一个条目放入条目缓冲池。
+func (sched *myScheduler) noteRedirects(req *module.Request, resp *module.Response) {
+	redirects := resp.Redirects()
+	if len(redirects) == 0 {
+		return
+	}
+	atomic.AddUint64(&sched.counts.redirected, 1)
+	if !sched.recordRedirects {
+		return
+	}
+	for _, redirect := range redirects {
+		sendItem(module.Item{
+			REDIRECT_ITEM_KIND:        "redirect",
+			REDIRECT_ITEM_FROM:        redirect.From.String(),
+			REDIRECT_ITEM_TO:          redirect.To.String(),
+			REDIRECT_ITEM_STATUS_CODE: redirect.StatusCode,
+			REDIRECT_ITEM_DEPTH:       req.Depth(),
+		}, sched.itemBufferPool, sched.flights)
+	}
+}
@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// redirectSite 测试重定向用的站点，会记录每个路径被请求的次数。
+type redirectSite struct {
+	*httptest.Server
+	hits map[string]int
+	lock sync.Mutex
+}
+
+// newRedirectSite 创建测试重定向用的站点。
+// 参数links 首页（/page/0）中的链接。
+// 参数redirects 路径与其重定向的目标URL的字典。
+// 参数handle 处理其他路径的函数，为nil时返回没有链接的页面。
+func newRedirectSite(links []string, redirects map[string]string,
+	handle func(w http.ResponseWriter, r *http.Request, hits int) bool) *redirectSite {
+	site := &redirectSite{hits: map[string]int{}}
+	site.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.lock.Lock()
+		site.hits[r.URL.Path]++
+		hits := site.hits[r.URL.Path]
+		site.lock.Unlock()
+		if target, ok := redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		if handle != nil && handle(w, r, hits) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html>")
+		if r.URL.Path == "/page/0" {
+			for _, link := range links {
+				fmt.Fprintf(w, `<a href="%s">x</a>`, link)
+			}
+		}
+		fmt.Fprint(w, "</html>")
+	}))
+	return site
+}
+
+// Hits 获取给定路径被请求的次数。
+func (site *redirectSite) Hits(path string) int {
+	site.lock.Lock()
+	defer site.lock.Unlock()
+	return site.hits[path]
+}
+
+func TestRedirectOffSite(t *testing.T) {
+	away := newRedirectSite(nil, nil, nil)
+	defer away.Close()
+	site := newRedirectSite([]string{"/away"},
+		map[string]string{"/away": away.URL + "/page/1"}, nil)
+	defer site.Close()
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, testDataArgs(),
+		testModules(t, &picked), site.URL+"/page/0")
+	waitTestScheduler(t, sched, 20*time.Second)
+	if n := away.Hits("/page/1"); n != 0 {
+		t.Fatalf("the off-site target was fetched %d times", n)
+	}
+	if n := atomic.LoadInt64(&picked); n != 1 {
+		t.Fatalf("picked %d items, want 1", n)
+	}
+	counts := sched.(*myScheduler).counts.Struct()
+	if counts.RedirectFiltered != 1 {
+		t.Fatalf("%d redirects filtered, want 1", counts.RedirectFiltered)
+	}
+}
+
+func TestRedirectToSeenURL(t *testing.T) {
+	site := newRedirectSite([]string{"/page/1", "/alias"},
+		map[string]string{"/alias": "/page/1"}, nil)
+	defer site.Close()
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, testDataArgs(),
+		testModules(t, &picked), site.URL+"/page/0")
+	waitTestScheduler(t, sched, 20*time.Second)
+	if n := site.Hits("/page/1"); n != 1 {
+		t.Fatalf("the seen URL was fetched %d times, want 1", n)
+	}
+	if n := atomic.LoadInt64(&picked); n != 2 {
+		t.Fatalf("picked %d items, want 2", n)
+	}
+	counts := sched.(*myScheduler).counts.Struct()
+	if counts.RedirectFiltered != 1 {
+		t.Fatalf("%d redirects filtered, want 1", counts.RedirectFiltered)
+	}
+}
+
+func TestRedirectRetried(t *testing.T) {
+	site := newRedirectSite([]string{"/old"}, map[string]string{"/old": "/new"},
+		func(w http.ResponseWriter, r *http.Request, hits int) bool {
+			if r.URL.Path == "/new" && hits == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return true
+			}
+			return false
+		})
+	defer site.Close()
+	var picked int64
+	requestArgs := RequestArgs{Retry: RetryArgs{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond}}
+	sched := startTestScheduler(t, requestArgs, testDataArgs(),
+		testModules(t, &picked), site.URL+"/page/0")
+	waitTestScheduler(t, sched, 20*time.Second)
+	if n := site.Hits("/new"); n != 2 {
+		t.Fatalf("the redirect target was fetched %d times, want 2", n)
+	}
+	if n := atomic.LoadInt64(&picked); n != 2 {
+		t.Fatalf("picked %d items, want 2", n)
+	}
+	counts := sched.(*myScheduler).counts.Struct()
+	if counts.RedirectFiltered != 0 || counts.Retried != 1 {
+		t.Fatalf("unexpected counts: %+v", counts)
+	}
+}
@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultRetryBaseDelay 默认的首次重试前的等待时长。
+	defaultRetryBaseDelay = time.Second
+	// defaultRetryMaxDelay 默认的重试前的最长等待时长。
+	defaultRetryMaxDelay = time.Minute
+)
+
+// retryPolicy 下载重试策略的类型。
+type retryPolicy struct {
+	// args 重试相关的参数。
+	args RetryArgs
+	// rand 用于计算抖动的随机数生成器。
+	rand *rand.Rand
+	// lock 保护随机数生成器的互斥锁。
+	lock sync.Mutex
+}
+
+// newRetryPolicy 创建一个下载重试策略。
+func newRetryPolicy(args RetryArgs) *retryPolicy {
+	if args.BaseDelay <= 0 {
+		args.BaseDelay = defaultRetryBaseDelay
+	}
+	if args.MaxDelay <= 0 {
+		args.MaxDelay = defaultRetryMaxDelay
+	}
+	return &retryPolicy{
+		args: args,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Next 计算第attempt次尝试失败后，再次尝试之前需要等待的时长。
+// 参数retryAfter 服务端通过Retry-After头要求的等待时长，为0时表示未要求。
+// 若不应再重试，则第二个结果值为false。
+func (policy *retryPolicy) Next(attempt uint32, retryAfter time.Duration) (time.Duration, bool) {
+	if attempt >= policy.args.MaxAttempts {
+		return 0, false
+	}
+	// 服务端要求的等待时长超过上限时直接放弃，以免违背服务端的要求。
+	if retryAfter > policy.args.MaxDelay {
+		return 0, false
+	}
+	delay := policy.args.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := policy.args.BaseDelay << shift; d > 0 && d < delay {
+			delay = d
+		}
+	}
+	if jitter := policy.args.Jitter; jitter > 0 {
+		policy.lock.Lock()
+		r := policy.rand.Float64()
+		policy.lock.Unlock()
+		delay -= time.Duration(float64(delay) * jitter * r)
+	}
+	if delay < retryAfter {
+		delay = retryAfter
+	}
+	return delay, true
+}
+
+// retryableError 判断给定的下载错误是否是暂时性的。
+// 超时、连接被重置或被拒绝以及连接意外关闭都被视为暂时性的错误。
+func retryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	// 包括net.Error和errors.TimeoutError。
+	// 后者的底层错误可能是context.Canceled，因此需要先行判断。
+	var timeoutErr interface{ Timeout() bool }
+	if errors.As(err, &timeoutErr) && timeoutErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	for _, target := range []error{
+		syscall.ECONNRESET,
+		syscall.ECONNREFUSED,
+		syscall.ECONNABORTED,
+		syscall.EPIPE,
+		io.EOF,
+		io.ErrUnexpectedEOF,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryableStatus 判断给定的HTTP状态码是否代表暂时性的失败。
+// 429以及除501之外的5xx状态码都被视为暂时性的失败。
+func retryableStatus(code int) bool {
+	if code == http.StatusTooManyRequests {
+		return true
+	}
+	return code >= 500 && code <= 599 && code != http.StatusNotImplemented
+}
+
+// parseRetryAfter 解析Retry-After头的值。
+// 该值可以是秒数，也可以是HTTP日期。无法解析时返回0。
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// retryDownload 在下载暂时性失败时安排重试。
+// 若已安排重试，则结果值为true，此时给定的响应已被丢弃。
+// 重试的请求会在等待之后重新经过除去重之外的全部检查，
+// 下载时也同样受礼貌爬取的控制。
+func (sched *myScheduler) retryDownload(
+	req *module.Request, resp *module.Response, err error) bool {
+	if sched.retry == nil {
+		return false
+	}
+	var reason string
+	var retryAfter time.Duration
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.HTTPResp()
+	}
+	if err != nil {
+		if !retryableError(err) {
+			return false
+		}
+		reason = err.Error()
+	} else if httpResp != nil && retryableStatus(httpResp.StatusCode) {
+		reason = fmt.Sprintf("status code %d", httpResp.StatusCode)
+		retryAfter = parseRetryAfter(httpResp.Header.Get("Retry-After"), time.Now())
+	} else {
+		return false
+	}
+	attempt := req.Attempt() + 1
+	delay, ok := sched.retry.Next(attempt, retryAfter)
+	if !ok {
+		return false
+	}
+	if httpResp != nil && httpResp.Body != nil {
+		io.Copy(ioutil.Discard, httpResp.Body)
+		httpResp.Body.Close()
+	}
+	retryReq := req.WithAttempt(attempt)
+	reqURL := retryReq.HTTPReq().URL
+	sched.pendingReqMap.Store(reqURL.String(), retryReq)
+	atomic.AddUint64(&sched.counts.retried, 1)
+	fmt.Printf("Retry the request after %s (attempt: %d, reason: %s). (URL: %s)\n",
+		delay, attempt, reason, reqURL)
+	sched.flights.Add(1)
+	time.AfterFunc(delay, func() {
+		defer sched.flights.Done()
+		if !sched.admitReq(retryReq, admitRetry) && !sched.canceled() {
+			sched.forgetReq(reqURL.String())
+		}
+	})
+	return true
+}
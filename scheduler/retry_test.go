@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	crawlerErrors "BeanGithub/crawler/errors"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryableError(t *testing.T) {
+	// wrap 以下载器返回错误的方式包装给定的错误。
+	wrap := func(err error) error {
+		urlErr := &url.Error{Op: "Get", URL: "http://example.com/", Err: err}
+		return crawlerErrors.NewCrawlerErrorBy(crawlerErrors.ERROR_TYPE_DOWNLOADER, urlErr)
+	}
+	connErr := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}
+	}
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", errors.New("boom"), false},
+		{"timeout", crawlerErrors.NewTimeoutError("http://example.com/", time.Second, context.DeadlineExceeded), true},
+		{"timeout canceled", crawlerErrors.NewTimeoutError("http://example.com/", time.Second, context.Canceled), true},
+		{"canceled", wrap(context.Canceled), false},
+		{"deadline", wrap(context.DeadlineExceeded), true},
+		{"connection reset", wrap(connErr(syscall.ECONNRESET)), true},
+		{"connection refused", wrap(connErr(syscall.ECONNREFUSED)), true},
+		{"connection aborted", wrap(connErr(syscall.ECONNABORTED)), true},
+		{"broken pipe", wrap(connErr(syscall.EPIPE)), true},
+		{"permission denied", wrap(connErr(syscall.EACCES)), false},
+		{"eof", wrap(io.EOF), true},
+		{"unexpected eof", fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), true},
+		{"dns", wrap(&net.DNSError{Err: "no such host", Name: "example.invalid"}), false},
+		{"dns timeout", wrap(&net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}), true},
+		{"bad url", wrap(errors.New("unsupported protocol scheme")), false},
+	} {
+		if got := retryableError(tc.err); got != tc.want {
+			t.Errorf("%s: retryableError(%v) = %v, want %v", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	for code, want := range map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusNotModified:         false,
+		http.StatusBadRequest:          false,
+		http.StatusForbidden:           false,
+		http.StatusNotFound:            false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusNotImplemented:      false,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+		599:                            true,
+	} {
+		if got := retryableStatus(code); got != want {
+			t.Errorf("retryableStatus(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		" 3 ":                           3 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Mon, 01 Jan 2024 00:00:30 GMT": 30 * time.Second,
+		"Sun, 31 Dec 2023 23:59:00 GMT": 0,
+	} {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestRetryPolicyNext(t *testing.T) {
+	policy := newRetryPolicy(RetryArgs{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second})
+	for attempt, want := range map[uint32]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+	} {
+		if delay, ok := policy.Next(attempt, 0); !ok || delay != want {
+			t.Errorf("Next(%d) = %s, %v, want %s", attempt, delay, ok, want)
+		}
+	}
+	if _, ok := policy.Next(5, 0); ok {
+		t.Error("retried after the last attempt")
+	}
+	// 服务端要求的等待时长更长时以其为准，超过上限时不再重试。
+	if delay, ok := policy.Next(1, 3*time.Second); !ok || delay != 3*time.Second {
+		t.Errorf("Next with Retry-After = %s, %v, want 3s", delay, ok)
+	}
+	if _, ok := policy.Next(1, 10*time.Second); ok {
+		t.Error("retried although Retry-After exceeds the max delay")
+	}
+	if _, ok := newRetryPolicy(RetryArgs{}).Next(1, 0); ok {
+		t.Error("retried without max attempts")
+	}
+	defaults := newRetryPolicy(RetryArgs{MaxAttempts: 100})
+	if delay, _ := defaults.Next(1, 0); delay != defaultRetryBaseDelay {
+		t.Errorf("default base delay %s, want %s", delay, defaultRetryBaseDelay)
+	}
+	if delay, _ := defaults.Next(64, 0); delay != defaultRetryMaxDelay {
+		t.Errorf("delay after many attempts %s, want %s", delay, defaultRetryMaxDelay)
+	}
+	jittered := newRetryPolicy(RetryArgs{MaxAttempts: 5, BaseDelay: time.Second, Jitter: 0.5})
+	for i := 0; i < 20; i++ {
+		if delay, _ := jittered.Next(2, 0); delay < time.Second || delay > 2*time.Second {
+			t.Fatalf("jittered delay %s out of [1s, 2s]", delay)
+		}
+	}
+}
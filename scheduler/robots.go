@@ -0,0 +1,254 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/robots"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultRobotsCacheTTL robots.txt缓存的默认有效期。
+const defaultRobotsCacheTTL = 24 * time.Hour
+
+// robotsFailureTTL 获取robots.txt失败时的缓存有效期。
+// 连续失败时有效期会逐次翻倍，但不会超过正常的有效期。
+const robotsFailureTTL = time.Minute
+
+// robotsCache robots.txt缓存的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type robotsCache interface {
+	// Group 获取给定URL所属主机适用于当前用户代理的规则组。
+	// 必要时会通过已注册的下载器获取robots.txt。
+	Group(ctx context.Context, reqURL *url.URL) *robots.Group
+	// Robots 获取给定URL所属主机的robots.txt解析结果。
+	// 获取失败的结果只会被缓存较短的时间（连续失败时逐次延长），
+	// 因上下文被取消而未能获取的结果则不会被缓存。
+	Robots(ctx context.Context, reqURL *url.URL) *robots.Robots
+	// IncrDisallowed 被禁止的请求计数增加1。
+	IncrDisallowed()
+	// Summary 获取robots.txt缓存的摘要。
+	Summary() RobotsSummaryStruct
+}
+
+// RobotsSummaryStruct robots.txt缓存的摘要类型。
+type RobotsSummaryStruct struct {
+	Enabled    bool   `json:"enabled"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	HostNumber int    `json:"host_number"`
+	Fetched    uint64 `json:"fetched"`
+	FetchError uint64 `json:"fetch_error"`
+	Disallowed uint64 `json:"disallowed"`
+}
+
+// newRobotsCache 创建一个robots.txt缓存。
+// 参数politeness 用于限制获取robots.txt的节奏，为nil时不做限制。
+func newRobotsCache(args RobotsArgs, registrar module.Registrar, politeness politeness) robotsCache {
+	ttl := args.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultRobotsCacheTTL
+	}
+	return &myRobotsCache{
+		userAgent:  args.UserAgent,
+		ttl:        ttl,
+		registrar:  registrar,
+		politeness: politeness,
+		entryMap:   map[string]*robotsEntry{},
+	}
+}
+
+// myRobotsCache robots.txt缓存的实现类型。
+type myRobotsCache struct {
+	// userAgent 匹配规则组时使用的用户代理。
+	userAgent string
+	// ttl 缓存的有效期。
+	ttl time.Duration
+	// registrar 组件注册器，用于获取下载器。
+	registrar module.Registrar
+	// politeness 礼貌爬取控制器。获取robots.txt同样要遵守礼貌爬取的规则。
+	politeness politeness
+	// entryMap 主机（含协议和端口）与缓存条目的映射。
+	entryMap map[string]*robotsEntry
+	// lock 保护entryMap的互斥锁。
+	lock sync.Mutex
+	// fetched 获取robots.txt的计数。
+	fetched uint64
+	// fetchError 获取robots.txt失败的计数。
+	fetchError uint64
+	// disallowed 被禁止的请求计数。
+	disallowed uint64
+}
+
+// robotsEntry robots.txt缓存条目。
+type robotsEntry struct {
+	// robots 解析结果。
+	robots *robots.Robots
+	// expire 过期时间。
+	expire time.Time
+	// failures 连续获取失败的次数。
+	failures uint32
+	// canceled 是否因上下文被取消而未能获取。这样的条目不会被缓存。
+	canceled bool
+	// ready 在解析结果可用时被关闭的通道。
+	ready chan struct{}
+}
+
+func (rc *myRobotsCache) Group(ctx context.Context, reqURL *url.URL) *robots.Group {
+	return rc.Robots(ctx, reqURL).Group(rc.userAgent)
+}
+
+func (rc *myRobotsCache) Robots(ctx context.Context, reqURL *url.URL) *robots.Robots {
+	key := strings.ToLower(reqURL.Scheme + "://" + reqURL.Host)
+	for {
+		rc.lock.Lock()
+		entry, ok := rc.entryMap[key]
+		var failures uint32
+		if ok {
+			select {
+			case <-entry.ready:
+				if time.Now().After(entry.expire) {
+					failures = entry.failures
+					ok = false
+				}
+			default:
+			}
+		}
+		if !ok {
+			entry = &robotsEntry{ready: make(chan struct{})}
+			rc.entryMap[key] = entry
+			rc.lock.Unlock()
+			return rc.load(ctx, key, entry, failures)
+		}
+		rc.lock.Unlock()
+		select {
+		case <-entry.ready:
+			if entry.canceled {
+				// 获取者的上下文被取消了，需要重新获取。
+				continue
+			}
+			return entry.robots
+		case <-ctx.Done():
+			return robots.DisallowAll()
+		}
+	}
+}
+
+// load 获取robots.txt并填充给定的缓存条目。
+// 参数failures 此前连续获取失败的次数。
+func (rc *myRobotsCache) load(
+	ctx context.Context, key string, entry *robotsEntry, failures uint32) *robots.Robots {
+	parsed, ok := rc.fetch(ctx, key)
+	if ctx.Err() != nil {
+		rc.lock.Lock()
+		if rc.entryMap[key] == entry {
+			delete(rc.entryMap, key)
+		}
+		rc.lock.Unlock()
+		entry.canceled = true
+		close(entry.ready)
+		return robots.DisallowAll()
+	}
+	entry.robots = parsed
+	if ok {
+		entry.expire = time.Now().Add(rc.ttl)
+	} else {
+		entry.failures = failures + 1
+		entry.expire = time.Now().Add(rc.failureTTL(entry.failures))
+	}
+	close(entry.ready)
+	return parsed
+}
+
+// failureTTL 获取连续失败给定次数之后的缓存有效期。
+func (rc *myRobotsCache) failureTTL(failures uint32) time.Duration {
+	ttl := robotsFailureTTL
+	for i := uint32(1); i < failures && ttl < rc.ttl; i++ {
+		ttl *= 2
+	}
+	if ttl > rc.ttl {
+		ttl = rc.ttl
+	}
+	return ttl
+}
+
+// fetch 通过已注册的下载器获取并解析给定主机的robots.txt。
+// 按照RFC 9309：4xx视为允许一切，5xx和网络错误视为禁止一切。
+// 获取时会遵守礼貌爬取的规则。结果代表获取失败时，第二个结果值为false。
+func (rc *myRobotsCache) fetch(ctx context.Context, hostURL string) (*robots.Robots, bool) {
+	atomic.AddUint64(&rc.fetched, 1)
+	robotsURL := hostURL + "/robots.txt"
+	m, err := rc.registrar.Get(module.TYPE_DOWNLOADER)
+	if err != nil || m == nil {
+		fmt.Printf("Couldn't get a downloader for robots.txt: %s (URL: %s)\n", err, robotsURL)
+		atomic.AddUint64(&rc.fetchError, 1)
+		return robots.DisallowAll(), false
+	}
+	downloader, ok := m.(module.Downloader)
+	if !ok {
+		atomic.AddUint64(&rc.fetchError, 1)
+		return robots.DisallowAll(), false
+	}
+	httpReq, err := http.NewRequest("GET", robotsURL, nil)
+	if err != nil {
+		atomic.AddUint64(&rc.fetchError, 1)
+		return robots.DisallowAll(), false
+	}
+	httpReq = httpReq.WithContext(ctx)
+	if rc.userAgent != "" {
+		httpReq.Header.Set("User-Agent", rc.userAgent)
+	}
+	if rc.politeness != nil {
+		release, err := rc.politeness.Acquire(ctx, httpReq)
+		if err != nil {
+			return robots.DisallowAll(), false
+		}
+		defer release()
+	}
+	resp, err := downloader.Download(module.NewRequest(httpReq, 0))
+	if err != nil || resp == nil || resp.HTTPResp() == nil {
+		if ctx.Err() == nil {
+			fmt.Printf("Couldn't fetch robots.txt: %s (URL: %s)\n", err, robotsURL)
+			atomic.AddUint64(&rc.fetchError, 1)
+		}
+		return robots.DisallowAll(), false
+	}
+	httpResp := resp.HTTPResp()
+	defer httpResp.Body.Close()
+	switch {
+	case httpResp.StatusCode >= 200 && httpResp.StatusCode < 300:
+		parsed, err := robots.Parse(httpResp.Body)
+		if err != nil {
+			atomic.AddUint64(&rc.fetchError, 1)
+			return robots.DisallowAll(), false
+		}
+		return parsed, true
+	case httpResp.StatusCode >= 400 && httpResp.StatusCode < 500:
+		return robots.AllowAll(), true
+	default:
+		atomic.AddUint64(&rc.fetchError, 1)
+		return robots.DisallowAll(), false
+	}
+}
+
+func (rc *myRobotsCache) IncrDisallowed() {
+	atomic.AddUint64(&rc.disallowed, 1)
+}
+
+func (rc *myRobotsCache) Summary() RobotsSummaryStruct {
+	rc.lock.Lock()
+	hostNumber := len(rc.entryMap)
+	rc.lock.Unlock()
+	return RobotsSummaryStruct{
+		Enabled:    true,
+		UserAgent:  rc.userAgent,
+		HostNumber: hostNumber,
+		Fetched:    atomic.LoadUint64(&rc.fetched),
+		FetchError: atomic.LoadUint64(&rc.fetchError),
+		Disallowed: atomic.LoadUint64(&rc.disallowed),
+	}
+}
@@ -0,0 +1,264 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// robotsServer 提供robots.txt的测试服务器。
+type robotsServer struct {
+	*httptest.Server
+	// status robots.txt的状态码。
+	status int32
+	// fetched robots.txt被获取的次数。
+	fetched int32
+	// userAgent 最后一次获取robots.txt时的User-Agent头。
+	userAgent atomic.Value
+}
+
+// testRobotsTxt 测试用的robots.txt。
+const testRobotsTxt = `User-agent: *
+Disallow: /private
+Allow: /private/open
+Crawl-delay: 2
+
+User-agent: other
+Disallow: /
+`
+
+// newRobotsServer 创建一个提供robots.txt的测试服务器，其余路径由给定的处理器处理。
+func newRobotsServer(handler http.Handler) *robotsServer {
+	rs := &robotsServer{status: http.StatusOK}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		atomic.AddInt32(&rs.fetched, 1)
+		rs.userAgent.Store(r.Header.Get("User-Agent"))
+		w.WriteHeader(int(atomic.LoadInt32(&rs.status)))
+		w.Write([]byte(testRobotsTxt))
+	}))
+	return rs
+}
+
+// newTestRobotsCache 创建一个使用真实下载器的robots.txt缓存。
+func newTestRobotsCache(t *testing.T, args RobotsArgs, p politeness) *myRobotsCache {
+	var picked int64
+	registrar := module.NewRegistrar()
+	for _, d := range testModules(t, &picked).Downloaders {
+		if _, err := registrar.Register(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newRobotsCache(args, registrar, p).(*myRobotsCache)
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestRobotsCacheRules(t *testing.T) {
+	rs := newRobotsServer(http.NotFoundHandler())
+	defer rs.Close()
+	rc := newTestRobotsCache(t, RobotsArgs{UserAgent: "testbot"}, nil)
+	ctx := context.Background()
+	for path, want := range map[string]bool{
+		"/":                 true,
+		"/public":           true,
+		"/private":          false,
+		"/private/x":        false,
+		"/private/open/doc": true,
+	} {
+		group := rc.Group(ctx, mustParseURL(t, rs.URL+path))
+		if got := group.Allowed(path); got != want {
+			t.Errorf("%s: allowed %v, want %v", path, got, want)
+		}
+		if delay := group.CrawlDelay(); delay != 2*time.Second {
+			t.Errorf("%s: crawl delay %s, want 2s", path, delay)
+		}
+	}
+	if n := atomic.LoadInt32(&rs.fetched); n != 1 {
+		t.Errorf("robots.txt was fetched %d times, want 1", n)
+	}
+	if ua := rs.userAgent.Load(); ua != "testbot" {
+		t.Errorf("user agent %q, want testbot", ua)
+	}
+	other := newTestRobotsCache(t, RobotsArgs{UserAgent: "other"}, nil)
+	if other.Group(ctx, mustParseURL(t, rs.URL)).Allowed("/public") {
+		t.Errorf("other: /public is allowed")
+	}
+}
+
+func TestRobotsCacheStatus(t *testing.T) {
+	rs := newRobotsServer(http.NotFoundHandler())
+	defer rs.Close()
+	ctx := context.Background()
+	reqURL := mustParseURL(t, rs.URL+"/private")
+	atomic.StoreInt32(&rs.status, http.StatusNotFound)
+	if !newTestRobotsCache(t, RobotsArgs{}, nil).Group(ctx, reqURL).Allowed("/private") {
+		t.Errorf("404: /private is disallowed")
+	}
+	atomic.StoreInt32(&rs.status, http.StatusServiceUnavailable)
+	if newTestRobotsCache(t, RobotsArgs{}, nil).Group(ctx, reqURL).Allowed("/") {
+		t.Errorf("503: / is allowed")
+	}
+}
+
+func TestRobotsCacheFailureBackoff(t *testing.T) {
+	rs := newRobotsServer(http.NotFoundHandler())
+	defer rs.Close()
+	atomic.StoreInt32(&rs.status, http.StatusServiceUnavailable)
+	rc := newTestRobotsCache(t, RobotsArgs{CacheTTL: 10 * time.Minute}, nil)
+	ctx := context.Background()
+	reqURL := mustParseURL(t, rs.URL)
+	key := rs.URL
+	expireNow := func() {
+		rc.lock.Lock()
+		rc.entryMap[key].expire = time.Now().Add(-time.Second)
+		rc.lock.Unlock()
+	}
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute} {
+		start := time.Now()
+		rc.Robots(ctx, reqURL)
+		rc.lock.Lock()
+		ttl := rc.entryMap[key].expire.Sub(start)
+		rc.lock.Unlock()
+		if ttl < want || ttl > want+time.Second {
+			t.Fatalf("failure %d: ttl %s, want %s", i+1, ttl, want)
+		}
+		expireNow()
+	}
+	atomic.StoreInt32(&rs.status, http.StatusOK)
+	start := time.Now()
+	if rc.Group(ctx, reqURL).Allowed("/private") {
+		t.Fatalf("/private is allowed")
+	}
+	rc.lock.Lock()
+	entry := rc.entryMap[key]
+	rc.lock.Unlock()
+	if entry.failures != 0 || entry.expire.Sub(start) < 10*time.Minute {
+		t.Fatalf("failures %d, ttl %s", entry.failures, entry.expire.Sub(start))
+	}
+	if n := atomic.LoadInt32(&rs.fetched); n != 6 {
+		t.Fatalf("robots.txt was fetched %d times, want 6", n)
+	}
+}
+
+func TestRobotsCacheCanceled(t *testing.T) {
+	rs := newRobotsServer(http.NotFoundHandler())
+	defer rs.Close()
+	rc := newTestRobotsCache(t, RobotsArgs{}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reqURL := mustParseURL(t, rs.URL)
+	if rc.Group(ctx, reqURL).Allowed("/") {
+		t.Fatalf("/ is allowed with a canceled context")
+	}
+	if rc.Summary().HostNumber != 0 {
+		t.Fatalf("the canceled result was cached")
+	}
+	if rc.Summary().FetchError != 0 {
+		t.Fatalf("the canceled fetch was counted as an error")
+	}
+	if !rc.Group(context.Background(), reqURL).Allowed("/") {
+		t.Fatalf("/ is disallowed")
+	}
+}
+
+func TestRobotsCachePoliteness(t *testing.T) {
+	rs := newRobotsServer(http.NotFoundHandler())
+	defer rs.Close()
+	p := newPoliteness(PolitenessArgs{ByHost: true})
+	rc := newTestRobotsCache(t, RobotsArgs{}, p)
+	rc.Robots(context.Background(), mustParseURL(t, rs.URL))
+	var acquired uint64
+	for _, summary := range p.Summary() {
+		acquired += summary.Acquired
+	}
+	if acquired != 1 {
+		t.Fatalf("acquired %d permits, want 1", acquired)
+	}
+}
+
+func TestSchedulerObeysRobots(t *testing.T) {
+	private := int32(0)
+	rs := newRobotsServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/private" {
+			atomic.AddInt32(&private, 1)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><a href="/private">x</a><a href="/public">y</a></html>`))
+	}))
+	defer rs.Close()
+	var picked int64
+	requestArgs := RequestArgs{Robots: RobotsArgs{Enabled: true, UserAgent: "testbot"}}
+	sched := startTestScheduler(t, requestArgs, testDataArgs(), testModules(t, &picked), rs.URL+"/")
+	waitTestScheduler(t, sched, 20*time.Second)
+	if n := atomic.LoadInt32(&private); n != 0 {
+		t.Fatalf("/private was fetched %d times", n)
+	}
+	if n := atomic.LoadInt64(&picked); n != 2 {
+		t.Fatalf("picked %d items, want 2", n)
+	}
+	summary := sched.(*myScheduler).robots.Summary()
+	if summary.Disallowed == 0 || summary.Fetched != 1 {
+		t.Fatalf("unexpected robots summary: %+v", summary)
+	}
+}
+
+func TestSchedulerDisallowedURLsAreSeen(t *testing.T) {
+	rs := newRobotsServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><a href="/private">x</a><a href="/public">y</a><a href="/about">z</a></html>`))
+	}))
+	defer rs.Close()
+	var picked int64
+	requestArgs := RequestArgs{
+		AcceptedDomains: []string{},
+		MaxDepth:        100,
+		Robots:          RobotsArgs{Enabled: true, UserAgent: "testbot"},
+	}
+	sched := NewScheduler()
+	if err := sched.Init(requestArgs, testDataArgs(), testModules(t, &picked)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sched.Stop() })
+	var errs []error
+	var lock sync.Mutex
+	go func() {
+		for err := range sched.ErrorChan() {
+			lock.Lock()
+			errs = append(errs, err)
+			lock.Unlock()
+		}
+	}()
+	httpReq, _ := http.NewRequest("GET", rs.URL+"/", nil)
+	if err := sched.Start(httpReq); err != nil {
+		t.Fatal(err)
+	}
+	waitTestScheduler(t, sched, 20*time.Second)
+	if n := atomic.LoadInt64(&picked); n != 3 {
+		t.Fatalf("picked %d items, want 3", n)
+	}
+	// 每个页面都链接到/private，但只检查和计数一次。
+	if n := sched.(*myScheduler).robots.Summary().Disallowed; n != 1 {
+		t.Fatalf("%d requests were disallowed, want 1", n)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
@@ -3,12 +3,17 @@ package scheduler
 import (
 	"BeanGithub/crawler/module"
 	"BeanGithub/crawler/toolkit/buffer"
+	"BeanGithub/crawler/toolkit/canonicalizer"
+	"BeanGithub/crawler/toolkit/deadletter"
+	"BeanGithub/crawler/toolkit/seenset"
 	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Scheduler 调度器的接口类型。
@@ -23,9 +28,27 @@ type Scheduler interface {
 	// Start 启动调度器并执行爬取流程。
 	// 参数firstHTTPReq 首次请求。调度器以此为起点开始执行爬取流程。
 	Start(firstHTTPReq *http.Request) error
+	// StartFrom 从给定的检查点启动调度器并继续爬取流程。
+	// 调用前需要以与生成检查点时相同的参数初始化调度器。
+	StartFrom(checkpoint *Checkpoint) error
 	// Stop 停止调度器的运行。
 	// 所有处理模块执行的流程都会被终止。
+	// 若设置了检查点文件的路径，则会在停止时写入检查点。
 	Stop() error
+	// Pause 暂停调度器的运行。
+	// 暂停后各个处理阶段都不再从缓冲池获取新的数据，
+	// 但缓冲池中的数据以及已处理的URL的集合都会被保留。
+	// 本方法会等待正在处理的数据处理完毕之后再返回。
+	Pause() error
+	// Resume 恢复已暂停的调度器的运行。
+	Resume() error
+	// Inject 向正在运行或已暂停的调度器注入请求。
+	// 注入的请求同样需要通过主域名、深度、robots.txt以及预算等检查，
+	// 但即使其URL已被处理过也会被接受，因此可以用于重新爬取死信中的请求。
+	// 结果值为被接受的请求的数量。
+	Inject(reqs ...*module.Request) (int, error)
+	// Checkpoint 生成当前调度器的检查点。
+	Checkpoint() (*Checkpoint, error)
 	// Status 获取调度器的状态。
 	Status() Status
 	// ErrorChan 获得错误通道。
@@ -34,13 +57,25 @@ type Scheduler interface {
 	ErrorChan() <-chan error
 	// Idle 判断所有处理模块是否都处于空闲状态。
 	Idle() bool
+	// Done 获取爬取流程完成时会被关闭的通道。
+	// 爬取流程完成是指请求缓冲池已空，且没有正在处理的数据和尚未放入缓冲池的数据。
+	// 错误也算作尚未放入缓冲池的数据，因此需要持续从错误通道接收错误值。
+	// 调度器在完成之前被停止时，该通道不会被关闭。
+	Done() <-chan struct{}
+	// Wait 等待爬取流程完成。
+	// 若给定的上下文先结束，则返回该上下文的错误值。
+	// 若调度器在完成之前被停止，则返回相应的错误值。
+	Wait(ctx context.Context) error
 	// Summary 获取摘要实例。
 	Summary() SchedSummary
 }
 
+// stopWaitTimeout 停止调度器时等待正在解析的响应处理完毕的最长时间。
+const stopWaitTimeout = 10 * time.Second
+
 // NewScheduler 创建一个调度器实例。
 func NewScheduler() Scheduler {
-	return &myScheduler{}
+	return &myScheduler{flights: newInFlight()}
 }
 
 // myScheduler 调度器的实现类型。
@@ -59,8 +94,60 @@ type myScheduler struct {
 	itemBufferPool buffer.Pool
 	// errorBufferPool 错误缓冲池。
 	errorBufferPool buffer.Pool
-	// urlMap 已处理的URL的字典。
-	urlMap sync.Map
+	// urlSet 已处理的URL的集合。
+	urlSet seenset.SeenSet
+	// pendingReqMap 已接受但尚未完成下载和解析的请求的字典。
+	pendingReqMap sync.Map
+	// analyzingMap 等待解析的响应与其请求在pendingReqMap中的键的字典。
+	analyzingMap sync.Map
+	// redirectClaims 请求在pendingReqMap中的键与其重定向的占用记录的字典。
+	redirectClaims sync.Map
+	// counts 调度器内部计数。
+	counts schedCounts
+	// checkpointPath 检查点文件的路径。
+	checkpointPath string
+	// checkpointInterval 周期性写入检查点的间隔。
+	checkpointInterval time.Duration
+	// canonicalizer URL规范化器。为nil时表示不做规范化。
+	canonicalizer canonicalizer.Canonicalizer
+	// strategy 爬取策略。
+	strategy CrawlStrategy
+	// scoreRequest 最佳优先策略使用的请求得分计算函数。
+	scoreRequest ScoreRequest
+	// downloadStage 下载阶段。
+	downloadStage *stage
+	// analyzeStage 分析阶段。
+	analyzeStage *stage
+	// pickStage 条目处理阶段。
+	pickStage *stage
+	// deadLetters 死信存储。为nil时表示不记录死信。
+	deadLetters deadletter.Store
+	// retry 下载重试策略。为nil时表示不重试。
+	retry *retryPolicy
+	// session 爬取范围内的会话。为nil时表示不启用会话。
+	session *session
+	// sitemaps 站点地图发现器。为nil时表示不发现站点地图。
+	sitemaps *sitemapSeeder
+	// unclaimed 无人认领的响应按照媒体类型的计数。
+	unclaimed *unclaimedMediaTypes
+	// budget 爬取预算。
+	budget *budget
+	// pauseGate 暂停闸门。
+	pauseGate *pauseGate
+	// flights 在途数据的计数器。
+	flights *inFlight
+	// downloadTimeout 每次下载的超时时间。为0时不限制。
+	downloadTimeout time.Duration
+	// recordRedirects 是否把重定向作为条目记录。
+	recordRedirects bool
+	// autoStop 是否在爬取流程完成时自动停止调度器。
+	autoStop bool
+	// politeness 礼貌爬取控制器。
+	politeness politeness
+	// robots robots.txt缓存。为nil时表示不遵守robots.txt。
+	robots robotsCache
+	// obeyCrawlDelay 是否遵守robots.txt中声明的Crawl-delay。
+	obeyCrawlDelay bool
 	// ctx 上下文，用于感知调度器的停止。
 	ctx context.Context
 	// cancelFunc 取消函数，用于停止调度器。
@@ -127,8 +214,76 @@ func (sched *myScheduler) Init(
 	}
 	fmt.Printf("-- Accepted primary domains: %v",
 		requestArgs.AcceptedDomains)
-	sched.urlMap = sync.Map{}
+	if sched.urlSet != nil {
+		sched.urlSet.Close()
+	}
+	sched.urlSet, err = dataArgs.SeenSet.newSeenSet()
+	if err != nil {
+		err = genErrorByError(err)
+		return
+	}
+	fmt.Printf("-- Seen URL set: %s", sched.urlSet.Kind())
+	sched.pendingReqMap = sync.Map{}
+	sched.analyzingMap = sync.Map{}
+	sched.redirectClaims = sync.Map{}
+	sched.counts.Restore(CountsStruct{})
+	sched.unclaimed = newUnclaimedMediaTypes()
+	sched.checkpointPath = dataArgs.CheckpointPath
+	sched.checkpointInterval = dataArgs.CheckpointInterval
+	if sched.deadLetters != nil {
+		sched.deadLetters.Close()
+		sched.deadLetters = nil
+	}
+	if dataArgs.DeadLetterPath != "" {
+		sched.deadLetters, err = deadletter.Open(dataArgs.DeadLetterPath)
+		if err != nil {
+			err = genErrorByError(err)
+			return
+		}
+		fmt.Printf("-- Dead letters: %d", sched.deadLetters.Len())
+	}
+	if requestArgs.Canonical.Disabled {
+		sched.canonicalizer = nil
+	} else {
+		sched.canonicalizer = canonicalizer.New(requestArgs.Canonical.Rules)
+	}
+	sched.strategy = requestArgs.Strategy
+	sched.autoStop = requestArgs.AutoStop
+	sched.recordRedirects = requestArgs.RecordRedirects
+	sched.downloadTimeout = requestArgs.DownloadTimeout
+	if requestArgs.Retry.MaxAttempts > 1 {
+		sched.retry = newRetryPolicy(requestArgs.Retry)
+	} else {
+		sched.retry = nil
+	}
+	sched.session = newSession(requestArgs.Session)
+	sched.sitemaps = newSitemapSeeder(requestArgs.Sitemap)
+	sched.budget = newBudget(requestArgs.Budget, func(name string) {
+		if requestArgs.Budget.StopOnExhausted {
+			go sched.stopOnExhausted(name)
+		}
+	})
+	if sched.flights == nil || sched.flights.Armed() {
+		sched.flights = newInFlight()
+	}
+	sched.scoreRequest = requestArgs.ScoreRequest
+	fmt.Printf("-- Crawl strategy: %q", sched.strategy)
+	sched.politeness = newPoliteness(requestArgs.Politeness)
+	if requestArgs.Robots.Enabled {
+		sched.robots = newRobotsCache(requestArgs.Robots, sched.registrar, sched.politeness)
+		sched.obeyCrawlDelay = !requestArgs.Robots.IgnoreCrawlDelay
+		fmt.Printf("-- Robots user agent: %q", requestArgs.Robots.UserAgent)
+	} else {
+		sched.robots = nil
+		sched.obeyCrawlDelay = false
+	}
 	sched.initBufferPool(dataArgs)
+	sched.pauseGate = newPauseGate()
+	sched.downloadStage = newStage(dataArgs.DownloadWorkers)
+	sched.analyzeStage = newStage(dataArgs.AnalyzeWorkers)
+	sched.pickStage = newStage(dataArgs.PickWorkers)
+	fmt.Printf("-- Workers: download: %d, analyze: %d, pick: %d",
+		sched.downloadStage.Workers(), sched.analyzeStage.Workers(), sched.pickStage.Workers())
 	sched.resetContext()
 	sched.summary = newSchedSummary(requestArgs, dataArgs, moduleArgs, sched)
 
@@ -137,11 +292,87 @@ func (sched *myScheduler) Init(
 	if err = sched.registerModules(moduleArgs); err != nil {
 		return
 	}
+	if err = sched.shareCookieJar(); err != nil {
+		err = genErrorByError(err)
+		return
+	}
 	fmt.Println("Scheduler has been initialized.")
 	return
 }
 
 func (sched *myScheduler) Start(firstHTTPReq *http.Request) (err error) {
+	prepare := func() error {
+		// 检查参数。
+		fmt.Println("Check first HTTP request...")
+		if firstHTTPReq == nil {
+			return genParameterError("nil first HTTP request")
+		}
+		fmt.Println("The first HTTP request is valid.")
+		// 获得首次请求的主域名，并将其添加到可接受的主域名的字典。
+		fmt.Println("Get the primary domain...")
+		fmt.Printf("-- Host: %s", firstHTTPReq.Host)
+		primaryDomain, err := getPrimaryDomain(firstHTTPReq.Host)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("-- Primary domain: %s", primaryDomain)
+		sched.acceptedDomainMap.Store(primaryDomain, struct{}{})
+		// 基于磁盘的集合中可能留有之前的爬取流程的URL。
+		// 从头开始爬取时必须将其清空，否则这些URL对应的页面都不会被下载。
+		// 只有从检查点启动时才会保留并依据检查点校正这些数据。
+		if n := sched.urlSet.Len(); n > 0 {
+			fmt.Printf("-- Clear %d URLs left in the seen URL set.", n)
+			if err := sched.urlSet.Clear(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	feed := func() {
+		// 放入第一个请求。
+		firstReq := module.NewRequest(firstHTTPReq, 0)
+		sched.sendReq(firstReq)
+		// 从站点地图中发现更多的初始请求。
+		if sched.sitemaps != nil {
+			sched.flights.Add(1)
+			go func() {
+				defer sched.flights.Done()
+				sched.seedFromSitemaps(firstHTTPReq.URL)
+			}()
+		}
+	}
+	return sched.start(prepare, feed)
+}
+
+func (sched *myScheduler) StartFrom(checkpoint *Checkpoint) (err error) {
+	var pendingReqs []*module.Request
+	prepare := func() (err error) {
+		fmt.Println("Check checkpoint...")
+		if checkpoint == nil {
+			return genParameterError("nil checkpoint")
+		}
+		fmt.Printf("-- Checkpoint time: %s", checkpoint.Time)
+		pendingReqs, err = sched.restore(checkpoint)
+		if err != nil {
+			return
+		}
+		fmt.Printf("-- Pending requests: %d, seen URLs: %d",
+			len(pendingReqs), sched.urlSet.Len())
+		return nil
+	}
+	feed := func() {
+		// 放入检查点中尚未完成下载的请求。
+		for _, req := range pendingReqs {
+			sched.putReq(req)
+		}
+	}
+	return sched.start(prepare, feed)
+}
+
+// start 启动调度器。
+// 参数prepare 用于在启动各处理流程之前做准备的函数。
+// 参数feed 用于在各处理流程启动之后放入初始请求的函数。
+func (sched *myScheduler) start(prepare func() error, feed func()) (err error) {
 	defer func() {
 		if p := recover(); p != nil {
 			errMsg := fmt.Sprintf("Fatal scheduler error: %s", p)
@@ -149,6 +380,12 @@ func (sched *myScheduler) Start(firstHTTPReq *http.Request) (err error) {
 			err = genError(errMsg)
 		}
 	}()
+	// 在状态被设置为已启动之后再开始等待完成，以便自动停止调度器。
+	defer func() {
+		if err == nil && sched.autoStop {
+			go sched.stopOnDone()
+		}
+	}()
 	fmt.Println("Start scheduler...")
 	// 检查状态。
 	fmt.Println("Check status for start...")
@@ -166,35 +403,25 @@ func (sched *myScheduler) Start(firstHTTPReq *http.Request) (err error) {
 	if err != nil {
 		return
 	}
-	// 检查参数。
-	fmt.Println("Check first HTTP request...")
-	if firstHTTPReq == nil {
-		err = genParameterError("nil first HTTP request")
+	if err = prepare(); err != nil {
 		return
 	}
-	fmt.Println("The first HTTP request is valid.")
-	// 获得首次请求的主域名，并将其添加到可接受的主域名的字典。
-	fmt.Println("Get the primary domain...")
-	fmt.Printf("-- Host: %s", firstHTTPReq.Host)
-	var primaryDomain string
-	primaryDomain, err = getPrimaryDomain(firstHTTPReq.Host)
-	if err != nil {
+	if err = sched.login(); err != nil {
 		return
 	}
-	fmt.Printf("-- Primary domain: %s", primaryDomain)
-	sched.acceptedDomainMap.Store(primaryDomain, struct{}{})
 	// 开始调度数据和组件。
 	if err = sched.checkBufferPoolForStart(); err != nil {
 		return
 	}
+	sched.pauseGate.Resume()
+	sched.budget.Start()
 	sched.download()
 	sched.analyze()
 	sched.pick()
+	sched.keepCheckpointing()
 	fmt.Println("Scheduler has been started.")
-	// 放入第一个请求。
-	firstReq := module.NewRequest(firstHTTPReq, 0)
-	sched.sendReq(firstReq)
-
+	feed()
+	sched.flights.Arm()
 	return
 }
 
@@ -216,15 +443,96 @@ func (sched *myScheduler) Stop() (err error) {
 	if err != nil {
 		return
 	}
+	sched.flights.Stop()
+	sched.budget.Stop()
 	sched.cancelFunc()
+	// 等待正在解析的响应处理完毕，以便检查点中包含从中提取的请求，或者包含被解析的请求本身。
+	waitCtx, cancel := context.WithTimeout(context.Background(), stopWaitTimeout)
+	if !sched.analyzeStage.waitIdle(waitCtx) {
+		fmt.Println("Some responses are still being analyzed. Save checkpoint anyway.")
+	}
+	cancel()
+	if err := sched.saveCheckpoint(); err != nil {
+		fmt.Printf("An error occurs when saving checkpoint: %s\n", err)
+	}
 	sched.reqBufferPool.Close()
 	sched.respBufferPool.Close()
 	sched.itemBufferPool.Close()
 	sched.errorBufferPool.Close()
+	if sched.deadLetters != nil {
+		if err := sched.deadLetters.Close(); err != nil {
+			fmt.Printf("An error occurs when closing dead letter store: %s\n", err)
+		}
+	}
 	fmt.Println("Scheduler has been stopped.")
 	return
 }
 
+func (sched *myScheduler) Pause() (err error) {
+	fmt.Println("Pause scheduler...")
+	// 检查状态。
+	fmt.Println("Check status for pause...")
+	var oldStatus Status
+	oldStatus, err = sched.checkAndSetStatus(SCHED_STATUS_PAUSING)
+	defer func() {
+		sched.statusLock.Lock()
+		// 暂停期间调度器可能已被停止，此时不能再改变其状态。
+		if sched.status == SCHED_STATUS_PAUSING {
+			if err != nil {
+				sched.status = oldStatus
+			} else {
+				sched.status = SCHED_STATUS_PAUSED
+			}
+		}
+		sched.statusLock.Unlock()
+	}()
+	if err != nil {
+		return
+	}
+	sched.pauseGate.Pause()
+	sched.budget.Pause()
+	// 等待各个阶段正在处理的数据处理完毕。
+	for _, s := range []*stage{sched.downloadStage, sched.analyzeStage, sched.pickStage} {
+		if !s.waitIdle(sched.ctx) {
+			err = genError("the scheduler has been stopped while pausing")
+			return
+		}
+	}
+	fmt.Println("Scheduler has been paused.")
+	return
+}
+
+func (sched *myScheduler) Resume() (err error) {
+	fmt.Println("Resume scheduler...")
+	// 检查状态。
+	fmt.Println("Check status for resume...")
+	if _, err = sched.checkAndSetStatus(SCHED_STATUS_STARTED); err != nil {
+		return
+	}
+	sched.budget.Resume()
+	sched.pauseGate.Resume()
+	fmt.Println("Scheduler has been resumed.")
+	return
+}
+
+func (sched *myScheduler) Inject(reqs ...*module.Request) (int, error) {
+	status := sched.Status()
+	if status != SCHED_STATUS_STARTED && status != SCHED_STATUS_PAUSED {
+		return 0, genError("the scheduler is neither started nor paused!")
+	}
+	var admitted int
+	for _, req := range reqs {
+		if sched.admitReq(req, admitInject) {
+			admitted++
+		}
+	}
+	return admitted, nil
+}
+
+func (sched *myScheduler) Checkpoint() (*Checkpoint, error) {
+	return sched.checkpoint()
+}
+
 func (sched *myScheduler) Status() Status {
 	var status Status
 	sched.statusLock.RLock()
@@ -251,7 +559,7 @@ func (sched *myScheduler) ErrorChan() <-chan error {
 			err, ok := datum.(error)
 			if !ok {
 				errMsg := fmt.Sprintf("incorrect error type: %T", datum)
-				sendError(errors.New(errMsg), "", sched.errorBufferPool)
+				sendError(errors.New(errMsg), "", sched.errorBufferPool, sched.flights)
 				continue
 			}
 			if sched.canceled() {
@@ -276,9 +584,70 @@ func (sched *myScheduler) Idle() bool {
 		sched.itemBufferPool.Total() > 0 {
 		return false
 	}
+	if sched.flights.Count() > 0 {
+		return false
+	}
 	return true
 }
 
+func (sched *myScheduler) Done() <-chan struct{} {
+	return sched.flights.Chan()
+}
+
+func (sched *myScheduler) Wait(ctx context.Context) error {
+	done := sched.flights.Chan()
+	var stopped <-chan struct{}
+	if sched.ctx != nil {
+		stopped = sched.ctx.Done()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-stopped:
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+		return genError("the scheduler has been stopped before the crawl completed")
+	}
+}
+
+// stopOnExhausted 在爬取预算耗尽时停止调度器。
+// 请求数预算耗尽时，会等到已接受的请求都处理完毕之后再停止。
+// 若调度器先被停止，则直接返回。
+func (sched *myScheduler) stopOnExhausted(name string) {
+	if name == BUDGET_REQUESTS {
+		select {
+		case <-sched.flights.Chan():
+		case <-sched.ctx.Done():
+			return
+		}
+	}
+	if sched.canceled() {
+		return
+	}
+	fmt.Printf("The %s budget is exhausted. Stop scheduler automatically...\n", name)
+	if err := sched.Stop(); err != nil {
+		fmt.Printf("An error occurs when stopping scheduler automatically: %s\n", err)
+	}
+}
+
+// stopOnDone 在爬取流程完成时停止调度器。
+// 若调度器先被停止，则直接返回。
+func (sched *myScheduler) stopOnDone() {
+	select {
+	case <-sched.flights.Chan():
+		fmt.Println("The crawl has been completed. Stop scheduler automatically...")
+		if err := sched.Stop(); err != nil {
+			fmt.Printf("An error occurs when stopping scheduler automatically: %s\n", err)
+		}
+	case <-sched.ctx.Done():
+	}
+}
+
 func (sched *myScheduler) Summary() SchedSummary {
 	return sched.summary
 }
@@ -303,7 +672,7 @@ func (sched *myScheduler) initBufferPool(dataArgs DataArgs) {
 	if sched.reqBufferPool != nil && !sched.reqBufferPool.Closed() {
 		sched.reqBufferPool.Close()
 	}
-	sched.reqBufferPool, _ = buffer.NewPool(
+	sched.reqBufferPool, _ = newReqBufferPool(sched.strategy, sched.scoreRequest,
 		dataArgs.ReqBufferCap, dataArgs.ReqMaxBufferNumber)
 	fmt.Printf("-- Request buffer pool: bufferCap: %d, maxBufferNumber: %d",
 		sched.reqBufferPool.BufferCap(), sched.reqBufferPool.MaxBufferNumber())
@@ -352,40 +721,39 @@ func (sched *myScheduler) registerModules(moduleArgs ModuleArgs) error {
 			errMsg := fmt.Sprintf("Couldn't register downloader instance with MID %q!", d.ID())
 			return genError(errMsg)
 		}
-		fmt.Printf("All downloaders have been registered. (number: %d)",
-			len(moduleArgs.Downloaders))
-		for _, a := range moduleArgs.Analyzers {
-			if a == nil {
-				continue
-			}
-			ok, err := sched.registrar.Register(a)
-			if err != nil {
-				return genErrorByError(err)
-			}
-			if !ok {
-				errMsg := fmt.Sprintf("Couldn't register analyzer instance with MID %q!", a.ID())
-				return genError(errMsg)
-			}
+	}
+	fmt.Printf("All downloaders have been registered. (number: %d)",
+		len(moduleArgs.Downloaders))
+	for _, a := range moduleArgs.Analyzers {
+		if a == nil {
+			continue
 		}
-		fmt.Printf("All analyzers have been registered. (number: %d)",
-			len(moduleArgs.Analyzers))
-		for _, p := range moduleArgs.Pipelines {
-			if p == nil {
-				continue
-			}
-			ok, err := sched.registrar.Register(p)
-			if err != nil {
-				return genErrorByError(err)
-			}
-			if !ok {
-				errMsg := fmt.Sprintf("Couldn't register pipeline instance with MID %q!", p.ID())
-				return genError(errMsg)
-			}
+		ok, err := sched.registrar.Register(a)
+		if err != nil {
+			return genErrorByError(err)
+		}
+		if !ok {
+			errMsg := fmt.Sprintf("Couldn't register analyzer instance with MID %q!", a.ID())
+			return genError(errMsg)
 		}
-		fmt.Printf("All pipelines have been registered. (number: %d)",
-			len(moduleArgs.Pipelines))
-		return nil
 	}
+	fmt.Printf("All analyzers have been registered. (number: %d)",
+		len(moduleArgs.Analyzers))
+	for _, p := range moduleArgs.Pipelines {
+		if p == nil {
+			continue
+		}
+		ok, err := sched.registrar.Register(p)
+		if err != nil {
+			return genErrorByError(err)
+		}
+		if !ok {
+			errMsg := fmt.Sprintf("Couldn't register pipeline instance with MID %q!", p.ID())
+			return genError(errMsg)
+		}
+	}
+	fmt.Printf("All pipelines have been registered. (number: %d)",
+		len(moduleArgs.Pipelines))
 	return nil
 }
 
@@ -398,7 +766,7 @@ func (sched *myScheduler) checkBufferPoolForStart() error {
 		return genError("nil request buffer pool")
 	}
 	if sched.reqBufferPool != nil && sched.reqBufferPool.Closed() {
-		sched.reqBufferPool, _ = buffer.NewPool(
+		sched.reqBufferPool, _ = newReqBufferPool(sched.strategy, sched.scoreRequest,
 			sched.reqBufferPool.BufferCap(), sched.reqBufferPool.MaxBufferNumber())
 	}
 	// 检查响应缓冲池。
@@ -431,24 +799,16 @@ func (sched *myScheduler) checkBufferPoolForStart() error {
 // download 从请求缓冲池取出请求并下载，
 // 然后把得到的响应放入响应缓冲池。
 func (sched *myScheduler) download() {
-	go func() {
-		for {
-			if sched.canceled() {
-				break
-			}
-			datum, err := sched.reqBufferPool.Get()
-			if err != nil {
-				fmt.Println("The request buffer pool was closed. Break request reception.")
-				break
-			}
+	sched.startWorkers(sched.downloadStage, sched.reqBufferPool, "request",
+		func(datum interface{}) {
 			req, ok := datum.(*module.Request)
 			if !ok {
 				errMsg := fmt.Sprintf("incorrect request type: %T", datum)
-				sendError(errors.New(errMsg), "", sched.errorBufferPool)
+				sendError(errors.New(errMsg), "", sched.errorBufferPool, sched.flights)
+				return
 			}
 			sched.downloadOne(req)
-		}
-	}()
+		})
 }
 
 // downloadOne 根据指定的请求执行下载，并把响应放入响应缓冲池。
@@ -462,48 +822,83 @@ func (sched *myScheduler) downloadOne(req *module.Request) {
 	m, err := sched.registrar.Get(module.TYPE_DOWNLOADER)
 	if err != nil || m == nil {
 		errMsg := fmt.Sprintf("couldn't get a downloader: %s", err)
-		sendError(errors.New(errMsg), "", sched.errorBufferPool)
-		sched.sendReq(req)
+		sendError(errors.New(errMsg), "", sched.errorBufferPool, sched.flights)
+		sched.putReq(req)
 		return
 	}
 	downloader, ok := m.(module.Downloader)
 	if !ok {
 		errMsg := fmt.Sprintf("incorrect downloader type: %T (MID: %s)",
 			m, m.ID())
-		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
-		sched.sendReq(req)
+		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool, sched.flights)
+		sched.putReq(req)
 		return
 	}
-	resp, err := downloader.Download(req)
-	if resp != nil {
-		sendResp(resp, sched.respBufferPool)
+	// 字节数或时长预算耗尽后不再下载，请求仍会保留在检查点中。
+	if !sched.budget.DownloadAllowed() {
+		fmt.Printf("Ignore the request! The crawl budget is exhausted. (URL: %s)\n",
+			req.HTTPReq().URL)
+		return
 	}
+	release, err := sched.politeness.Acquire(sched.ctx, req.HTTPReq())
 	if err != nil {
-		sendError(err, m.ID(), sched.errorBufferPool)
+		return
+	}
+	generation := sched.session.Generation()
+	dc := sched.newDownloadContext()
+	// 跟随重定向时可能需要获取同一主域名下另一主机的robots.txt，此时不能再等待下载许可。
+	ctx := sched.politeness.Held(dc.ctx, req.HTTPReq())
+	resp, err := downloader.Download(
+		req.WithContext(ctx).WithCheckRedirect(sched.genCheckRedirect(req)))
+	release()
+	err = dc.finish(req, resp, err)
+	if err != nil && sched.canceled() {
+		// 因调度器停止而中止的下载不算作失败，其请求会保留在检查点中。
+		return
+	}
+	if sched.refuseRedirect(req, err) {
+		return
+	}
+	// 重新登录和重试时，请求会以新的形式继续保留在pendingReqMap中。
+	if sched.relogin(req, resp, generation, downloader) {
+		return
+	}
+	if sched.retryDownload(req, resp, err) {
+		return
+	}
+	reqKey := req.HTTPReq().URL.String()
+	sched.recordDeadLetter(req, resp, err, m.ID())
+	if resp == nil {
+		sched.forgetReq(reqKey)
+	} else {
+		sched.noteRedirects(req, resp)
+		if httpResp := resp.HTTPResp(); httpResp != nil && httpResp.Body != nil {
+			httpResp.Body = sched.budget.CountReader(httpResp.Body)
+		}
+		atomic.AddUint64(&sched.counts.downloaded, 1)
+		// 请求会保留在pendingReqMap中直到其响应被解析完毕，
+		// 以免在此之前停止时丢失该响应中的链接。
+		sched.analyzingMap.Store(resp, reqKey)
+		sendResp(resp, sched.respBufferPool, sched.flights)
+	}
+	if err != nil {
+		sendError(err, m.ID(), sched.errorBufferPool, sched.flights)
 	}
 }
 
 // analyze 从响应缓冲池取出响应并解析，
 // 然后把得到的条目或请求放入相应的缓冲池。
 func (sched *myScheduler) analyze() {
-	go func() {
-		for {
-			if sched.canceled() {
-				break
-			}
-			datum, err := sched.respBufferPool.Get()
-			if err != nil {
-				fmt.Println("The response buffer pool was closed. Break response reception.")
-				break
-			}
+	sched.startWorkers(sched.analyzeStage, sched.respBufferPool, "response",
+		func(datum interface{}) {
 			resp, ok := datum.(*module.Response)
 			if !ok {
 				errMsg := fmt.Sprintf("incorrect response type: %T", datum)
-				sendError(errors.New(errMsg), "", sched.errorBufferPool)
+				sendError(errors.New(errMsg), "", sched.errorBufferPool, sched.flights)
+				return
 			}
 			sched.analyzeOne(resp)
-		}
-	}()
+		})
 }
 
 // analyzeOne 根据指定的响应执行解析并把结果放入相应的缓冲池。
@@ -514,22 +909,30 @@ func (sched *myScheduler) analyzeOne(resp *module.Response) {
 	if sched.canceled() {
 		return
 	}
-	m, err := sched.registrar.Get(module.TYPE_ANALYZER)
-	if err != nil || m == nil {
+	m, err := sched.getAnalyzerFor(resp)
+	if err == nil && m == nil {
+		sched.discardUnclaimed(resp)
+		sched.finishAnalysis(resp)
+		return
+	}
+	if err != nil {
 		errMsg := fmt.Sprintf("couldn't get an analyzer: %s", err)
-		sendError(errors.New(errMsg), "", sched.errorBufferPool)
-		sendResp(resp, sched.respBufferPool)
+		sendError(errors.New(errMsg), "", sched.errorBufferPool, sched.flights)
+		sendResp(resp, sched.respBufferPool, sched.flights)
 		return
 	}
 	analyzer, ok := m.(module.Analyzer)
 	if !ok {
 		errMsg := fmt.Sprintf("incorrect analyzer type: %T (MID: %s)",
 			m, m.ID())
-		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
-		sendResp(resp, sched.respBufferPool)
+		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool, sched.flights)
+		sendResp(resp, sched.respBufferPool, sched.flights)
 		return
 	}
 	dataList, errs := analyzer.Analyze(resp)
+	atomic.AddUint64(&sched.counts.analyzed, 1)
+	// rejected 是否有请求因调度器停止而被拒绝。
+	var rejected bool
 	if dataList != nil {
 		for _, data := range dataList {
 			if data == nil {
@@ -537,42 +940,56 @@ func (sched *myScheduler) analyzeOne(resp *module.Response) {
 			}
 			switch d := data.(type) {
 			case *module.Request:
-				sched.sendReq(d)
+				if !sched.sendReq(d) && sched.canceled() {
+					rejected = true
+				}
 			case module.Item:
-				sendItem(d, sched.itemBufferPool)
+				sendItem(d, sched.itemBufferPool, sched.flights)
 			default:
 				errMsg := fmt.Sprintf("Unsupported data type %T! (data: %#v)", d, d)
-				sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
+				sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool, sched.flights)
 			}
 		}
 	}
 	if errs != nil {
 		for _, err := range errs {
-			sendError(err, m.ID(), sched.errorBufferPool)
+			sendError(err, m.ID(), sched.errorBufferPool, sched.flights)
 		}
 	}
+	// 被拒绝的请求不会出现在检查点中，因此需要保留被解析的请求，以便继续爬取时重新下载并解析。
+	if rejected {
+		sched.analyzingMap.Delete(resp)
+		return
+	}
+	sched.finishAnalysis(resp)
+}
+
+// finishAnalysis 在给定的响应被解析完毕之后，把相应的请求从pendingReqMap中删除。
+func (sched *myScheduler) finishAnalysis(resp *module.Response) {
+	if reqKey, ok := sched.analyzingMap.Load(resp); ok {
+		sched.analyzingMap.Delete(resp)
+		sched.forgetReq(reqKey.(string))
+	}
+}
+
+// forgetReq 把已完成或被放弃的请求从pendingReqMap中删除，并删除其重定向的占用记录。
+func (sched *myScheduler) forgetReq(reqKey string) {
+	sched.pendingReqMap.Delete(reqKey)
+	sched.redirectClaims.Delete(reqKey)
 }
 
 // pick 从条目缓冲池取出条目并处理。
 func (sched *myScheduler) pick() {
-	go func() {
-		for {
-			if sched.canceled() {
-				break
-			}
-			datum, err := sched.itemBufferPool.Get()
-			if err != nil {
-				fmt.Println("The item buffer pool was closed. Break item reception.")
-				break
-			}
+	sched.startWorkers(sched.pickStage, sched.itemBufferPool, "item",
+		func(datum interface{}) {
 			item, ok := datum.(module.Item)
 			if !ok {
 				errMsg := fmt.Sprintf("incorrect item type: %T", datum)
-				sendError(errors.New(errMsg), "", sched.errorBufferPool)
+				sendError(errors.New(errMsg), "", sched.errorBufferPool, sched.flights)
+				return
 			}
 			sched.pickOne(item)
-		}
-	}()
+		})
 }
 
 // piclOne 处理给定的条目。
@@ -583,22 +1000,23 @@ func (sched *myScheduler) pickOne(item module.Item) {
 	m, err := sched.registrar.Get(module.TYPE_PIPELINE)
 	if err != nil || m == nil {
 		errMsg := fmt.Sprintf("couldn't get a pipeline: %s", err)
-		sendError(errors.New(errMsg), "", sched.errorBufferPool)
-		sendItem(item, sched.itemBufferPool)
+		sendError(errors.New(errMsg), "", sched.errorBufferPool, sched.flights)
+		sendItem(item, sched.itemBufferPool, sched.flights)
 		return
 	}
 	pipeline, ok := m.(module.Pipeline)
 	if !ok {
 		errMsg := fmt.Sprintf("incorrect pipeline type: %T (MID: %s)",
 			m, m.ID())
-		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
-		sendItem(item, sched.itemBufferPool)
+		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool, sched.flights)
+		sendItem(item, sched.itemBufferPool, sched.flights)
 		return
 	}
 	errs := pipeline.Send(item)
+	atomic.AddUint64(&sched.counts.picked, 1)
 	if errs != nil {
 		for _, err := range errs {
-			sendError(err, m.ID(), sched.errorBufferPool)
+			sendError(err, m.ID(), sched.errorBufferPool, sched.flights)
 		}
 	}
 }
@@ -606,6 +1024,26 @@ func (sched *myScheduler) pickOne(item module.Item) {
 // sendReq 向请求缓冲池发送请求。
 // 不符合要求的请求会被过滤掉。
 func (sched *myScheduler) sendReq(req *module.Request) bool {
+	return sched.admitReq(req, admitNew)
+}
+
+// admitMode 请求的接受方式。
+type admitMode uint8
+
+const (
+	// admitNew 新发现的请求。
+	admitNew admitMode = iota
+	// admitRetry 重试的请求。
+	// 重试的请求已被接受过，因此不会再做去重检查，也不会再占用请求数预算。
+	admitRetry
+	// admitInject 从外部注入的请求。
+	// 注入的请求即使已被处理过也会被接受，但仍会占用请求数预算。
+	admitInject
+)
+
+// admitReq 检查请求并在符合要求时将其放入请求缓冲池。
+// 参数mode 请求的接受方式。
+func (sched *myScheduler) admitReq(req *module.Request, mode admitMode) bool {
 	if req == nil {
 		return false
 	}
@@ -628,9 +1066,19 @@ func (sched *myScheduler) sendReq(req *module.Request) bool {
 			scheme, "http", "https", reqURL)
 		return false
 	}
-	if v, _ := sched.urlMap.Load(reqURL.String()); v != nil {
-		fmt.Printf("Ignore the request! Its URL is repeated. (URL: %s)\n", reqURL)
-		return false
+	if sched.canonicalizer != nil {
+		reqURL = sched.canonicalizer.Canonicalize(reqURL)
+		httpReq.URL = reqURL
+		httpReq.Host = reqURL.Host
+	}
+	if mode == admitNew {
+		if seen, err := sched.urlSet.Contains(reqURL.String()); err != nil {
+			sendError(err, "", sched.errorBufferPool, sched.flights)
+			return false
+		} else if seen {
+			fmt.Printf("Ignore the request! Its URL is repeated. (URL: %s)\n", reqURL)
+			return false
+		}
 	}
 	pd, _ := getPrimaryDomain(httpReq.Host)
 	if v, _ := sched.acceptedDomainMap.Load(pd); v == nil {
@@ -646,36 +1094,117 @@ func (sched *myScheduler) sendReq(req *module.Request) bool {
 			req.Depth(), sched.maxDepth, reqURL)
 		return false
 	}
+	if sched.robots != nil && !sched.checkRobots(sched.ctx, httpReq) {
+		// 记为已处理，以免链接到该URL的每个页面都重复检查。
+		if mode == admitNew {
+			if _, err := sched.urlSet.Add(reqURL.String()); err != nil {
+				sendError(err, "", sched.errorBufferPool, sched.flights)
+			}
+		}
+		return false
+	}
+	if mode == admitRetry {
+		sched.pendingReqMap.Store(reqURL.String(), req)
+		sched.putReq(req)
+		return true
+	}
+	if mode == admitInject {
+		if _, pending := sched.pendingReqMap.Load(reqURL.String()); pending {
+			fmt.Printf("Ignore the request! It is pending. (URL: %s)\n", reqURL)
+			return false
+		}
+	}
+	if err := sched.budget.Reserve(pd); err != nil {
+		fmt.Printf("Ignore the request! %s. (URL: %s)\n", err, reqURL)
+		return false
+	}
+	if added, err := sched.urlSet.Add(reqURL.String()); err != nil {
+		sched.budget.Cancel(pd)
+		sendError(err, "", sched.errorBufferPool, sched.flights)
+		return false
+	} else if !added && mode != admitInject {
+		sched.budget.Cancel(pd)
+		fmt.Printf("Ignore the request! Its URL is repeated. (URL: %s)\n", reqURL)
+		return false
+	}
+	if mode == admitInject {
+		// 注入的请求可以重新爬取已处理过的URL，其重定向的目标也是如此。
+		sched.redirectClaims.Store(reqURL.String(), redirectClaim{anyURL: true})
+	}
+	sched.pendingReqMap.Store(reqURL.String(), req)
+	atomic.AddUint64(&sched.counts.admitted, 1)
+	sched.putReq(req)
+	return true
+}
+
+// putReq 把请求放入请求缓冲池，不做任何过滤。
+// 请求在被下载完毕之前都算作在途数据。
+func (sched *myScheduler) putReq(req *module.Request) {
+	sched.flights.Add(1)
 	go func(req *module.Request) {
 		if err := sched.reqBufferPool.Put(req); err != nil {
 			fmt.Println("The request buffer pool was closed. Ignore request sending.")
+			sched.flights.Done()
 		}
 	}(req)
-	sched.urlMap.Store(reqURL.String(), struct{}{})
-	return true
+}
+
+// checkRobots 检查给定的HTTP请求是否被robots.txt允许。
+// 被禁止是正常的抓取策略，因此只计数而不报告错误。
+// 参数ctx 获取robots.txt时使用的上下文。
+func (sched *myScheduler) checkRobots(ctx context.Context, httpReq *http.Request) bool {
+	reqURL := httpReq.URL
+	group := sched.robots.Group(ctx, reqURL)
+	if sched.obeyCrawlDelay {
+		if delay := group.CrawlDelay(); delay > 0 {
+			sched.politeness.SetCrawlDelay(httpReq, delay)
+		}
+	}
+	if group.Allowed(reqURL.RequestURI()) {
+		return true
+	}
+	sched.robots.IncrDisallowed()
+	fmt.Printf("Ignore the request! It is disallowed by robots.txt. (URL: %s)\n", reqURL)
+	return false
 }
 
 // sendResp 向响应缓冲池发送响应。
-func sendResp(resp *module.Response, respBufferPool buffer.Pool) bool {
+// 参数flights 在途数据的计数器，为nil时不计数。
+// 响应在被分析完毕之前都算作在途数据。
+func sendResp(resp *module.Response, respBufferPool buffer.Pool, flights *inFlight) bool {
 	if resp == nil || respBufferPool == nil || respBufferPool.Closed() {
 		return false
 	}
+	if flights != nil {
+		flights.Add(1)
+	}
 	go func(resp *module.Response) {
 		if err := respBufferPool.Put(resp); err != nil {
 			fmt.Println("The response buffer pool was closed. Ignore response sending.")
+			if flights != nil {
+				flights.Done()
+			}
 		}
 	}(resp)
 	return true
 }
 
 // sendItem 向条目缓冲池发送条目。
-func sendItem(item module.Item, itemBufferPool buffer.Pool) bool {
+// 参数flights 在途数据的计数器，为nil时不计数。
+// 条目在被处理完毕之前都算作在途数据。
+func sendItem(item module.Item, itemBufferPool buffer.Pool, flights *inFlight) bool {
 	if item == nil || itemBufferPool == nil || itemBufferPool.Closed() {
 		return false
 	}
+	if flights != nil {
+		flights.Add(1)
+	}
 	go func(item module.Item) {
 		if err := itemBufferPool.Put(item); err != nil {
 			fmt.Println("The item buffer pool was closed. Ignore item sending.")
+			if flights != nil {
+				flights.Done()
+			}
 		}
 	}(item)
 	return true
@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/module/local/analyzer"
+	"BeanGithub/crawler/module/local/downloader"
+	"BeanGithub/crawler/module/local/pipeline"
+	"BeanGithub/crawler/toolkit/seenset"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testLinkPattern 测试页面中的链接的正则表达式。
+var testLinkPattern = regexp.MustCompile(`href="([^"]+)"`)
+
+// newTestSite 创建一个由给定数量的页面组成的测试站点。
+func newTestSite(pages int) *httptest.Server {
+	return httptest.NewServer(testSiteHandler(pages))
+}
+
+// testSiteHandler 返回由给定数量的页面组成的测试站点的处理器。
+// 第n个页面链接到第n+1至n+3个页面。
+func testSiteHandler(pages int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscanf(r.URL.Path, "/page/%d", &n)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html>")
+		for i := 1; i <= 3; i++ {
+			if n+i < pages {
+				fmt.Fprintf(w, `<a href="/page/%d">x</a>`, n+i)
+			}
+		}
+		fmt.Fprint(w, "</html>")
+	})
+}
+
+// testParseLinks 提取页面中的链接，并为每个页面生成一个条目。
+func testParseLinks(httpResp *http.Response, depth uint32) ([]module.Data, []error) {
+	body, _ := ioutil.ReadAll(httpResp.Body)
+	var dataList []module.Data
+	for _, match := range testLinkPattern.FindAllStringSubmatch(string(body), -1) {
+		u, err := httpResp.Request.URL.Parse(match[1])
+		if err != nil {
+			continue
+		}
+		httpReq, _ := http.NewRequest("GET", u.String(), nil)
+		dataList = append(dataList, module.NewRequest(httpReq, depth))
+	}
+	dataList = append(dataList, module.Item{"url": httpResp.Request.URL.String()})
+	return dataList, nil
+}
+
+// testModules 创建测试用的组件。picked 用于统计被处理的条目的数量。
+func testModules(t *testing.T, picked *int64, parsers ...module.ParseResponse) ModuleArgs {
+	return testModulesWithClient(t, &http.Client{}, picked, parsers...)
+}
+
+// testModulesWithClient 使用给定的HTTP客户端创建测试用的组件。
+func testModulesWithClient(t *testing.T, client *http.Client, picked *int64,
+	parsers ...module.ParseResponse) ModuleArgs {
+	if len(parsers) == 0 {
+		parsers = []module.ParseResponse{testParseLinks}
+	}
+	dmid, _ := module.GenMID(module.TYPE_DOWNLOADER, 1, nil)
+	amid, _ := module.GenMID(module.TYPE_ANALYZER, 2, nil)
+	pmid, _ := module.GenMID(module.TYPE_PIPELINE, 3, nil)
+	d, err := downloader.New(dmid, client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := analyzer.New(amid, parsers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := pipeline.New(pmid, []module.ProcessItem{func(item module.Item) (module.Item, error) {
+		atomic.AddInt64(picked, 1)
+		return item, nil
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ModuleArgs{
+		Downloaders: []module.Downloader{d},
+		Analyzers:   []module.Analyzer{a},
+		Pipelines:   []module.Pipeline{p},
+	}
+}
+
+// testDataArgs 创建测试用的数据参数。
+func testDataArgs() DataArgs {
+	return DataArgs{
+		ReqBufferCap: 5, ReqMaxBufferNumber: 100,
+		RespBufferCap: 5, RespMaxBufferNumber: 100,
+		ItemBufferCap: 5, ItemMaxBufferNumber: 100,
+		ErrorBufferCap: 5, ErrorMaxBufferNumber: 100,
+		DownloadWorkers: 2, AnalyzeWorkers: 2, PickWorkers: 1,
+	}
+}
+
+// startTestScheduler 初始化并启动调度器，并丢弃其报告的错误。
+func startTestScheduler(t *testing.T, requestArgs RequestArgs, dataArgs DataArgs,
+	moduleArgs ModuleArgs, firstURL string) Scheduler {
+	if requestArgs.AcceptedDomains == nil {
+		requestArgs.AcceptedDomains = []string{}
+	}
+	if requestArgs.MaxDepth == 0 {
+		requestArgs.MaxDepth = 100
+	}
+	sched := NewScheduler()
+	if err := sched.Init(requestArgs, dataArgs, moduleArgs); err != nil {
+		t.Fatal(err)
+	}
+	// 缓冲池在空闲时也会占用CPU，因此测试结束时必须停止调度器。
+	t.Cleanup(func() { sched.Stop() })
+	go func() {
+		for range sched.ErrorChan() {
+		}
+	}()
+	httpReq, _ := http.NewRequest("GET", firstURL, nil)
+	if err := sched.Start(httpReq); err != nil {
+		t.Fatal(err)
+	}
+	return sched
+}
+
+// waitTestScheduler 等待调度器完成爬取。
+func waitTestScheduler(t *testing.T, sched Scheduler, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := sched.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchedulerCrawl(t *testing.T) {
+	site := newTestSite(20)
+	defer site.Close()
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{AutoStop: true}, testDataArgs(),
+		testModules(t, &picked), site.URL+"/page/0")
+	waitTestScheduler(t, sched, 30*time.Second)
+	if n := atomic.LoadInt64(&picked); n != 20 {
+		t.Fatalf("picked %d items, want 20", n)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for sched.Status() != SCHED_STATUS_STOPPED {
+		if time.Now().After(deadline) {
+			t.Fatalf("status %s, want stopped", GetStatusDescription(sched.Status()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSchedulerStartTwiceWithDiskSeenSet(t *testing.T) {
+	site := newTestSite(10)
+	defer site.Close()
+	dir, err := ioutil.TempDir("", "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dataArgs := testDataArgs()
+	dataArgs.SeenSet = SeenSetArgs{Kind: seenset.KIND_DISK, Dir: filepath.Join(dir, "seen")}
+	// 停止时保存的检查点会把集合中的数据刷入磁盘。
+	dataArgs.CheckpointPath = filepath.Join(dir, "checkpoint.json")
+	// 第二次从头开始爬取时不能受到第一次爬取留下的URL的影响。
+	for i := 0; i < 2; i++ {
+		var picked int64
+		sched := startTestScheduler(t, RequestArgs{}, dataArgs, testModules(t, &picked), site.URL+"/page/0")
+		waitTestScheduler(t, sched, 30*time.Second)
+		if n := atomic.LoadInt64(&picked); n != 10 {
+			t.Fatalf("crawl %d: picked %d items, want 10", i+1, n)
+		}
+		if err := sched.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/cookiejar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// defaultMaxRelogins 默认的最多连续重新登录的次数。
+const defaultMaxRelogins = 3
+
+// SessionSummaryStruct 会话的摘要类型。
+type SessionSummaryStruct struct {
+	// Enabled 是否启用了会话。
+	Enabled bool `json:"enabled"`
+	// Partitions Cookie存储器中的分区的数量。
+	Partitions int `json:"partitions"`
+	// Logins 登录成功的次数，包括重新登录。
+	Logins uint64 `json:"logins"`
+	// Relogins 因检测到已登出而重新登录的次数。
+	Relogins uint64 `json:"relogins"`
+	// LoginFailures 登录失败的次数。
+	LoginFailures uint64 `json:"login_failures"`
+}
+
+// session 爬取范围内的会话的类型。
+type session struct {
+	// jar 所有下载器共享的Cookie存储器。
+	jar cookiejar.Jar
+	// login 登录相关的参数。为nil时表示不登录。
+	login *LoginArgs
+	// maxRelogins 最多连续重新登录的次数。
+	maxRelogins uint64
+	// generation 登录的代数。每次登录成功后都会加1。
+	generation uint64
+	// logins 登录成功的次数。
+	logins uint64
+	// relogins 重新登录的次数。
+	relogins uint64
+	// consecutive 连续重新登录的次数，包括失败的重新登录。
+	// 在重新登录之后下载到正常的响应时清零。
+	consecutive uint64
+	// failures 登录失败的次数。
+	failures uint64
+	// lock 保证同一时刻最多只有一个登录请求，并保护以上字段。
+	lock sync.Mutex
+}
+
+// newSession 根据给定的参数创建会话。未启用会话时返回nil。
+func newSession(args SessionArgs) *session {
+	if !args.Enabled {
+		return nil
+	}
+	s := &session{
+		jar:   cookiejar.New(args.Isolated),
+		login: args.Login,
+	}
+	if args.Login != nil {
+		s.maxRelogins = uint64(args.Login.MaxRelogins)
+		if s.maxRelogins == 0 {
+			s.maxRelogins = defaultMaxRelogins
+		}
+	}
+	return s
+}
+
+// Generation 获取当前登录的代数。
+// 会话为nil时返回0。
+func (s *session) Generation() uint64 {
+	if s == nil {
+		return 0
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.generation
+}
+
+// Login 通过给定的下载器登录。未设置登录参数时什么也不做。
+func (s *session) Login(downloader module.Downloader) error {
+	if s == nil || s.login == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.doLogin(downloader)
+}
+
+// Relogin 通过给定的下载器重新登录。
+// 参数generation 发现已登出时的登录代数。
+// 若在此之后已经有其他下载重新登录过，则不会再次登录。
+// 连续重新登录的次数达到上限时也不会再次登录。
+// 结果值为true时表示已经重新登录，可以重新下载。
+func (s *session) Relogin(downloader module.Downloader, generation uint64) (bool, error) {
+	if s == nil || s.login == nil {
+		return false, nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.generation != generation {
+		return true, nil
+	}
+	if s.consecutive >= s.maxRelogins {
+		return false, nil
+	}
+	s.relogins++
+	s.consecutive++
+	if err := s.doLogin(downloader); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Confirm 在以给定的登录代数下载到正常的响应时调用。
+// 若该代数即为当前的登录代数，则说明最近一次登录有效，连续重新登录的次数会被清零。
+func (s *session) Confirm(generation uint64) {
+	if s == nil || s.login == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.generation == generation {
+		s.consecutive = 0
+	}
+}
+
+// doLogin 执行登录请求。调用方需要持有锁。
+func (s *session) doLogin(downloader module.Downloader) error {
+	httpReq, err := s.newLoginRequest()
+	if err != nil {
+		s.failures++
+		return genError(fmt.Sprintf("couldn't create the login request: %s", err))
+	}
+	fmt.Printf("Log in... (URL: %s)\n", httpReq.URL)
+	resp, err := downloader.Download(module.NewRequest(httpReq, 0))
+	if err != nil {
+		s.failures++
+		return genError(fmt.Sprintf("couldn't log in: %s", err))
+	}
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.HTTPResp()
+	}
+	if httpResp == nil {
+		s.failures++
+		return genError("couldn't log in: nil HTTP response")
+	}
+	if httpResp.Body != nil {
+		io.Copy(ioutil.Discard, httpResp.Body)
+		httpResp.Body.Close()
+	}
+	if httpResp.StatusCode >= 400 {
+		s.failures++
+		return genError(fmt.Sprintf("couldn't log in: status code %d", httpResp.StatusCode))
+	}
+	s.generation++
+	s.logins++
+	fmt.Printf("Logged in. (URL: %s)\n", httpReq.URL)
+	return nil
+}
+
+// newLoginRequest 创建登录请求。
+func (s *session) newLoginRequest() (*http.Request, error) {
+	method := s.login.Method
+	if method == "" {
+		method = "POST"
+	}
+	var body io.Reader
+	var contentType string
+	switch {
+	case s.login.Form != nil:
+		body = strings.NewReader(s.login.Form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	case s.login.JSON != nil:
+		body = bytes.NewReader(s.login.JSON)
+		contentType = "application/json"
+	}
+	httpReq, err := http.NewRequest(method, s.login.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range s.login.Header {
+		httpReq.Header[key] = values
+	}
+	if contentType != "" && httpReq.Header.Get("Content-Type") == "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	return httpReq, nil
+}
+
+// LoggedOut 判断给定的响应是否代表已登出。
+func (s *session) LoggedOut(httpResp *http.Response) bool {
+	if s == nil || s.login == nil || httpResp == nil {
+		return false
+	}
+	for _, code := range s.login.LoggedOutStatus {
+		if httpResp.StatusCode == code {
+			return true
+		}
+	}
+	if httpResp.Request != nil {
+		return s.LoggedOutURL(httpResp.Request.URL)
+	}
+	return false
+}
+
+// LoggedOutURL 判断给定的URL是否以已登出的URL前缀开头。
+func (s *session) LoggedOutURL(u *url.URL) bool {
+	if s == nil || s.login == nil || u == nil {
+		return false
+	}
+	prefix := s.login.LoggedOutURLPrefix
+	return prefix != "" && strings.HasPrefix(u.String(), prefix)
+}
+
+// Summary 获取会话的摘要信息。
+func (s *session) Summary() SessionSummaryStruct {
+	if s == nil {
+		return SessionSummaryStruct{}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return SessionSummaryStruct{
+		Enabled:       true,
+		Partitions:    len(s.jar.Partitions()),
+		Logins:        s.logins,
+		Relogins:      s.relogins,
+		LoginFailures: s.failures,
+	}
+}
+
+// shareCookieJar 让所有已注册的下载器共享会话中的Cookie存储器。
+func (sched *myScheduler) shareCookieJar() error {
+	if sched.session == nil {
+		return nil
+	}
+	downloaders, err := sched.registrar.GetAllByType(module.TYPE_DOWNLOADER)
+	if err != nil {
+		return err
+	}
+	for mid, m := range downloaders {
+		user, ok := m.(module.CookieJarUser)
+		if !ok {
+			fmt.Printf("The downloader couldn't use the shared cookie jar. (MID: %s)\n", mid)
+			continue
+		}
+		user.SetCookieJar(sched.session.jar)
+	}
+	return nil
+}
+
+// login 在爬取开始之前登录。
+func (sched *myScheduler) login() error {
+	if sched.session == nil || sched.session.login == nil {
+		return nil
+	}
+	m, err := sched.registrar.Get(module.TYPE_DOWNLOADER)
+	if err != nil || m == nil {
+		return genError(fmt.Sprintf("couldn't get a downloader for login: %s", err))
+	}
+	downloader, ok := m.(module.Downloader)
+	if !ok {
+		return genError(fmt.Sprintf("incorrect downloader type: %T (MID: %s)", m, m.ID()))
+	}
+	return sched.session.Login(downloader)
+}
+
+// relogin 在下载到代表已登出的响应时重新登录，并重新放入相应的请求。
+// 下载到正常的响应时则会向会话确认当前的登录有效。
+// 参数generation 开始下载时的登录代数。
+// 结果值为true时表示响应已被丢弃，无需再做其他处理。
+func (sched *myScheduler) relogin(req *module.Request, resp *module.Response,
+	generation uint64, downloader module.Downloader) bool {
+	if resp == nil || resp.HTTPResp() == nil {
+		return false
+	}
+	if !sched.session.LoggedOut(resp.HTTPResp()) {
+		if resp.HTTPResp().StatusCode < 400 {
+			sched.session.Confirm(generation)
+		}
+		return false
+	}
+	ok, err := sched.session.Relogin(downloader, generation)
+	if err != nil {
+		sendError(err, "", sched.errorBufferPool, sched.flights)
+	}
+	if !ok {
+		return false
+	}
+	httpResp := resp.HTTPResp()
+	if httpResp.Body != nil {
+		io.Copy(ioutil.Discard, httpResp.Body)
+		httpResp.Body.Close()
+	}
+	fmt.Printf("Download the request again after logging in. (URL: %s)\n",
+		req.HTTPReq().URL)
+	// HTTP客户端会把Cookie存储器中的Cookie直接添加到原请求的头部，
+	// 因此需要去掉旧的Cookie，以便使用重新登录之后的Cookie。
+	httpReq := req.HTTPReq().Clone(req.HTTPReq().Context())
+	httpReq.Header.Del("Cookie")
+	// 未能重新放入的请求不会再被处理，调度器停止时除外，那时它会被保留在检查点中。
+	if !sched.admitReq(req.WithHTTPReq(httpReq), admitRetry) && !sched.canceled() {
+		sched.forgetReq(req.HTTPReq().URL.String())
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/module/local/downloader"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newSessionSite 创建一个需要登录的测试站点，每个会话只能访问给定数量的页面。
+// 页面的组织方式与newTestSite相同。
+func newSessionSite(pages int, pagesPerSession int) (*httptest.Server, *int64) {
+	var logins int64
+	var lock sync.Mutex
+	served := map[string]int{}
+	handler := testSiteHandler(pages)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			r.ParseForm()
+			if r.PostForm.Get("user") != "bob" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			sid := strconv.FormatInt(atomic.AddInt64(&logins, 1), 10)
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: sid, Path: "/"})
+			return
+		}
+		cookie, err := r.Cookie("sid")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		lock.Lock()
+		expired := served[cookie.Value] >= pagesPerSession
+		if !expired {
+			served[cookie.Value]++
+		}
+		lock.Unlock()
+		if expired {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	return srv, &logins
+}
+
+func testSessionArgs(loginURL string) SessionArgs {
+	return SessionArgs{
+		Enabled: true,
+		Login: &LoginArgs{
+			URL:             loginURL,
+			Form:            url.Values{"user": {"bob"}},
+			LoggedOutStatus: []int{http.StatusUnauthorized},
+		},
+	}
+}
+
+func TestSessionReloginRepeatedly(t *testing.T) {
+	site, logins := newSessionSite(20, 4)
+	defer site.Close()
+	var picked int64
+	dataArgs := testDataArgs()
+	dataArgs.DownloadWorkers = 1
+	requestArgs := RequestArgs{Session: testSessionArgs(site.URL + "/login")}
+	sched := startTestScheduler(t, requestArgs, dataArgs, testModules(t, &picked), site.URL+"/page/0")
+	waitTestScheduler(t, sched, 30*time.Second)
+	if n := atomic.LoadInt64(&picked); n != 20 {
+		t.Fatalf("picked %d items, want 20", n)
+	}
+	summary := sched.(*myScheduler).session.Summary()
+	if summary.Relogins <= defaultMaxRelogins {
+		t.Fatalf("relogins %d, want more than %d", summary.Relogins, defaultMaxRelogins)
+	}
+	if summary.Logins != uint64(atomic.LoadInt64(logins)) {
+		t.Fatalf("logins %d, want %d", summary.Logins, atomic.LoadInt64(logins))
+	}
+}
+
+func TestSessionConsecutiveRelogins(t *testing.T) {
+	site, _ := newSessionSite(1, 0)
+	defer site.Close()
+	s := newSession(testSessionArgs(site.URL + "/login"))
+	var picked int64
+	d := testModules(t, &picked).Downloaders[0]
+	if err := s.Login(d); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < defaultMaxRelogins; i++ {
+		ok, err := s.Relogin(d, s.Generation())
+		if !ok || err != nil {
+			t.Fatalf("relogin %d: %v, %v", i+1, ok, err)
+		}
+	}
+	if ok, _ := s.Relogin(d, s.Generation()); ok {
+		t.Fatal("relogged in beyond the limit")
+	}
+	// 以过期的登录代数确认不会清零。
+	s.Confirm(s.Generation() - 1)
+	if ok, _ := s.Relogin(d, s.Generation()); ok {
+		t.Fatal("a stale confirmation reset the relogin limit")
+	}
+	s.Confirm(s.Generation())
+	if ok, err := s.Relogin(d, s.Generation()); !ok || err != nil {
+		t.Fatalf("couldn't relogin after a good response: %v", err)
+	}
+	summary := s.Summary()
+	if summary.Relogins != defaultMaxRelogins+1 || summary.Logins != defaultMaxRelogins+2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+}
+
+func TestSessionLoggedOut(t *testing.T) {
+	s := newSession(SessionArgs{Enabled: true, Login: &LoginArgs{
+		URL:                "https://a.com/login",
+		LoggedOutStatus:    []int{http.StatusUnauthorized},
+		LoggedOutURLPrefix: "https://a.com/login",
+	}})
+	for _, tc := range []struct {
+		status int
+		url    string
+		want   bool
+	}{
+		{http.StatusOK, "https://a.com/page", false},
+		{http.StatusUnauthorized, "https://a.com/page", true},
+		{http.StatusOK, "https://a.com/login?next=/page", true},
+	} {
+		httpReq, _ := http.NewRequest("GET", tc.url, nil)
+		httpResp := &http.Response{StatusCode: tc.status, Request: httpReq}
+		if got := s.LoggedOut(httpResp); got != tc.want {
+			t.Errorf("%d %s: logged out %v, want %v", tc.status, tc.url, got, tc.want)
+		}
+	}
+	var nilSession *session
+	if nilSession.LoggedOut(&http.Response{StatusCode: http.StatusUnauthorized}) {
+		t.Error("a nil session is logged out")
+	}
+	nilSession.Confirm(0)
+}
+
+func TestSessionSummaryRedactsLogin(t *testing.T) {
+	site, _ := newSessionSite(3, 10)
+	defer site.Close()
+	requestArgs := RequestArgs{Session: testSessionArgs(site.URL + "/login")}
+	requestArgs.Session.Login.Form = url.Values{"user": {"bob"}, "password": {"hunter2"}}
+	requestArgs.Session.Login.Header = http.Header{"Authorization": {"Bearer s3cret"}}
+	var picked int64
+	sched := startTestScheduler(t, requestArgs, testDataArgs(), testModules(t, &picked), site.URL+"/page/0")
+	summary := sched.Summary().String()
+	for _, secret := range []string{"hunter2", "s3cret", "bob"} {
+		if strings.Contains(summary, secret) {
+			t.Errorf("the summary contains %q", secret)
+		}
+	}
+	if !strings.Contains(summary, "password") {
+		t.Error("the summary lost the login form keys")
+	}
+	if requestArgs.Session.Login.Form.Get("password") != "hunter2" {
+		t.Error("the login arguments were modified")
+	}
+	data := LoginArgs{JSON: []byte(`{"password":"hunter2"}`)}.Redacted().JSON
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("the JSON login data wasn't redacted")
+	}
+}
+
+func TestSessionSharedByDownloaders(t *testing.T) {
+	site, logins := newSessionSite(10, 100)
+	defer site.Close()
+	var picked int64
+	moduleArgs := testModules(t, &picked)
+	mid, _ := module.GenMID(module.TYPE_DOWNLOADER, 4, nil)
+	second, err := downloader.New(mid, &http.Client{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moduleArgs.Downloaders = append(moduleArgs.Downloaders, second)
+	requestArgs := RequestArgs{Session: testSessionArgs(site.URL + "/login")}
+	sched := startTestScheduler(t, requestArgs, testDataArgs(), moduleArgs, site.URL+"/page/0")
+	waitTestScheduler(t, sched, 30*time.Second)
+	// 只登录了一次，之后两个下载器都带着同一会话的Cookie下载了页面。
+	if n := atomic.LoadInt64(&picked); n != 10 {
+		t.Fatalf("picked %d items, want 10", n)
+	}
+	if n := atomic.LoadInt64(logins); n != 1 {
+		t.Fatalf("logged in %d times, want 1", n)
+	}
+	for _, summary := range sched.Summary().Struct().Downloaders {
+		if summary.Completed < 2 {
+			t.Fatalf("the downloader %s completed %d downloads", summary.ID, summary.Completed)
+		}
+	}
+}
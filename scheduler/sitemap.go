@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/toolkit/sitemap"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// defaultMaxSitemaps 默认的最多获取的站点地图的数量。
+const defaultMaxSitemaps = 100
+
+// SitemapSummaryStruct 站点地图发现的摘要类型。
+type SitemapSummaryStruct struct {
+	// Enabled 是否启用了站点地图发现。
+	Enabled bool `json:"enabled"`
+	// Fetched 获取站点地图的次数。
+	Fetched uint64 `json:"fetched"`
+	// FetchError 获取或解析站点地图失败的次数。
+	FetchError uint64 `json:"fetch_error"`
+	// Seeded 从站点地图中放入的初始请求的数量。
+	Seeded uint64 `json:"seeded"`
+}
+
+// sitemapSeeder 站点地图发现器的类型。
+// 它会在启动时获取站点的站点地图，并把其中的页面作为初始请求。
+type sitemapSeeder struct {
+	// args 站点地图相关的参数。
+	args SitemapArgs
+	// fetched 获取站点地图的计数。
+	fetched uint64
+	// fetchError 获取或解析站点地图失败的计数。
+	fetchError uint64
+	// seeded 放入的初始请求的计数。
+	seeded uint64
+}
+
+// newSitemapSeeder 根据给定的参数创建站点地图发现器。未启用时返回nil。
+func newSitemapSeeder(args SitemapArgs) *sitemapSeeder {
+	if !args.Discover {
+		return nil
+	}
+	if args.MaxSitemaps == 0 {
+		args.MaxSitemaps = defaultMaxSitemaps
+	}
+	return &sitemapSeeder{args: args}
+}
+
+// Summary 获取站点地图发现的摘要信息。
+func (seeder *sitemapSeeder) Summary() SitemapSummaryStruct {
+	if seeder == nil {
+		return SitemapSummaryStruct{}
+	}
+	return SitemapSummaryStruct{
+		Enabled:    true,
+		Fetched:    atomic.LoadUint64(&seeder.fetched),
+		FetchError: atomic.LoadUint64(&seeder.fetchError),
+		Seeded:     atomic.LoadUint64(&seeder.seeded),
+	}
+}
+
+// seedFromSitemaps 发现给定URL所在站点的站点地图，并把其中的页面作为初始请求放入。
+// 站点地图来自该站点的robots.txt中的声明以及/sitemap.xml，站点地图索引会被逐层展开。
+// 未启用站点地图发现时什么也不做。
+func (sched *myScheduler) seedFromSitemaps(siteURL *url.URL) {
+	seeder := sched.sitemaps
+	if seeder == nil {
+		return
+	}
+	hostURL := &url.URL{Scheme: siteURL.Scheme, Host: siteURL.Host}
+	robotsCache := sched.robots
+	if robotsCache == nil {
+		// 不遵守robots.txt时仍然需要从中获取站点地图的声明。
+		robotsCache = newRobotsCache(RobotsArgs{}, sched.registrar, sched.politeness)
+	}
+	queue := robotsCache.Robots(sched.ctx, hostURL).Sitemaps()
+	queue = append(queue, hostURL.String()+"/sitemap.xml")
+	visited := map[string]struct{}{}
+	for len(queue) > 0 && uint32(len(visited)) < seeder.args.MaxSitemaps {
+		if sched.canceled() {
+			return
+		}
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		if _, ok := visited[sitemapURL]; ok {
+			continue
+		}
+		visited[sitemapURL] = struct{}{}
+		parsed, err := sched.fetchSitemap(sitemapURL)
+		if err != nil {
+			fmt.Printf("Couldn't get the sitemap: %s (URL: %s)\n", err, sitemapURL)
+			atomic.AddUint64(&seeder.fetchError, 1)
+			continue
+		}
+		if parsed == nil {
+			continue
+		}
+		if parsed.Index {
+			for _, entry := range parsed.Entries {
+				queue = append(queue, entry.Loc)
+			}
+			continue
+		}
+		for _, entry := range parsed.Entries {
+			if seeder.args.MaxURLs > 0 &&
+				atomic.LoadUint64(&seeder.seeded) >= seeder.args.MaxURLs {
+				return
+			}
+			httpReq, err := http.NewRequest("GET", entry.Loc, nil)
+			if err != nil {
+				continue
+			}
+			req := module.NewRequest(httpReq, 0)
+			req.SetPriority(entry.Priority)
+			req.SetLastModified(entry.LastMod)
+			if sched.sendReq(req) {
+				atomic.AddUint64(&seeder.seeded, 1)
+			}
+		}
+	}
+}
+
+// fetchSitemap 通过已注册的下载器获取并解析给定的站点地图。
+// 获取时会遵守礼貌爬取的规则，并受每次下载的超时时间的限制。
+// 站点地图不存在或者内容不是站点地图时，两个结果值都为nil。
+func (sched *myScheduler) fetchSitemap(sitemapURL string) (*sitemap.Sitemap, error) {
+	atomic.AddUint64(&sched.sitemaps.fetched, 1)
+	m, err := sched.registrar.Get(module.TYPE_DOWNLOADER)
+	if err != nil || m == nil {
+		return nil, genError(fmt.Sprintf("couldn't get a downloader: %s", err))
+	}
+	downloader, ok := m.(module.Downloader)
+	if !ok {
+		return nil, genError(fmt.Sprintf("incorrect downloader type: %T (MID: %s)", m, m.ID()))
+	}
+	httpReq, err := http.NewRequest("GET", sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	release, err := sched.politeness.Acquire(sched.ctx, httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	req := module.NewRequest(httpReq, 0)
+	dc := sched.newDownloadContext()
+	resp, err := downloader.Download(req.WithContext(dc.ctx))
+	if err = dc.finish(req, resp, err); err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.HTTPResp() == nil {
+		return nil, genError("nil HTTP response")
+	}
+	httpResp := resp.HTTPResp()
+	if httpResp.Body == nil {
+		return nil, genError("nil HTTP response body")
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, httpResp.Body)
+		httpResp.Body.Close()
+	}()
+	if httpResp.StatusCode == http.StatusNotFound || httpResp.StatusCode == http.StatusGone {
+		return nil, nil
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return nil, genError(fmt.Sprintf("status code %d", httpResp.StatusCode))
+	}
+	parsed, err := sitemap.Parse(httpResp.Body)
+	if err == sitemap.ErrNotSitemap {
+		return nil, nil
+	}
+	return parsed, err
+}
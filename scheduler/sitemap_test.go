@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSitemapFetchesArePolite(t *testing.T) {
+	const sitemaps = 4
+	const minDelay = 100 * time.Millisecond
+	var lock sync.Mutex
+	var fetchTimes []time.Time
+	var site *httptest.Server
+	site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/robots.txt":
+			for i := 0; i < sitemaps; i++ {
+				fmt.Fprintf(w, "Sitemap: %s/sitemap-%d.xml\n", site.URL, i)
+			}
+		case r.URL.Path == "/sitemap-0.xml":
+			// 超时的站点地图不应妨碍获取其余的站点地图。
+			select {
+			case <-time.After(10 * time.Second):
+			case <-r.Context().Done():
+			}
+		case strings.HasPrefix(r.URL.Path, "/sitemap-"):
+			lock.Lock()
+			fetchTimes = append(fetchTimes, time.Now())
+			lock.Unlock()
+			var n int
+			fmt.Sscanf(r.URL.Path, "/sitemap-%d.xml", &n)
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`+
+				`<url><loc>%s/page/%d</loc></url></urlset>`, site.URL, 10+n)
+		default:
+			testSiteHandler(1).ServeHTTP(w, r)
+		}
+	}))
+	defer site.Close()
+	requestArgs := RequestArgs{
+		Politeness:      PolitenessArgs{Default: PolitenessRule{MinDelay: minDelay}},
+		Sitemap:         SitemapArgs{Discover: true},
+		DownloadTimeout: time.Second,
+	}
+	var picked int64
+	sched := startTestScheduler(t, requestArgs, testDataArgs(), testModules(t, &picked), site.URL+"/page/0")
+	waitTestScheduler(t, sched, 30*time.Second)
+	lock.Lock()
+	defer lock.Unlock()
+	if len(fetchTimes) != sitemaps-1 {
+		t.Fatalf("fetched %d sitemaps, want %d", len(fetchTimes), sitemaps-1)
+	}
+	for i := 1; i < len(fetchTimes); i++ {
+		// 留出一些余量以免计时误差导致测试不稳定。
+		if gap := fetchTimes[i].Sub(fetchTimes[i-1]); gap < minDelay-10*time.Millisecond {
+			t.Errorf("sitemaps fetched %s apart, want at least %s", gap, minDelay)
+		}
+	}
+	summary := sched.(*myScheduler).sitemaps.Summary()
+	if summary.FetchError != 1 || summary.Seeded != sitemaps-1 {
+		t.Fatalf("unexpected sitemap summary: %+v", summary)
+	}
+	if n := atomic.LoadInt64(&picked); n != sitemaps {
+		t.Fatalf("picked %d items, want %d", n, sitemaps)
+	}
+}
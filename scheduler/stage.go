@@ -0,0 +1,176 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/toolkit/buffer"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stage 代表流水线中的一个处理阶段（下载、分析或条目处理）。
+// 同一阶段的多个工作者从同一个缓冲池中获取数据。
+type stage struct {
+	// workers 工作者的数量。
+	workers uint32
+	// busy 正在处理数据的工作者的数量。
+	busy int64
+	// processed 已处理的数据的数量。
+	processed uint64
+	// busyNanos 所有工作者处理数据所用的总时长（纳秒）。
+	busyNanos int64
+	// startNanos 阶段开始运行的时间（Unix纳秒）。
+	startNanos int64
+	// idleCh 在所有工作者都处理完手头的数据时被关闭的通道。
+	// 为nil时表示没有正在处理数据的工作者。
+	idleCh chan struct{}
+	// idleLock 保护idleCh的互斥锁。
+	idleLock sync.Mutex
+}
+
+// newStage 创建一个处理阶段。
+// 参数workers为0时只会运行一个工作者。
+func newStage(workers uint32) *stage {
+	if workers == 0 {
+		workers = 1
+	}
+	return &stage{workers: workers}
+}
+
+// Workers 获取工作者的数量。
+func (s *stage) Workers() uint32 {
+	return s.workers
+}
+
+// start 标记阶段开始运行。
+func (s *stage) start() {
+	atomic.StoreInt64(&s.startNanos, time.Now().UnixNano())
+}
+
+// process 以工作者的身份处理一个数据，并记录相应的统计信息。
+func (s *stage) process(datum interface{}, handle func(datum interface{})) {
+	s.idleLock.Lock()
+	if atomic.AddInt64(&s.busy, 1) == 1 {
+		s.idleCh = make(chan struct{})
+	}
+	s.idleLock.Unlock()
+	begin := time.Now()
+	defer func() {
+		atomic.AddInt64(&s.busyNanos, int64(time.Since(begin)))
+		atomic.AddUint64(&s.processed, 1)
+		s.idleLock.Lock()
+		if atomic.AddInt64(&s.busy, -1) == 0 {
+			close(s.idleCh)
+			s.idleCh = nil
+		}
+		s.idleLock.Unlock()
+	}()
+	handle(datum)
+}
+
+// waitIdle 等待所有工作者都处理完手头的数据。
+// 若给定的上下文先结束，则结果值为false。
+func (s *stage) waitIdle(ctx context.Context) bool {
+	s.idleLock.Lock()
+	idleCh := s.idleCh
+	s.idleLock.Unlock()
+	if idleCh == nil {
+		return true
+	}
+	select {
+	case <-idleCh:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Busy 获取正在处理数据的工作者的数量。
+func (s *stage) Busy() int64 {
+	return atomic.LoadInt64(&s.busy)
+}
+
+// Summary 获取阶段的摘要信息。
+func (s *stage) Summary() StageSummaryStruct {
+	summary := StageSummaryStruct{
+		Workers:   s.workers,
+		Busy:      uint32(atomic.LoadInt64(&s.busy)),
+		Processed: atomic.LoadUint64(&s.processed),
+		BusyTime:  time.Duration(atomic.LoadInt64(&s.busyNanos)),
+	}
+	startNanos := atomic.LoadInt64(&s.startNanos)
+	if startNanos > 0 {
+		elapsed := time.Now().UnixNano() - startNanos
+		if elapsed > 0 {
+			summary.Utilization = float64(summary.BusyTime) /
+				(float64(elapsed) * float64(s.workers))
+			if summary.Utilization > 1 {
+				summary.Utilization = 1
+			}
+		}
+	}
+	return summary
+}
+
+// StageSummaryStruct 处理阶段的摘要类型。
+type StageSummaryStruct struct {
+	// Workers 工作者的数量。
+	Workers uint32 `json:"workers"`
+	// Busy 正在处理数据的工作者的数量。
+	Busy uint32 `json:"busy"`
+	// Processed 已处理的数据的数量。
+	Processed uint64 `json:"processed"`
+	// BusyTime 所有工作者处理数据所用的总时长。
+	BusyTime time.Duration `json:"busy_time"`
+	// Utilization 工作者的利用率，即处理数据的时长占全部工作者运行时长的比例。
+	Utilization float64 `json:"utilization"`
+}
+
+// StagesSummaryStruct 各个处理阶段的摘要类型。
+type StagesSummaryStruct struct {
+	Download StageSummaryStruct `json:"download"`
+	Analyze  StageSummaryStruct `json:"analyze"`
+	Pick     StageSummaryStruct `json:"pick"`
+}
+
+// getStageSummary 生成和返回某个处理阶段的摘要信息。
+func getStageSummary(s *stage) StageSummaryStruct {
+	if s == nil {
+		return StageSummaryStruct{}
+	}
+	return s.Summary()
+}
+
+// startWorkers 为给定的阶段启动相应数量的工作者。
+// 每个工作者都会不断地从给定的缓冲池中获取数据并交给handle处理，
+// 直到调度器被停止或缓冲池被关闭。
+// 调度器被暂停时，工作者会在获取新数据之前等待。
+// 数据被处理完毕后不再算作在途数据。
+// 参数name为缓冲池中数据的名称，仅用于日志。
+func (sched *myScheduler) startWorkers(
+	s *stage, pool buffer.Pool, name string, handle func(datum interface{})) {
+	s.start()
+	for i := uint32(0); i < s.workers; i++ {
+		go func() {
+			for {
+				if sched.canceled() || !sched.pauseGate.Wait(sched.ctx) {
+					break
+				}
+				datum, err := pool.Get()
+				// 缓冲池被关闭时也可能返回nil而不是错误值。
+				if err != nil || datum == nil {
+					fmt.Printf("The %s buffer pool was closed. Break %s reception.\n", name, name)
+					break
+				}
+				// 在等待数据期间调度器可能已被暂停。
+				if !sched.pauseGate.Wait(sched.ctx) {
+					sched.flights.Done()
+					break
+				}
+				s.process(datum, handle)
+				sched.flights.Done()
+			}
+		}()
+	}
+}
@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/toolkit/buffer"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStageProcess(t *testing.T) {
+	if n := newStage(0).Workers(); n != 1 {
+		t.Fatalf("%d workers for zero, want 1", n)
+	}
+	s := newStage(3)
+	s.start()
+	if !s.waitIdle(context.Background()) {
+		t.Fatal("an unused stage is not idle")
+	}
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(2)
+	for i := 0; i < 2; i++ {
+		go s.process(i, func(datum interface{}) {
+			started.Done()
+			<-release
+		})
+	}
+	started.Wait()
+	if n := s.Busy(); n != 2 {
+		t.Fatalf("%d busy workers, want 2", n)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if s.waitIdle(ctx) {
+		t.Fatal("the stage is idle while processing")
+	}
+	time.Sleep(30 * time.Millisecond)
+	close(release)
+	if !s.waitIdle(context.Background()) {
+		t.Fatal("the stage never became idle")
+	}
+	summary := s.Summary()
+	if summary.Workers != 3 || summary.Busy != 0 || summary.Processed != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	// 两个工作者各忙碌了至少50毫秒。
+	if summary.BusyTime < 100*time.Millisecond {
+		t.Fatalf("busy time %s, want at least 100ms", summary.BusyTime)
+	}
+	if summary.Utilization <= 0 || summary.Utilization > 1 {
+		t.Fatalf("utilization %f out of range", summary.Utilization)
+	}
+}
+
+func TestStartWorkers(t *testing.T) {
+	const workers = 4
+	pool, err := buffer.NewPool(10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sched := &myScheduler{flights: newInFlight(), pauseGate: newPauseGate()}
+	sched.ctx, sched.cancelFunc = context.WithCancel(context.Background())
+	defer func() {
+		sched.cancelFunc()
+		pool.Close()
+	}()
+	for i := 0; i < workers; i++ {
+		pool.Put(i)
+	}
+	// 所有数据都在同一时间被处理时，每个工作者各处理一个数据。
+	var started sync.WaitGroup
+	started.Add(workers)
+	release := make(chan struct{})
+	s := newStage(workers)
+	sched.startWorkers(s, pool, "test", func(datum interface{}) {
+		started.Done()
+		<-release
+	})
+	allStarted := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(allStarted)
+	}()
+	select {
+	case <-allStarted:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("only %d workers ran at the same time", s.Summary().Busy)
+	}
+	close(release)
+}
+
+func TestDownloadWorkersRunInParallel(t *testing.T) {
+	const workers = 4
+	var current, peak int64
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/page/") && r.URL.Path != "/page/0" {
+			n := atomic.AddInt64(&current, 1)
+			defer atomic.AddInt64(&current, -1)
+			for {
+				p := atomic.LoadInt64(&peak)
+				if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(200 * time.Millisecond)
+			w.Header().Set("Content-Type", "text/html")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/page/0" {
+			w.Write([]byte(`<html><a href="/page/1">1</a><a href="/page/2">2</a>` +
+				`<a href="/page/3">3</a><a href="/page/4">4</a></html>`))
+		}
+	}))
+	defer site.Close()
+	dataArgs := testDataArgs()
+	dataArgs.DownloadWorkers = workers
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, dataArgs, testModules(t, &picked), site.URL+"/page/0")
+	waitTestScheduler(t, sched, 20*time.Second)
+	if n := atomic.LoadInt64(&picked); n != 5 {
+		t.Fatalf("picked %d items, want 5", n)
+	}
+	// 只有一个工作者时同时进行的下载不会超过一个。
+	if p := atomic.LoadInt64(&peak); p < 2 {
+		t.Fatalf("at most %d downloads ran at the same time", p)
+	}
+	download := sched.Summary().Struct().Stages.Download
+	if download.Workers != workers || download.Processed < 5 {
+		t.Fatalf("unexpected download stage summary: %+v", download)
+	}
+}
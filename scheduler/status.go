@@ -23,6 +23,10 @@ const (
 	SCHED_STATUS_STOPPING Status = 5
 	// SCHED_STATUS_STOPPED 已停止。
 	SCHED_STATUS_STOPPED Status = 6
+	// SCHED_STATUS_PAUSING 正在暂停。
+	SCHED_STATUS_PAUSING Status = 7
+	// SCHED_STATUS_PAUSED 已暂停。
+	SCHED_STATUS_PAUSED Status = 8
 )
 
 // GetStatusDescription 获取状态的文字描述。
@@ -42,6 +46,10 @@ func GetStatusDescription(status Status) string {
 		return "stopping"
 	case SCHED_STATUS_STOPPED:
 		return "stopped"
+	case SCHED_STATUS_PAUSING:
+		return "pausing"
+	case SCHED_STATUS_PAUSED:
+		return "paused"
 	default:
 		return "unknown"
 	}
@@ -51,11 +59,13 @@ func GetStatusDescription(status Status) string {
 // 参数currentStatus 当前的状态。
 // 参数wantedStatus 想要的状态。
 // 检查规则：
-//     1. 正在初始化、正在启动、正在停止，不能从外部改变状态。
-//     2. 想要的状态只能是正在初始化、正在启动、正在停止状态中的一个。
+//     1. 正在初始化、正在启动、正在停止，不能从外部改变状态；正在暂停时只能变为正在停止状态。
+//     2. 想要的状态只能是正在初始化、正在启动、正在停止、正在暂停、已启动状态中的一个。
 //     3. 处于未初始化状态时，不能变为正在启动或正在停止状态。
-//     4. 处于已启动状态时，不能变为正在初始化或正在启动状态。
-//     5. 只要未处于已启动状态，就不能变为正在停止状态。
+//     4. 处于已启动或已暂停状态时，不能变为正在初始化或正在启动状态。
+//     5. 只要未处于已启动、正在暂停或已暂停状态，就不能变为正在停止状态。
+//     6. 只要未处于已启动状态，就不能变为正在暂停状态。
+//     7. 只要未处于已暂停状态，就不能变为已启动状态（即恢复运行）。
 func checkStatus(
 	currentStatus Status,
 	wantedStatus Status,
@@ -71,6 +81,10 @@ func checkStatus(
 		err = genError("the scheduler is being started!")
 	case SCHED_STATUS_STOPPING:
 		err = genError("the scheduler is being stopped!")
+	case SCHED_STATUS_PAUSING:
+		if wantedStatus != SCHED_STATUS_STOPPING {
+			err = genError("the scheduler is being paused!")
+		}
 	}
 	if err != nil {
 		return
@@ -86,6 +100,8 @@ func checkStatus(
 		switch currentStatus {
 		case SCHED_STATUS_STARTED:
 			err = genError("the scheduler has been started!")
+		case SCHED_STATUS_PAUSED:
+			err = genError("the scheduler has been paused!")
 		}
 	case SCHED_STATUS_STARTING:
 		switch currentStatus {
@@ -93,11 +109,23 @@ func checkStatus(
 			err = genError("the scheduler has not been initialized!")
 		case SCHED_STATUS_STARTED:
 			err = genError("the scheduler has been started!")
+		case SCHED_STATUS_PAUSED:
+			err = genError("the scheduler has been paused!")
 		}
 	case SCHED_STATUS_STOPPING:
+		if currentStatus != SCHED_STATUS_STARTED &&
+			currentStatus != SCHED_STATUS_PAUSING &&
+			currentStatus != SCHED_STATUS_PAUSED {
+			err = genError("the scheduler has not been started!")
+		}
+	case SCHED_STATUS_PAUSING:
 		if currentStatus != SCHED_STATUS_STARTED {
 			err = genError("the scheduler has not been started!")
 		}
+	case SCHED_STATUS_STARTED:
+		if currentStatus != SCHED_STATUS_PAUSED {
+			err = genError("the scheduler has not been paused!")
+		}
 	default:
 		errMsg := fmt.Sprintf("unsupported wanted status for check! (wantedStatus: %d)",
 			wantedStatus)
@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckStatusWhilePausing(t *testing.T) {
+	if err := checkStatus(SCHED_STATUS_PAUSING, SCHED_STATUS_STOPPING, nil); err != nil {
+		t.Errorf("couldn't stop a pausing scheduler: %s", err)
+	}
+	for _, wanted := range []Status{
+		SCHED_STATUS_INITIALIZING, SCHED_STATUS_STARTING,
+		SCHED_STATUS_PAUSING, SCHED_STATUS_STARTED,
+	} {
+		if err := checkStatus(SCHED_STATUS_PAUSING, wanted, nil); err == nil {
+			t.Errorf("a pausing scheduler could become %s", GetStatusDescription(wanted))
+		}
+	}
+	if err := checkStatus(SCHED_STATUS_PAUSED, SCHED_STATUS_STOPPING, nil); err != nil {
+		t.Errorf("couldn't stop a paused scheduler: %s", err)
+	}
+}
+
+func TestStopWhilePausing(t *testing.T) {
+	site := newTestSite(3)
+	defer site.Close()
+	parsing := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	parse := func(httpResp *http.Response, depth uint32) ([]module.Data, []error) {
+		if strings.HasSuffix(httpResp.Request.URL.Path, "/page/0") {
+			parsing <- struct{}{}
+			<-release
+		}
+		return testParseLinks(httpResp, depth)
+	}
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, testDataArgs(),
+		testModules(t, &picked, parse), site.URL+"/page/0")
+	select {
+	case <-parsing:
+	case <-time.After(20 * time.Second):
+		t.Fatal("timeout waiting for the parser")
+	}
+	pauseErr := make(chan error, 1)
+	go func() {
+		pauseErr <- sched.Pause()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for sched.Status() != SCHED_STATUS_PAUSING {
+		if time.Now().After(deadline) {
+			t.Fatalf("status %s, want pausing", GetStatusDescription(sched.Status()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := sched.Stop(); err != nil {
+		t.Fatalf("couldn't stop a pausing scheduler: %s", err)
+	}
+	select {
+	case err := <-pauseErr:
+		if err == nil {
+			t.Fatal("pause succeeded after stop")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pause is still waiting after stop")
+	}
+	if status := sched.Status(); status != SCHED_STATUS_STOPPED {
+		t.Fatalf("status %s, want stopped", GetStatusDescription(status))
+	}
+	if n := atomic.LoadInt64(&picked); n != 0 {
+		t.Fatalf("picked %d items, want 0", n)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	site := newTestSite(10)
+	defer site.Close()
+	var picked int64
+	sched := startTestScheduler(t, RequestArgs{}, testDataArgs(),
+		testModules(t, &picked), site.URL+"/page/0")
+	if err := sched.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	ms := sched.(*myScheduler)
+	for _, s := range []*stage{ms.downloadStage, ms.analyzeStage, ms.pickStage} {
+		if s.Busy() != 0 {
+			t.Fatalf("a stage is busy while paused")
+		}
+	}
+	before := atomic.LoadInt64(&picked)
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt64(&picked); n != before {
+		t.Fatalf("picked %d items while paused", n-before)
+	}
+	if err := sched.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	waitTestScheduler(t, sched, 20*time.Second)
+	if n := atomic.LoadInt64(&picked); n != 10 {
+		t.Fatalf("picked %d items, want 10", n)
+	}
+}
@@ -3,6 +3,7 @@ package scheduler
 import (
 	"BeanGithub/crawler/module"
 	"BeanGithub/crawler/toolkit/buffer"
+	"BeanGithub/crawler/toolkit/seenset"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -49,24 +50,41 @@ type mySchedSummary struct {
 
 // SummaryStruct 调度器摘要的结构。
 type SummaryStruct struct {
-	RequestArgs     RequestArgs             `json:"request_args"`
-	DataArgs        DataArgs                `json:"data_args"`
-	ModuleArgs      ModuleArgsSummary       `json:"module_args"`
-	Status          string                  `json:"status"`
-	Downloaders     []module.SummaryStruct  `json:"downloaders"`
-	Analyzers       []module.SummaryStruct  `json:"analyzers"`
-	Pipelines       []module.SummaryStruct  `json:"pipelines"`
-	ReqBufferPool   BufferPoolSummaryStruct `json:"request_buffer_pool"`
-	RespBufferPool  BufferPoolSummaryStruct `json:"response_buffer_pool"`
-	ItemBufferPool  BufferPoolSummaryStruct `json:"item_buffer_pool"`
-	ErrorBufferPool BufferPoolSummaryStruct `json:"error_buffer_pool"`
-	NumberURL       uint64                  `json:"url_number"`
+	RequestArgs         RequestArgs               `json:"request_args"`
+	DataArgs            DataArgs                  `json:"data_args"`
+	ModuleArgs          ModuleArgsSummary         `json:"module_args"`
+	Status              string                    `json:"status"`
+	Downloaders         []module.SummaryStruct    `json:"downloaders"`
+	Analyzers           []module.SummaryStruct    `json:"analyzers"`
+	Pipelines           []module.SummaryStruct    `json:"pipelines"`
+	ReqBufferPool       BufferPoolSummaryStruct   `json:"request_buffer_pool"`
+	RespBufferPool      BufferPoolSummaryStruct   `json:"response_buffer_pool"`
+	ItemBufferPool      BufferPoolSummaryStruct   `json:"item_buffer_pool"`
+	ErrorBufferPool     BufferPoolSummaryStruct   `json:"error_buffer_pool"`
+	NumberURL           uint64                    `json:"url_number"`
+	Politeness          []PolitenessSummaryStruct `json:"politeness"`
+	SeenSet             SeenSetSummaryStruct      `json:"seen_set"`
+	Robots              RobotsSummaryStruct       `json:"robots"`
+	Counts              CountsStruct              `json:"counts"`
+	Stages              StagesSummaryStruct       `json:"stages"`
+	InFlight            int64                     `json:"in_flight"`
+	Budget              BudgetSummaryStruct       `json:"budget"`
+	DeadLetters         int                       `json:"dead_letters"`
+	Session             SessionSummaryStruct      `json:"session"`
+	UnclaimedMediaTypes map[string]uint64         `json:"unclaimed_media_types"`
+	Sitemap             SitemapSummaryStruct      `json:"sitemap"`
 }
 
 func (ss *mySchedSummary) Struct() SummaryStruct {
 	registrar := ss.sched.registrar
+	// 摘要会被打印或写入日志，因此其中不能有登录凭据。
+	requestArgs := ss.requestArgs
+	if login := requestArgs.Session.Login; login != nil {
+		redacted := login.Redacted()
+		requestArgs.Session.Login = &redacted
+	}
 	return SummaryStruct{
-		RequestArgs:     ss.requestArgs,
+		RequestArgs:     requestArgs,
 		DataArgs:        ss.dataArgs,
 		ModuleArgs:      ss.moduleArgs.Summary(),
 		Status:          GetStatusDescription(ss.sched.Status()),
@@ -77,7 +95,22 @@ func (ss *mySchedSummary) Struct() SummaryStruct {
 		RespBufferPool:  getBufferPoolSummary(ss.sched.respBufferPool),
 		ItemBufferPool:  getBufferPoolSummary(ss.sched.itemBufferPool),
 		ErrorBufferPool: getBufferPoolSummary(ss.sched.errorBufferPool),
-		// NumberURL:       len(ss.sched.urlMap),
+		NumberURL:       ss.sched.urlSet.Len(),
+		SeenSet:         getSeenSetSummary(ss.sched.urlSet),
+		Politeness:      ss.sched.politeness.Summary(),
+		Robots:          getRobotsSummary(ss.sched.robots),
+		Counts:          ss.sched.counts.Struct(),
+		Stages: StagesSummaryStruct{
+			Download: getStageSummary(ss.sched.downloadStage),
+			Analyze:  getStageSummary(ss.sched.analyzeStage),
+			Pick:     getStageSummary(ss.sched.pickStage),
+		},
+		InFlight:            ss.sched.flights.Count(),
+		Budget:              ss.sched.budget.Summary(),
+		DeadLetters:         getDeadLetterNumber(ss.sched.deadLetters),
+		Session:             ss.sched.session.Summary(),
+		UnclaimedMediaTypes: ss.sched.unclaimed.Summary(),
+		Sitemap:             ss.sched.sitemaps.Summary(),
 	}
 }
 
@@ -108,6 +141,30 @@ func getBufferPoolSummary(bufferPool buffer.Pool) BufferPoolSummaryStruct {
 	}
 }
 
+// SeenSetSummaryStruct 已处理的URL的集合的摘要类型。
+type SeenSetSummaryStruct struct {
+	Kind   seenset.Kind `json:"kind"`
+	Number uint64       `json:"number"`
+	Bytes  uint64       `json:"bytes"`
+}
+
+// getSeenSetSummary 生成和返回已处理的URL的集合的摘要信息。
+func getSeenSetSummary(set seenset.SeenSet) SeenSetSummaryStruct {
+	return SeenSetSummaryStruct{
+		Kind:   set.Kind(),
+		Number: set.Len(),
+		Bytes:  set.Bytes(),
+	}
+}
+
+// getRobotsSummary 生成和返回robots.txt缓存的摘要信息。
+func getRobotsSummary(robots robotsCache) RobotsSummaryStruct {
+	if robots == nil {
+		return RobotsSummaryStruct{}
+	}
+	return robots.Summary()
+}
+
 // getModuleSummaries 获取已注册的某类组件的摘要。
 func getModuleSummaries(registrar module.Registrar, mType module.Type) []module.SummaryStruct {
 	moduleMap, _ := registrar.GetAllByType(mType)
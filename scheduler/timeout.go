@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// downloadContext 单次下载的上下文。
+// 它派生自调度器的上下文，因此调度器停止时会中止正在进行的下载。
+// 设置了超时时间时，若在超时之前未能读完响应体，也会中止下载。
+type downloadContext struct {
+	// ctx 下载时使用的上下文。设置了超时时间时带有相应的截止时间。
+	ctx context.Context
+	// cancel 取消函数。
+	cancel context.CancelFunc
+	// timeout 超时时间。为0时表示不限制。
+	timeout time.Duration
+}
+
+// newDownloadContext 创建单次下载的上下文。
+func (sched *myScheduler) newDownloadContext() *downloadContext {
+	dc := &downloadContext{timeout: sched.downloadTimeout}
+	if dc.timeout > 0 {
+		dc.ctx, dc.cancel = context.WithTimeout(sched.ctx, dc.timeout)
+	} else {
+		dc.ctx, dc.cancel = context.WithCancel(sched.ctx)
+	}
+	return dc
+}
+
+// timedOut 判断下载是否已超时。
+func (dc *downloadContext) timedOut() bool {
+	return dc.ctx.Err() == context.DeadlineExceeded
+}
+
+// timeoutError 在下载已超时时把给定的错误值转换为errors.TimeoutError。
+func (dc *downloadContext) timeoutError(url string, err error) error {
+	if err == nil || !dc.timedOut() {
+		return err
+	}
+	if _, ok := err.(*errors.TimeoutError); ok {
+		return err
+	}
+	return errors.NewTimeoutError(url, dc.timeout, err)
+}
+
+// finish 在下载返回后调用。
+// 会在超时时把错误值转换为errors.TimeoutError。
+// 下载成功时，截止时间会一直作用到响应体被关闭为止，
+// 读取响应体时的超时同样会以errors.TimeoutError的形式报告；
+// 否则上下文会被立即取消。
+func (dc *downloadContext) finish(
+	req *module.Request, resp *module.Response, err error) error {
+	url := req.HTTPReq().URL.String()
+	if err != nil {
+		err = dc.timeoutError(url, err)
+		dc.cancel()
+		return err
+	}
+	if resp == nil || resp.HTTPResp() == nil || resp.HTTPResp().Body == nil {
+		dc.cancel()
+		return nil
+	}
+	httpResp := resp.HTTPResp()
+	httpResp.Body = &cancelOnClose{ReadCloser: httpResp.Body, dc: dc, url: url}
+	return nil
+}
+
+// cancelOnClose 在被关闭时取消相应上下文的读取器。
+type cancelOnClose struct {
+	io.ReadCloser
+	// dc 下载的上下文。
+	dc *downloadContext
+	// url 请求的URL。
+	url string
+	// once 保证只关闭一次。
+	once sync.Once
+}
+
+func (body *cancelOnClose) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = body.dc.timeoutError(body.url, err)
+	}
+	return n, err
+}
+
+func (body *cancelOnClose) Close() error {
+	var err error
+	body.once.Do(func() {
+		err = body.ReadCloser.Close()
+		body.dc.cancel()
+	})
+	return err
+}
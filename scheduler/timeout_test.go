@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	crawlerErrors "BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newStallingServer 创建一个在发送部分响应体之后停顿的测试服务器。
+// 参数headerDelay 发送响应头之前的停顿时间。
+func newStallingServer(headerDelay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(headerDelay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+func TestDownloadTimeoutBeforeResponse(t *testing.T) {
+	srv := newStallingServer(10 * time.Second)
+	defer srv.Close()
+	sched := &myScheduler{ctx: context.Background(), downloadTimeout: 100 * time.Millisecond}
+	dc := sched.newDownloadContext()
+	httpReq, _ := http.NewRequest("GET", srv.URL, nil)
+	req := module.NewRequest(httpReq, 0)
+	_, err := http.DefaultClient.Do(httpReq.WithContext(dc.ctx))
+	err = dc.finish(req, nil, err)
+	var te *crawlerErrors.TimeoutError
+	if !errors.As(err, &te) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if te.Limit != 100*time.Millisecond || te.URL != srv.URL {
+		t.Fatalf("unexpected timeout error: %v", te)
+	}
+}
+
+func TestDownloadTimeoutWhileReadingBody(t *testing.T) {
+	srv := newStallingServer(0)
+	defer srv.Close()
+	sched := &myScheduler{ctx: context.Background(), downloadTimeout: 200 * time.Millisecond}
+	dc := sched.newDownloadContext()
+	httpReq, _ := http.NewRequest("GET", srv.URL, nil)
+	req := module.NewRequest(httpReq, 0)
+	start := time.Now()
+	httpResp, err := http.DefaultClient.Do(httpReq.WithContext(dc.ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := module.NewResponse(httpResp, 0)
+	if err := dc.finish(req, resp, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	body, err := ioutil.ReadAll(httpResp.Body)
+	var te *crawlerErrors.TimeoutError
+	if !errors.As(err, &te) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != "partial" {
+		t.Fatalf("body %q", body)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("the body read wasn't aborted in time: %s", elapsed)
+	}
+}
+
+func TestDownloadContextCanceledOnClose(t *testing.T) {
+	srv := newTestSite(1)
+	defer srv.Close()
+	sched := &myScheduler{ctx: context.Background()}
+	dc := sched.newDownloadContext()
+	httpReq, _ := http.NewRequest("GET", srv.URL, nil)
+	httpResp, err := http.DefaultClient.Do(httpReq.WithContext(dc.ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.finish(module.NewRequest(httpReq, 0), module.NewResponse(httpResp, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	if dc.ctx.Err() != nil {
+		t.Fatal("the context was canceled before the body was closed")
+	}
+	httpResp.Body.Close()
+	if dc.ctx.Err() != context.Canceled {
+		t.Fatalf("context error %v after close", dc.ctx.Err())
+	}
+}
@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"sync"
+	"sync/atomic"
+)
+
+// maxUnclaimedMediaTypes 单独计数的媒体类型的最大数量。
+// 媒体类型来自服务端，因此需要限制其数量，超出的部分计入otherMediaTypes。
+const maxUnclaimedMediaTypes = 32
+
+// otherMediaTypes 超出最大数量的媒体类型的计数的键。
+const otherMediaTypes = "other"
+
+// unclaimedMediaTypes 无人认领的响应按照媒体类型的计数。
+type unclaimedMediaTypes struct {
+	// counts 媒体类型与响应数的字典。
+	counts map[string]uint64
+	// lock 保护字典的互斥锁。
+	lock sync.Mutex
+}
+
+// newUnclaimedMediaTypes 创建无人认领的响应按照媒体类型的计数。
+func newUnclaimedMediaTypes() *unclaimedMediaTypes {
+	return &unclaimedMediaTypes{counts: map[string]uint64{}}
+}
+
+// Add 为给定的媒体类型计数。
+// 已单独计数的媒体类型达到最大数量之后，新出现的媒体类型都计入otherMediaTypes。
+func (u *unclaimedMediaTypes) Add(mediaType string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if _, ok := u.counts[mediaType]; !ok && len(u.counts) >= maxUnclaimedMediaTypes {
+		mediaType = otherMediaTypes
+	}
+	u.counts[mediaType]++
+}
+
+// Summary 获取各个媒体类型的计数。
+func (u *unclaimedMediaTypes) Summary() map[string]uint64 {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	summary := make(map[string]uint64, len(u.counts))
+	for mediaType, count := range u.counts {
+		summary[mediaType] = count
+	}
+	return summary
+}
+
+// getAnalyzerFor 获取一个接受给定响应的分析器。
+// 没有分析器接受该响应时，两个结果值都为nil。
+func (sched *myScheduler) getAnalyzerFor(resp *module.Response) (module.Module, error) {
+	return sched.registrar.GetBy(module.TYPE_ANALYZER, func(m module.Module) bool {
+		matcher, ok := m.(module.ResponseMatcher)
+		return !ok || matcher.Accepts(resp)
+	})
+}
+
+// discardUnclaimed 计数并丢弃没有分析器接受的响应。
+func (sched *myScheduler) discardUnclaimed(resp *module.Response) {
+	atomic.AddUint64(&sched.counts.unclaimed, 1)
+	mediaType := "unknown"
+	httpResp := resp.HTTPResp()
+	if httpResp != nil {
+		if mt, _, err := mime.ParseMediaType(httpResp.Header.Get("Content-Type")); err == nil {
+			mediaType = mt
+		}
+	}
+	sched.unclaimed.Add(mediaType)
+	fmt.Printf("Ignore the response! No analyzer accepts it. (URL: %s, media type: %s)\n",
+		resp.FinalURL(), mediaType)
+	if httpResp != nil && httpResp.Body != nil {
+		io.Copy(ioutil.Discard, httpResp.Body)
+		httpResp.Body.Close()
+	}
+}
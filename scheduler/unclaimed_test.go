@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"BeanGithub/crawler/module"
+	"BeanGithub/crawler/module/local/analyzer"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newMediaSite 创建一个包含网页、图片和PDF文件的测试站点。
+func newMediaSite() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page/0":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><a href="/page/1">1</a><a href="/a.png">a</a>` +
+				`<a href="/b.png">b</a><a href="/c.pdf">c</a></html>`))
+		case "/page/1":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html></html>`))
+		case "/a.png", "/b.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		default:
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF"))
+		}
+	}))
+}
+
+// newMediaAnalyzer 创建只接受给定媒体类型的分析器，并统计其分析的响应的数量。
+func newMediaAnalyzer(t *testing.T, serial uint64, mediaType string, parser module.ParseResponse,
+	analyzed *int64) module.Analyzer {
+	mid, _ := module.GenMID(module.TYPE_ANALYZER, serial, nil)
+	a, err := analyzer.NewWithOptions(mid, []module.ParseResponse{
+		func(httpResp *http.Response, depth uint32) ([]module.Data, []error) {
+			atomic.AddInt64(analyzed, 1)
+			return parser(httpResp, depth)
+		},
+	}, analyzer.Options{MediaTypes: []string{mediaType}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAnalyzerRouting(t *testing.T) {
+	site := newMediaSite()
+	defer site.Close()
+	var picked, pages, images int64
+	moduleArgs := testModules(t, &picked)
+	moduleArgs.Analyzers = []module.Analyzer{
+		newMediaAnalyzer(t, 10, "text/html", testParseLinks, &pages),
+		newMediaAnalyzer(t, 11, "image/*", func(httpResp *http.Response, depth uint32) ([]module.Data, []error) {
+			return []module.Data{module.Item{"image": httpResp.Request.URL.String()}}, nil
+		}, &images),
+	}
+	sched := startTestScheduler(t, RequestArgs{}, testDataArgs(), moduleArgs, site.URL+"/page/0")
+	waitTestScheduler(t, sched, 20*time.Second)
+	if n := atomic.LoadInt64(&pages); n != 2 {
+		t.Fatalf("the page analyzer analyzed %d responses, want 2", n)
+	}
+	if n := atomic.LoadInt64(&images); n != 2 {
+		t.Fatalf("the image analyzer analyzed %d responses, want 2", n)
+	}
+	if n := atomic.LoadInt64(&picked); n != 4 {
+		t.Fatalf("picked %d items, want 4", n)
+	}
+	// 没有分析器接受的响应被计数并按照媒体类型报告。
+	summary := sched.Summary().Struct()
+	if summary.Counts.Unclaimed != 1 {
+		t.Fatalf("%d unclaimed responses, want 1", summary.Counts.Unclaimed)
+	}
+	if n := summary.UnclaimedMediaTypes["application/pdf"]; n != 1 || len(summary.UnclaimedMediaTypes) != 1 {
+		t.Fatalf("unexpected unclaimed media types: %v", summary.UnclaimedMediaTypes)
+	}
+}
+
+func TestUnclaimedMediaTypesLimit(t *testing.T) {
+	u := newUnclaimedMediaTypes()
+	for i := 0; i < maxUnclaimedMediaTypes+10; i++ {
+		u.Add(fmt.Sprintf("application/x-%d", i))
+	}
+	u.Add("application/x-0")
+	summary := u.Summary()
+	// 超出最大数量的媒体类型都计入同一个键。
+	if len(summary) != maxUnclaimedMediaTypes+1 {
+		t.Fatalf("%d media types counted, want %d", len(summary), maxUnclaimedMediaTypes+1)
+	}
+	if n := summary[otherMediaTypes]; n != 10 {
+		t.Fatalf("%d responses counted as other media types, want 10", n)
+	}
+	if n := summary["application/x-0"]; n != 2 {
+		t.Fatalf("%d responses counted for a known media type, want 2", n)
+	}
+}
@@ -0,0 +1,201 @@
+package canonicalizer
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultTrackingParams 默认会被去除的跟踪参数。
+// 以“*”结尾的表示前缀匹配。
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"gclid",
+	"gclsrc",
+	"dclid",
+	"fbclid",
+	"msclkid",
+	"yclid",
+	"mc_cid",
+	"mc_eid",
+	"_hsenc",
+	"_hsmkt",
+	"igshid",
+}
+
+// defaultPorts 各个协议的默认端口。
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Rules URL规范化的规则。
+// 各个字段为零值时会执行完整的规范化。
+type Rules struct {
+	// KeepFragment 是否保留片段（“#”之后的部分）。
+	KeepFragment bool `json:"keep_fragment"`
+	// KeepQueryOrder 是否保留查询参数原有的顺序。
+	KeepQueryOrder bool `json:"keep_query_order"`
+	// TrackingParams 需要去除的跟踪参数的名称列表，以“*”结尾的表示前缀匹配。
+	// 为nil时使用DefaultTrackingParams，为空列表时不去除任何参数。
+	TrackingParams []string `json:"tracking_params"`
+}
+
+// Canonicalizer URL规范化器的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type Canonicalizer interface {
+	// Canonicalize 返回给定URL的规范形式。
+	// 不会修改给定的URL。
+	Canonicalize(u *url.URL) *url.URL
+}
+
+// New 根据给定的规则创建一个URL规范化器。
+func New(rules Rules) Canonicalizer {
+	trackingParams := rules.TrackingParams
+	if trackingParams == nil {
+		trackingParams = DefaultTrackingParams
+	}
+	c := &myCanonicalizer{
+		keepFragment:   rules.KeepFragment,
+		keepQueryOrder: rules.KeepQueryOrder,
+		trackingParams: map[string]struct{}{},
+	}
+	for _, param := range trackingParams {
+		param = strings.ToLower(strings.TrimSpace(param))
+		if param == "" {
+			continue
+		}
+		if strings.HasSuffix(param, "*") {
+			c.trackingPrefixes = append(c.trackingPrefixes, strings.TrimSuffix(param, "*"))
+		} else {
+			c.trackingParams[param] = struct{}{}
+		}
+	}
+	return c
+}
+
+// myCanonicalizer URL规范化器的实现类型。
+type myCanonicalizer struct {
+	// keepFragment 是否保留片段。
+	keepFragment bool
+	// keepQueryOrder 是否保留查询参数原有的顺序。
+	keepQueryOrder bool
+	// trackingParams 需要去除的跟踪参数的名称的集合。
+	trackingParams map[string]struct{}
+	// trackingPrefixes 需要去除的跟踪参数的名称前缀列表。
+	trackingPrefixes []string
+}
+
+func (c *myCanonicalizer) Canonicalize(u *url.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+	canonical := *u
+	if canonical.User != nil {
+		user := *canonical.User
+		canonical.User = &user
+	}
+	// 协议和主机转为小写，并去除默认端口。
+	canonical.Scheme = strings.ToLower(canonical.Scheme)
+	host := strings.ToLower(canonical.Host)
+	if port := canonical.Port(); port != "" && defaultPorts[canonical.Scheme] == port {
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+	canonical.Host = strings.TrimSuffix(host, ".")
+	// 清理路径中的“.”和“..”。
+	if canonical.Opaque == "" {
+		if canonical.Path == "" && canonical.Host != "" {
+			canonical.Path = "/"
+			canonical.RawPath = ""
+		} else if hasDotSegment(canonical.Path) {
+			canonical = *canonical.ResolveReference(&url.URL{
+				Path:     canonical.Path,
+				RawPath:  canonical.RawPath,
+				RawQuery: canonical.RawQuery,
+				Fragment: canonical.Fragment,
+			})
+		}
+	}
+	// 处理查询参数。
+	canonical.RawQuery = c.canonicalQuery(canonical.RawQuery)
+	if canonical.RawQuery == "" {
+		canonical.ForceQuery = false
+	}
+	// 去除片段。
+	if !c.keepFragment {
+		canonical.Fragment = ""
+		canonical.RawFragment = ""
+	}
+	return &canonical
+}
+
+// hasDotSegment 判断给定的路径中是否包含“.”或“..”路径段。
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalQuery 返回规范化的查询字符串。
+// 只以“&”分隔参数，会去除空参数和跟踪参数，并在需要时按参数名和参数值排序。
+// 参数的编码形式保持不变。
+func (c *myCanonicalizer) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	type param struct {
+		key, value, raw string
+	}
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		rawKey, rawValue := raw, ""
+		if index := strings.Index(raw, "="); index >= 0 {
+			rawKey, rawValue = raw[:index], raw[index+1:]
+		}
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		if c.tracking(key) {
+			continue
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			value = rawValue
+		}
+		params = append(params, param{key: key, value: value, raw: raw})
+	}
+	if !c.keepQueryOrder {
+		sort.SliceStable(params, func(i, j int) bool {
+			if params[i].key != params[j].key {
+				return params[i].key < params[j].key
+			}
+			return params[i].value < params[j].value
+		})
+	}
+	raws := make([]string, len(params))
+	for i, p := range params {
+		raws[i] = p.raw
+	}
+	return strings.Join(raws, "&")
+}
+
+// tracking 判断给定的参数名是否属于跟踪参数。
+func (c *myCanonicalizer) tracking(key string) bool {
+	key = strings.ToLower(key)
+	if _, ok := c.trackingParams[key]; ok {
+		return true
+	}
+	for _, prefix := range c.trackingPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
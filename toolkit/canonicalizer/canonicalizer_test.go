@@ -0,0 +1,62 @@
+package canonicalizer
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		rules Rules
+		raw   string
+		want  string
+	}{
+		{"case", Rules{}, "HTTP://Example.COM/Path", "http://example.com/Path"},
+		{"trailing dot", Rules{}, "http://example.com./", "http://example.com/"},
+		{"empty path", Rules{}, "http://example.com", "http://example.com/"},
+		{"http default port", Rules{}, "http://example.com:80/a", "http://example.com/a"},
+		{"https default port", Rules{}, "https://example.com:443/a", "https://example.com/a"},
+		{"other port", Rules{}, "http://example.com:8080/a", "http://example.com:8080/a"},
+		{"cross port", Rules{}, "https://example.com:80/a", "https://example.com:80/a"},
+		{"fragment", Rules{}, "http://example.com/a#top", "http://example.com/a"},
+		{"keep fragment", Rules{KeepFragment: true}, "http://example.com/a#top", "http://example.com/a#top"},
+		{"query order", Rules{}, "http://example.com/?b=2&a=1&a=0", "http://example.com/?a=0&a=1&b=2"},
+		{"keep query order", Rules{KeepQueryOrder: true}, "http://example.com/?b=2&a=1", "http://example.com/?b=2&a=1"},
+		{"empty params", Rules{}, "http://example.com/?&a=1&&", "http://example.com/?a=1"},
+		{"empty query", Rules{}, "http://example.com/?", "http://example.com/"},
+		{"semicolon", Rules{}, "http://example.com/?b=x;a=y&a=1", "http://example.com/?a=1&b=x;a=y"},
+		{"encoding kept", Rules{}, "http://example.com/?q=a%20b&p=c+d", "http://example.com/?p=c+d&q=a%20b"},
+		{"utm", Rules{}, "http://example.com/?utm_source=x&id=1&UTM_Medium=y", "http://example.com/?id=1"},
+		{"tracking", Rules{}, "http://example.com/?gclid=1&fbclid=2&id=3", "http://example.com/?id=3"},
+		{"custom tracking", Rules{TrackingParams: []string{"sid", "ref_*"}},
+			"http://example.com/?sid=1&ref_a=2&utm_source=3", "http://example.com/?utm_source=3"},
+		{"no tracking", Rules{TrackingParams: []string{}}, "http://example.com/?utm_source=x", "http://example.com/?utm_source=x"},
+		{"dot segments", Rules{}, "http://example.com/a/./b/../c", "http://example.com/a/c"},
+		{"leading dot dot", Rules{}, "http://example.com/../a", "http://example.com/a"},
+		{"trailing dot dot", Rules{}, "http://example.com/a/b/..", "http://example.com/a/"},
+		{"dotted names", Rules{}, "http://example.com/v1.2/file.tar.gz", "http://example.com/v1.2/file.tar.gz"},
+		{"dotted file", Rules{}, "http://example.com/a/.well-known/..x", "http://example.com/a/.well-known/..x"},
+		{"escaped path", Rules{}, "http://example.com/a%2Fb/index.html?x=1", "http://example.com/a%2Fb/index.html?x=1"},
+		{"dot segments with query", Rules{}, "http://example.com/a/../b?z=1&y=2", "http://example.com/b?y=2&z=1"},
+	} {
+		u, err := url.Parse(tc.raw)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		before := u.String()
+		got := New(tc.rules).Canonicalize(u).String()
+		if got != tc.want {
+			t.Errorf("%s: Canonicalize(%q) = %q, want %q", tc.name, tc.raw, got, tc.want)
+		}
+		if u.String() != before {
+			t.Errorf("%s: the given URL was modified to %q", tc.name, u.String())
+		}
+	}
+}
+
+func TestCanonicalizeNil(t *testing.T) {
+	if u := New(Rules{}).Canonicalize(nil); u != nil {
+		t.Fatalf("Canonicalize(nil) = %v, want nil", u)
+	}
+}
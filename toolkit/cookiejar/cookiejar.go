@@ -0,0 +1,108 @@
+package cookiejar
+
+import (
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Jar Cookie存储器的接口类型。
+// 其中的Cookie按照主域名（eTLD+1）或主机分区存放。
+// 该接口的实现类型是并发安全的。
+type Jar interface {
+	http.CookieJar
+	// Clear 清除与给定域名相关的分区中的所有Cookie。
+	// 给定域名与分区相同、是分区的上级域名或下级域名时都视为相关。
+	// 参数domain为空时清除全部Cookie。
+	Clear(domain string)
+	// Partitions 获取当前所有分区的名称。
+	Partitions() []string
+}
+
+// myJar Cookie存储器的实现类型。
+type myJar struct {
+	// isolated 是否按主机分区。为false时按主域名分区。
+	isolated bool
+	// jars 分区名称与相应的标准Cookie存储器的字典。
+	jars map[string]*cookiejar.Jar
+	// lock 保护分区字典的互斥锁。
+	lock sync.Mutex
+}
+
+// New 创建一个Cookie存储器。
+// 参数isolated 是否按主机隔离Cookie。
+// 为true时同一主域名下的不同主机之间不会共享Cookie，即使Cookie的Domain属性允许。
+func New(isolated bool) Jar {
+	return &myJar{
+		isolated: isolated,
+		jars:     map[string]*cookiejar.Jar{},
+	}
+}
+
+func (jar *myJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	jar.get(u, true).SetCookies(u, cookies)
+}
+
+func (jar *myJar) Cookies(u *url.URL) []*http.Cookie {
+	partition := jar.get(u, false)
+	if partition == nil {
+		return nil
+	}
+	return partition.Cookies(u)
+}
+
+func (jar *myJar) Clear(domain string) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	jar.lock.Lock()
+	defer jar.lock.Unlock()
+	for name := range jar.jars {
+		if domain == "" || name == domain ||
+			strings.HasSuffix(name, "."+domain) ||
+			strings.HasSuffix(domain, "."+name) {
+			delete(jar.jars, name)
+		}
+	}
+}
+
+func (jar *myJar) Partitions() []string {
+	jar.lock.Lock()
+	defer jar.lock.Unlock()
+	names := make([]string, 0, len(jar.jars))
+	for name := range jar.jars {
+		names = append(names, name)
+	}
+	return names
+}
+
+// get 获取给定URL所属的分区。
+// 参数create 分区不存在时是否创建。
+func (jar *myJar) get(u *url.URL, create bool) *cookiejar.Jar {
+	name := jar.partition(u)
+	jar.lock.Lock()
+	defer jar.lock.Unlock()
+	partition := jar.jars[name]
+	if partition == nil && create {
+		// 只有在Options为nil时才会返回错误。
+		partition, _ = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		jar.jars[name] = partition
+	}
+	return partition
+}
+
+// partition 获取给定URL所属的分区的名称。
+func (jar *myJar) partition(u *url.URL) string {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if jar.isolated || net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
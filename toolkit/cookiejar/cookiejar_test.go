@@ -0,0 +1,122 @@
+package cookiejar
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// cookieNames 获取给定URL可用的Cookie的名称，以逗号分隔并排序。
+func cookieNames(t *testing.T, jar Jar, rawURL string) string {
+	var names []string
+	for _, cookie := range jar.Cookies(mustParseURL(t, rawURL)) {
+		names = append(names, cookie.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// setTestCookies 让a.example.com设置一个仅限主机的Cookie和一个属于example.com的Cookie。
+func setTestCookies(t *testing.T, jar Jar) {
+	jar.SetCookies(mustParseURL(t, "https://a.example.com/"), []*http.Cookie{
+		{Name: "host", Value: "1", Path: "/"},
+		{Name: "domain", Value: "1", Path: "/", Domain: "example.com"},
+	})
+}
+
+func TestSharedByPrimaryDomain(t *testing.T) {
+	jar := New(false)
+	setTestCookies(t, jar)
+	for rawURL, want := range map[string]string{
+		"https://a.example.com/x": "domain,host",
+		// 同一主域名下的其他主机可以使用Domain属性允许的Cookie。
+		"https://b.example.com/":  "domain",
+		"https://example.com/":    "domain",
+		"https://other.com/":      "",
+		"https://a.example.org/x": "",
+	} {
+		if got := cookieNames(t, jar, rawURL); got != want {
+			t.Errorf("cookies for %s: %q, want %q", rawURL, got, want)
+		}
+	}
+	if partitions := jar.Partitions(); len(partitions) != 1 || partitions[0] != "example.com" {
+		t.Fatalf("unexpected partitions: %v", partitions)
+	}
+}
+
+func TestIsolatedByHost(t *testing.T) {
+	jar := New(true)
+	setTestCookies(t, jar)
+	for rawURL, want := range map[string]string{
+		"https://a.example.com/x": "domain,host",
+		// 即使Domain属性允许，其他主机也不能使用该Cookie。
+		"https://b.example.com/": "",
+		"https://example.com/":   "",
+	} {
+		if got := cookieNames(t, jar, rawURL); got != want {
+			t.Errorf("cookies for %s: %q, want %q", rawURL, got, want)
+		}
+	}
+	if partitions := jar.Partitions(); len(partitions) != 1 || partitions[0] != "a.example.com" {
+		t.Fatalf("unexpected partitions: %v", partitions)
+	}
+	// IP地址以及端口不同的同一主机都按主机分区。
+	jar = New(false)
+	jar.SetCookies(mustParseURL(t, "http://127.0.0.1:8080/"), []*http.Cookie{{Name: "ip", Value: "1"}})
+	if got := cookieNames(t, jar, "http://127.0.0.1:9090/"); got != "ip" {
+		t.Errorf("cookies for another port: %q", got)
+	}
+	if partitions := jar.Partitions(); len(partitions) != 1 || partitions[0] != "127.0.0.1" {
+		t.Fatalf("unexpected partitions: %v", partitions)
+	}
+}
+
+func TestClear(t *testing.T) {
+	newJar := func() Jar {
+		jar := New(true)
+		for _, rawURL := range []string{
+			"https://example.com/", "https://a.example.com/", "https://b.a.example.com/", "https://other.com/",
+		} {
+			jar.SetCookies(mustParseURL(t, rawURL), []*http.Cookie{{Name: "sid", Value: "1"}})
+		}
+		return jar
+	}
+	for _, tc := range []struct {
+		domain string
+		kept   []string
+	}{
+		// 上级域名会清除所有下级域名的分区。
+		{"example.com", []string{"other.com"}},
+		{"EXAMPLE.COM.", []string{"other.com"}},
+		// 下级域名会清除其自身及上级域名的分区，但不影响同级的其他分支。
+		{"a.example.com", []string{"other.com"}},
+		{"b.a.example.com", []string{"other.com"}},
+		{"x.example.com", []string{"a.example.com", "b.a.example.com", "other.com"}},
+		{"ample.com", []string{"a.example.com", "b.a.example.com", "example.com", "other.com"}},
+		{"", []string{}},
+	} {
+		jar := newJar()
+		jar.Clear(tc.domain)
+		partitions := jar.Partitions()
+		sort.Strings(partitions)
+		if strings.Join(partitions, ",") != strings.Join(tc.kept, ",") {
+			t.Errorf("Clear(%q) kept %v, want %v", tc.domain, partitions, tc.kept)
+		}
+	}
+	jar := New(false)
+	setTestCookies(t, jar)
+	jar.Clear("b.example.com")
+	if got := cookieNames(t, jar, "https://a.example.com/"); got != "" {
+		t.Errorf("cookies left after clearing a subdomain of the partition: %q", got)
+	}
+}
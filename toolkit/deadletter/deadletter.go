@@ -0,0 +1,405 @@
+package deadletter
+
+import (
+	"BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Letter 死信，即最终下载失败的请求的记录。
+type Letter struct {
+	// Method 请求方法。
+	Method string `json:"method"`
+	// URL 请求的URL。
+	URL string `json:"url"`
+	// Header 请求头。
+	Header http.Header `json:"header,omitempty"`
+	// Depth 请求深度。
+	Depth uint32 `json:"depth"`
+	// Priority 请求优先级。
+	Priority float64 `json:"priority,omitempty"`
+	// Body 请求体，在JSON中以base64编码。
+	Body []byte `json:"body,omitempty"`
+	// BodyDropped 请求体是否因为无法被重新读取或者过长而未被记录。
+	// 这样的死信无法被重新注入。
+	BodyDropped bool `json:"body_dropped,omitempty"`
+	// Error 最后一次失败的错误信息。
+	Error string `json:"error"`
+	// ErrorType 最后一次失败的错误类型。
+	ErrorType errors.ErrorType `json:"error_type"`
+	// Attempts 最后一次失败时的下载尝试次数。
+	Attempts uint32 `json:"attempts"`
+	// Failures 该请求被记为死信的次数。
+	Failures uint32 `json:"failures"`
+	// FirstFailed 首次被记为死信的时间。
+	FirstFailed time.Time `json:"first_failed"`
+	// LastFailed 最后一次被记为死信的时间。
+	LastFailed time.Time `json:"last_failed"`
+}
+
+// NewLetter 根据最终下载失败的请求及其错误创建一个死信。
+// 参数attempts 下载尝试的次数。
+// 请求头中的Cookie等凭据不会被记入死信。
+// 请求体无法被记录时会将死信标记为无法重新注入。
+func NewLetter(req *module.Request, err errors.CrawlerError, attempts uint32) Letter {
+	httpReq := req.HTTPReq()
+	body, bodyErr := module.PersistedBody(httpReq)
+	now := time.Now()
+	letter := Letter{
+		Method:      httpReq.Method,
+		URL:         httpReq.URL.String(),
+		Header:      module.StripCredentials(httpReq.Header),
+		Depth:       req.Depth(),
+		Priority:    req.Priority(),
+		Body:        body,
+		BodyDropped: bodyErr != nil,
+		Attempts:    attempts,
+		Failures:    1,
+		FirstFailed: now,
+		LastFailed:  now,
+	}
+	if err != nil {
+		letter.Error = err.Error()
+		letter.ErrorType = err.Type()
+	}
+	return letter
+}
+
+// ErrBodyDropped 表示死信未记录请求体、因而无法重建请求的错误。
+var ErrBodyDropped = fmt.Errorf("the request body was not recorded")
+
+// Request 根据死信重建请求。
+// 重建的请求的失败尝试次数为0，以便重新获得完整的重试机会。
+// 死信未记录请求体时返回ErrBodyDropped。
+func (letter Letter) Request() (*module.Request, error) {
+	if letter.BodyDropped {
+		return nil, ErrBodyDropped
+	}
+	method := letter.Method
+	if method == "" {
+		method = "GET"
+	}
+	var body io.Reader
+	if len(letter.Body) > 0 {
+		body = bytes.NewReader(letter.Body)
+	}
+	httpReq, err := http.NewRequest(method, letter.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range letter.Header {
+		httpReq.Header[key] = values
+	}
+	req := module.NewRequest(httpReq, letter.Depth)
+	req.SetPriority(letter.Priority)
+	return req, nil
+}
+
+// Filter 死信的过滤条件。
+// 各个字段为零值时表示不做相应的过滤。
+type Filter struct {
+	// ErrorType 错误类型。
+	ErrorType errors.ErrorType
+	// Host URL的主机。
+	Host string
+	// URLPrefix URL的前缀。
+	URLPrefix string
+	// ErrorContains 错误信息中包含的文本。
+	ErrorContains string
+	// MinAttempts 最少的下载尝试次数。
+	MinAttempts uint32
+	// Since 最后一次失败的时间的下限（包含）。
+	Since time.Time
+	// Until 最后一次失败的时间的上限（不包含）。
+	Until time.Time
+}
+
+// Match 判断给定的死信是否满足过滤条件。
+func (filter Filter) Match(letter Letter) bool {
+	if filter.ErrorType != "" && letter.ErrorType != filter.ErrorType {
+		return false
+	}
+	if filter.Host != "" {
+		req, err := http.NewRequest("GET", letter.URL, nil)
+		if err != nil || !strings.EqualFold(req.URL.Hostname(), filter.Host) {
+			return false
+		}
+	}
+	if filter.URLPrefix != "" && !strings.HasPrefix(letter.URL, filter.URLPrefix) {
+		return false
+	}
+	if filter.ErrorContains != "" && !strings.Contains(letter.Error, filter.ErrorContains) {
+		return false
+	}
+	if letter.Attempts < filter.MinAttempts {
+		return false
+	}
+	if !filter.Since.IsZero() && letter.LastFailed.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && !letter.LastFailed.Before(filter.Until) {
+		return false
+	}
+	return true
+}
+
+// Store 死信存储的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type Store interface {
+	// Add 添加死信。
+	// 若已存在相同URL的死信，则更新该死信并累加其被记为死信的次数。
+	Add(letter Letter) error
+	// List 按照最后一次失败的时间的先后列出满足过滤条件的死信。
+	List(filter Filter) ([]Letter, error)
+	// Remove 删除给定URL的死信，返回实际删除的数量。
+	Remove(urls ...string) (int, error)
+	// Len 获取死信的数量。
+	Len() int
+	// Close 关闭存储。
+	Close() error
+}
+
+// ErrClosedStore 表示死信存储已关闭的错误。
+var ErrClosedStore = fmt.Errorf("closed dead letter store")
+
+// record 存储文件中的一行记录。
+type record struct {
+	Letter
+	// Removed 是否为删除标记。
+	Removed bool `json:"removed,omitempty"`
+}
+
+// myStore 基于文件的死信存储的实现类型。
+// 文件的每一行都是一条JSON记录，同一URL以最后一条记录为准。
+// 无效的记录过多时，会在写入时压缩存储文件。
+type myStore struct {
+	// path 存储文件的路径。
+	path string
+	// file 以追加方式打开的存储文件。
+	file *os.File
+	// letterMap URL与死信的映射。
+	letterMap map[string]Letter
+	// records 存储文件中的记录数。
+	records int
+	// size 已读取或写入的存储文件的长度，用于发现其他进程追加的记录。
+	size int64
+	// closed 是否已关闭。
+	closed bool
+	// lock 保护以上字段的互斥锁。
+	lock sync.Mutex
+}
+
+// Open 打开给定路径的死信存储文件。文件不存在时会被创建。
+func Open(path string) (Store, error) {
+	if path == "" {
+		return nil, errors.NewIllegalParameterError("empty dead letter store path")
+	}
+	store := &myStore{
+		path:      path,
+		letterMap: map[string]Letter{},
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	store.file = file
+	return store, nil
+}
+
+// load 从存储文件中读取所有死信。
+func (store *myStore) load() error {
+	file, err := os.Open(store.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	store.letterMap = map[string]Letter{}
+	store.records = 0
+	store.size = 0
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		store.size += int64(len(data)) + 1
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("dead letter store: illegal record at line %d: %s", line, err)
+		}
+		store.records++
+		if r.Removed {
+			delete(store.letterMap, r.URL)
+		} else {
+			store.letterMap[r.URL] = r.Letter
+		}
+	}
+	return scanner.Err()
+}
+
+// write 向存储文件追加一条记录。调用方需持有锁。
+// 无效的记录过多时会随即压缩存储文件。
+func (store *myStore) write(r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	n, err := store.file.Write(append(data, '\n'))
+	store.size += int64(n)
+	if err != nil {
+		return err
+	}
+	store.records++
+	if store.records > 2*len(store.letterMap)+64 {
+		return store.compact()
+	}
+	return nil
+}
+
+func (store *myStore) Add(letter Letter) error {
+	if letter.URL == "" {
+		return errors.NewIllegalParameterError("empty dead letter URL")
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.closed {
+		return ErrClosedStore
+	}
+	if old, ok := store.letterMap[letter.URL]; ok {
+		letter.Failures += old.Failures
+		if !old.FirstFailed.IsZero() &&
+			(letter.FirstFailed.IsZero() || old.FirstFailed.Before(letter.FirstFailed)) {
+			letter.FirstFailed = old.FirstFailed
+		}
+	}
+	if err := store.write(record{Letter: letter}); err != nil {
+		return err
+	}
+	store.letterMap[letter.URL] = letter
+	return nil
+}
+
+func (store *myStore) List(filter Filter) ([]Letter, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.closed {
+		return nil, ErrClosedStore
+	}
+	letters := []Letter{}
+	for _, letter := range store.letterMap {
+		if filter.Match(letter) {
+			letters = append(letters, letter)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].LastFailed.Equal(letters[j].LastFailed) {
+			return letters[i].LastFailed.Before(letters[j].LastFailed)
+		}
+		return letters[i].URL < letters[j].URL
+	})
+	return letters, nil
+}
+
+func (store *myStore) Remove(urls ...string) (int, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.closed {
+		return 0, ErrClosedStore
+	}
+	var removed int
+	for _, url := range urls {
+		if _, ok := store.letterMap[url]; !ok {
+			continue
+		}
+		if err := store.write(record{Letter: Letter{URL: url}, Removed: true}); err != nil {
+			return removed, err
+		}
+		delete(store.letterMap, url)
+		removed++
+	}
+	return removed, nil
+}
+
+func (store *myStore) Len() int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return len(store.letterMap)
+}
+
+func (store *myStore) Close() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.closed {
+		return nil
+	}
+	store.closed = true
+	return store.file.Close()
+}
+
+// compact 只保留现存的死信并重写存储文件。调用方需持有锁。
+// 若存储文件被其他进程追加过记录，则会先重新读取，以免丢失这些记录。
+// 会先写入同目录下的临时文件再替换，以免留下不完整的存储文件。
+func (store *myStore) compact() error {
+	if info, err := store.file.Stat(); err != nil {
+		return err
+	} else if info.Size() != store.size {
+		if err := store.load(); err != nil {
+			return err
+		}
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+	for _, letter := range store.letterMap {
+		if err = encoder.Encode(record{Letter: letter}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, store.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	file, err := os.OpenFile(store.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	store.file.Close()
+	store.file = file
+	store.records = len(store.letterMap)
+	if info, err := file.Stat(); err == nil {
+		store.size = info.Size()
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package deadletter
+
+import (
+	"BeanGithub/crawler/errors"
+	"BeanGithub/crawler/module"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLetter(t *testing.T, url string) Letter {
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq.Header.Set("Cookie", "sid=1")
+	httpReq.Header.Set("Authorization", "Bearer secret")
+	httpReq.Header.Set("Proxy-Authorization", "Basic secret")
+	httpReq.Header.Set("Accept-Language", "zh-CN")
+	crawlerError := errors.NewCrawlerError(errors.ERROR_TYPE_DOWNLOADER, "boom")
+	return NewLetter(module.NewRequest(httpReq, 1), crawlerError, 3)
+}
+
+func openTestStore(t *testing.T) (string, Store) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "letters.jsonl")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, store
+}
+
+func TestNewLetterStripsCredentials(t *testing.T) {
+	letter := newTestLetter(t, "https://a.com/x")
+	for _, key := range module.CredentialHeaders {
+		if letter.Header.Get(key) != "" {
+			t.Errorf("%s was recorded", key)
+		}
+	}
+	if letter.Header.Get("Accept-Language") != "zh-CN" {
+		t.Errorf("Accept-Language was dropped")
+	}
+	req, err := letter.Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.HTTPReq().Header.Get("Cookie") != "" {
+		t.Errorf("the rebuilt request has a cookie")
+	}
+}
+
+func TestLetterBody(t *testing.T) {
+	_, store := openTestStore(t)
+	defer store.Close()
+	crawlerError := errors.NewCrawlerError(errors.ERROR_TYPE_DOWNLOADER, "boom")
+	httpReq, _ := http.NewRequest("POST", "https://a.com/form", strings.NewReader("a=1&b=2"))
+	if err := store.Add(NewLetter(module.NewRequest(httpReq, 0), crawlerError, 1)); err != nil {
+		t.Fatal(err)
+	}
+	// 无法被重新读取的请求体不会被记录，这样的死信也无法被重新注入。
+	httpReq, _ = http.NewRequest("POST", "https://a.com/stream", nil)
+	httpReq.Body = ioutil.NopCloser(strings.NewReader("data"))
+	if err := store.Add(NewLetter(module.NewRequest(httpReq, 0), crawlerError, 1)); err != nil {
+		t.Fatal(err)
+	}
+	letters, err := store.List(Filter{})
+	if err != nil || len(letters) != 2 {
+		t.Fatalf("listed %d letters, %v", len(letters), err)
+	}
+	for _, letter := range letters {
+		req, err := letter.Request()
+		switch letter.URL {
+		case "https://a.com/form":
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(req.HTTPReq().Body)
+			if req.HTTPReq().Method != "POST" || string(body) != "a=1&b=2" {
+				t.Errorf("rebuilt %s with body %q", req.HTTPReq().Method, body)
+			}
+		case "https://a.com/stream":
+			if !letter.BodyDropped || err != ErrBodyDropped {
+				t.Errorf("a letter without body was re-injectable: %+v, %v", letter, err)
+			}
+		}
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	path, store := openTestStore(t)
+	for i := 0; i < 3; i++ {
+		if err := store.Add(newTestLetter(t, fmt.Sprintf("https://a.com/%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Add(newTestLetter(t, "https://a.com/0"))
+	if n, err := store.Remove("https://a.com/1", "https://a.com/none"); err != nil || n != 1 {
+		t.Fatalf("removed %d, %v", n, err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(newTestLetter(t, "https://a.com/3")); err != ErrClosedStore {
+		t.Fatalf("add to a closed store: %v", err)
+	}
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	letters, err := store.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 2 {
+		t.Fatalf("%d letters, want 2", len(letters))
+	}
+	for _, letter := range letters {
+		if letter.URL == "https://a.com/0" && letter.Failures != 2 {
+			t.Errorf("failures %d, want 2", letter.Failures)
+		}
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	path, store := openTestStore(t)
+	defer store.Close()
+	// 另一个进程打开同一个存储文件并追加死信。
+	other, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Add(newTestLetter(t, "https://b.com/")); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+	for i := 0; i < 200; i++ {
+		if err := store.Add(newTestLetter(t, "https://a.com/")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ms := store.(*myStore)
+	if ms.records > 2*len(ms.letterMap)+64 {
+		t.Fatalf("the store wasn't compacted: %d records", ms.records)
+	}
+	store.Close()
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened.Len() != 2 {
+		t.Fatalf("%d letters, want 2", reopened.Len())
+	}
+	letters, _ := reopened.List(Filter{Host: "a.com"})
+	if len(letters) != 1 || letters[0].Failures != 200 {
+		t.Fatalf("unexpected letters: %+v", letters)
+	}
+}
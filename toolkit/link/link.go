@@ -0,0 +1,320 @@
+package link
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Kind 链接的种类。
+type Kind string
+
+// 链接的种类。
+const (
+	// KIND_ANCHOR 超链接，来自a和area元素的href属性。
+	KIND_ANCHOR Kind = "anchor"
+	// KIND_IMAGE 图片，来自img元素的src和srcset属性、source元素的srcset属性、
+	// video元素的poster属性以及图片类型的input元素的src属性。
+	KIND_IMAGE Kind = "image"
+	// KIND_STYLESHEET 样式表，来自rel为stylesheet的link元素。
+	KIND_STYLESHEET Kind = "stylesheet"
+	// KIND_LINK 其他的关联资源，来自rel不是stylesheet的link元素，例如icon、alternate和canonical。
+	KIND_LINK Kind = "link"
+	// KIND_SCRIPT 脚本，来自script元素的src属性。
+	KIND_SCRIPT Kind = "script"
+	// KIND_FRAME 框架，来自iframe和frame元素的src属性。
+	KIND_FRAME Kind = "frame"
+	// KIND_MEDIA 媒体，来自source、video、audio、track和embed元素的src属性以及object元素的data属性。
+	KIND_MEDIA Kind = "media"
+	// KIND_CSS 样式中引用的资源，来自style元素和style属性中的url()和@import。
+	KIND_CSS Kind = "css"
+	// KIND_REFRESH 刷新的目标，来自http-equiv为refresh的meta元素。
+	KIND_REFRESH Kind = "refresh"
+)
+
+// Link 从页面中提取的链接。
+type Link struct {
+	// URL 已解析为绝对URL的链接。其中不包含片段。
+	URL *url.URL
+	// Kind 链接的种类。
+	Kind Kind
+	// Tag 链接所在的元素的名称。
+	Tag string
+	// Attr 链接所在的属性的名称。来自style元素的链接为空。
+	Attr string
+	// Rel link、a和area元素的rel属性的值（已转为小写）。
+	Rel string
+}
+
+// selectorRule 按照元素和属性提取链接的规则。
+type selectorRule struct {
+	// selector 链接所在元素的CSS选择器。
+	selector string
+	// attr 链接所在的属性。
+	attr string
+	// kind 链接的种类。为空时由link元素的rel属性决定。
+	kind Kind
+	// srcset 属性的值是否为srcset格式。
+	srcset bool
+}
+
+// selectorRules 按照元素和属性提取链接的规则列表。
+var selectorRules = []selectorRule{
+	{selector: "a[href], area[href]", attr: "href", kind: KIND_ANCHOR},
+	{selector: "link[href]", attr: "href"},
+	{selector: "script[src]", attr: "src", kind: KIND_SCRIPT},
+	{selector: "iframe[src], frame[src]", attr: "src", kind: KIND_FRAME},
+	{selector: "img[src]", attr: "src", kind: KIND_IMAGE},
+	{selector: "img[srcset], source[srcset]", attr: "srcset", kind: KIND_IMAGE, srcset: true},
+	{selector: "input[type=image i][src]", attr: "src", kind: KIND_IMAGE},
+	{selector: "video[poster]", attr: "poster", kind: KIND_IMAGE},
+	{selector: "source[src], video[src], audio[src], track[src], embed[src]", attr: "src", kind: KIND_MEDIA},
+	{selector: "object[data]", attr: "data", kind: KIND_MEDIA},
+}
+
+// cssURLPattern 样式中的url()的正则表达式。
+var cssURLPattern = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^'"()\s]*))\s*\)`)
+
+// cssImportPattern 样式中以字符串形式引用的@import的正则表达式。
+var cssImportPattern = regexp.MustCompile(`(?i)@import\s+(?:"([^"]*)"|'([^']*)')`)
+
+// Parse 解析给定的HTML内容并从中提取链接。
+// 参数pageURL 页面的URL，相对链接会以它（或者页面中的base元素）为基准来解析。
+func Parse(reader io.Reader, pageURL *url.URL) ([]Link, error) {
+	doc, err := goquery.NewDocumentFromReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return Extract(doc, pageURL), nil
+}
+
+// Extract 从给定的HTML文档中提取链接。
+// 相对链接会以页面中第一个带有href属性的base元素为基准来解析，没有时以pageURL为基准。
+// 结果中不会包含重复的链接（URL和种类都相同），也不会包含http和https之外的链接。
+func Extract(doc *goquery.Document, pageURL *url.URL) []Link {
+	e := &extractor{
+		baseURL: BaseURL(doc, pageURL),
+		seen:    map[string]struct{}{},
+	}
+	for _, rule := range selectorRules {
+		doc.Find(rule.selector).Each(func(index int, sel *goquery.Selection) {
+			value, _ := sel.Attr(rule.attr)
+			tag := goquery.NodeName(sel)
+			kind := rule.kind
+			var rel string
+			if tag == "a" || tag == "area" || tag == "link" {
+				rel = strings.ToLower(strings.TrimSpace(sel.AttrOr("rel", "")))
+			}
+			if kind == "" {
+				kind = KIND_LINK
+				if hasToken(rel, "stylesheet") {
+					kind = KIND_STYLESHEET
+				}
+			}
+			if rule.srcset {
+				for _, candidate := range ParseSrcset(value) {
+					e.add(candidate, Link{Kind: kind, Tag: tag, Attr: rule.attr})
+				}
+				return
+			}
+			e.add(value, Link{Kind: kind, Tag: tag, Attr: rule.attr, Rel: rel})
+		})
+	}
+	doc.Find("style").Each(func(index int, sel *goquery.Selection) {
+		for _, ref := range ParseCSS(sel.Text()) {
+			e.add(ref, Link{Kind: KIND_CSS, Tag: "style"})
+		}
+	})
+	doc.Find("[style]").Each(func(index int, sel *goquery.Selection) {
+		style, _ := sel.Attr("style")
+		for _, ref := range ParseCSS(style) {
+			e.add(ref, Link{Kind: KIND_CSS, Tag: goquery.NodeName(sel), Attr: "style"})
+		}
+	})
+	doc.Find("meta[http-equiv][content]").Each(func(index int, sel *goquery.Selection) {
+		if !strings.EqualFold(strings.TrimSpace(sel.AttrOr("http-equiv", "")), "refresh") {
+			return
+		}
+		if target := ParseRefresh(sel.AttrOr("content", "")); target != "" {
+			e.add(target, Link{Kind: KIND_REFRESH, Tag: "meta", Attr: "content"})
+		}
+	})
+	return e.links
+}
+
+// Filter 从给定的链接列表中选出属于给定种类的链接。
+func Filter(links []Link, kinds ...Kind) []Link {
+	filtered := make([]Link, 0, len(links))
+	for _, link := range links {
+		for _, kind := range kinds {
+			if link.Kind == kind {
+				filtered = append(filtered, link)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// BaseURL 获取解析相对链接时使用的基准URL。
+// 若页面中有带有href属性的base元素，则以第一个这样的元素为准（其自身以pageURL为基准来解析），
+// 否则即为pageURL。
+func BaseURL(doc *goquery.Document, pageURL *url.URL) *url.URL {
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok {
+		return pageURL
+	}
+	baseURL, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return pageURL
+	}
+	if pageURL != nil {
+		baseURL = pageURL.ResolveReference(baseURL)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return pageURL
+	}
+	return baseURL
+}
+
+// ParseSrcset 解析srcset属性的值，并返回其中的各个URL。
+// 各候选项以逗号分隔，每一项由URL和可选的宽度或像素密度描述符组成。
+func ParseSrcset(srcset string) []string {
+	var urls []string
+	s := srcset
+	for {
+		s = strings.TrimLeft(s, " \t\r\n\f,")
+		if s == "" {
+			return urls
+		}
+		end := strings.IndexAny(s, " \t\r\n\f")
+		if end < 0 {
+			end = len(s)
+		}
+		candidate := s[:end]
+		s = s[end:]
+		// URL以逗号结尾时意味着该候选项没有描述符。
+		if trimmed := strings.TrimRight(candidate, ","); trimmed != candidate {
+			urls = append(urls, trimmed)
+			continue
+		}
+		urls = append(urls, candidate)
+		// 跳过描述符，直到下一个不在括号中的逗号。
+		var depth int
+		index := len(s)
+		for i, c := range s {
+			if c == '(' {
+				depth++
+			} else if c == ')' && depth > 0 {
+				depth--
+			} else if c == ',' && depth == 0 {
+				index = i
+				break
+			}
+		}
+		s = s[index:]
+	}
+}
+
+// ParseCSS 从样式中提取url()以及@import引用的URL。
+func ParseCSS(css string) []string {
+	var urls []string
+	for _, pattern := range []*regexp.Regexp{cssURLPattern, cssImportPattern} {
+		for _, match := range pattern.FindAllStringSubmatch(css, -1) {
+			for _, group := range match[1:] {
+				if group != "" {
+					urls = append(urls, group)
+					break
+				}
+			}
+		}
+	}
+	return urls
+}
+
+// ParseRefresh 从http-equiv为refresh的meta元素的content属性中提取目标URL。
+// 其格式为“秒数; url=目标URL”，没有目标URL时返回空字符串。
+func ParseRefresh(content string) string {
+	index := strings.IndexAny(content, ";,")
+	if index < 0 {
+		return ""
+	}
+	target := strings.TrimSpace(content[index+1:])
+	if len(target) >= 4 && strings.EqualFold(target[:3], "url") {
+		rest := strings.TrimSpace(target[3:])
+		if strings.HasPrefix(rest, "=") {
+			target = strings.TrimSpace(rest[1:])
+		}
+	}
+	if len(target) >= 2 && (target[0] == '"' || target[0] == '\'') {
+		quote := target[0]
+		target = target[1:]
+		if end := strings.IndexByte(target, quote); end >= 0 {
+			target = target[:end]
+		}
+	}
+	return strings.TrimSpace(target)
+}
+
+// extractor 链接提取器。
+type extractor struct {
+	// baseURL 解析相对链接时使用的基准URL。
+	baseURL *url.URL
+	// seen 已提取的链接的集合，键由种类和URL组成。
+	seen map[string]struct{}
+	// links 已提取的链接的列表。
+	links []Link
+}
+
+// add 解析给定的链接，并在其有效且未重复时将其加入列表。
+func (e *extractor) add(ref string, link Link) {
+	linkURL := Resolve(e.baseURL, ref)
+	if linkURL == nil {
+		return
+	}
+	key := string(link.Kind) + " " + linkURL.String()
+	if _, ok := e.seen[key]; ok {
+		return
+	}
+	e.seen[key] = struct{}{}
+	link.URL = linkURL
+	e.links = append(e.links, link)
+}
+
+// Resolve 以给定的基准URL解析链接，并返回不包含片段的绝对URL。
+// 空链接、锚点链接以及javascript、mailto、data等链接会被忽略（返回nil）。
+func Resolve(baseURL *url.URL, ref string) *url.URL {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return nil
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil
+	}
+	if !u.IsAbs() {
+		if baseURL == nil {
+			return nil
+		}
+		u = baseURL.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u
+}
+
+// hasToken 判断以空白分隔的列表中是否包含给定的值。
+func hasToken(list, token string) bool {
+	for _, field := range strings.Fields(list) {
+		if field == token {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package link
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	for _, tc := range []struct {
+		srcset string
+		want   []string
+	}{
+		{"", nil},
+		{"a.png", []string{"a.png"}},
+		{"a.png 1x, b.png 2x", []string{"a.png", "b.png"}},
+		{"a.png 100w,b.png 200w", []string{"a.png", "b.png"}},
+		{"  a.png,  b.png  ", []string{"a.png", "b.png"}},
+		// 逗号之后没有空白时仍属于URL。
+		{"a.png,b.png", []string{"a.png,b.png"}},
+		{"a.png, b.png 2x", []string{"a.png", "b.png"}},
+		{"img/a,b.png 1x, c.png 2x", []string{"img/a,b.png", "c.png"}},
+		{"a.png 1x (max-width: 10px, 20px), b.png", []string{"a.png", "b.png"}},
+		{"\ta.png\n1.5x,\nb.png\t3x", []string{"a.png", "b.png"}},
+		{",,a.png,,", []string{"a.png"}},
+	} {
+		if got := ParseSrcset(tc.srcset); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseSrcset(%q) = %q, want %q", tc.srcset, got, tc.want)
+		}
+	}
+}
+
+func TestParseCSS(t *testing.T) {
+	for _, tc := range []struct {
+		css  string
+		want []string
+	}{
+		{"", nil},
+		{"body { background: url(bg.png) }", []string{"bg.png"}},
+		{`a { background: URL( "x y.png" ) } b { background: url('z.png') }`, []string{"x y.png", "z.png"}},
+		{"a { background: url() }", nil},
+		{`@import "base.css"; @import 'print.css' print;`, []string{"base.css", "print.css"}},
+		{`@import url(theme.css);`, []string{"theme.css"}},
+		{"div { color: red }", nil},
+	} {
+		if got := ParseCSS(tc.css); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseCSS(%q) = %q, want %q", tc.css, got, tc.want)
+		}
+	}
+}
+
+func TestParseRefresh(t *testing.T) {
+	for _, tc := range []struct {
+		content string
+		want    string
+	}{
+		{"5", ""},
+		{"0; url=/next", "/next"},
+		{"0;URL=/next", "/next"},
+		{"0; url = /next ", "/next"},
+		{`0; url="/quoted page"`, "/quoted page"},
+		{`0; url='/single'; ignored`, "/single"},
+		{"0, /comma", "/comma"},
+		{"0; /no-prefix", "/no-prefix"},
+		{"0; url=", ""},
+	} {
+		if got := ParseRefresh(tc.content); got != tc.want {
+			t.Errorf("ParseRefresh(%q) = %q, want %q", tc.content, got, tc.want)
+		}
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/dir/page.html")
+	for _, tc := range []struct {
+		name string
+		html string
+		want string
+	}{
+		{"none", `<html></html>`, "https://example.com/dir/page.html"},
+		{"absolute", `<base href="https://cdn.com/static/">`, "https://cdn.com/static/"},
+		{"relative", `<base href="../assets/">`, "https://example.com/assets/"},
+		{"first with href", `<base target="_blank"><base href="/a/"><base href="/b/">`, "https://example.com/a/"},
+		{"unsupported scheme", `<base href="javascript:void(0)">`, "https://example.com/dir/page.html"},
+	} {
+		links, err := Parse(strings.NewReader(tc.html+`<a href="x">x</a>`), pageURL)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		want, _ := url.Parse(tc.want)
+		want = want.ResolveReference(&url.URL{Path: "x"})
+		if len(links) != 1 || links[0].URL.String() != want.String() {
+			t.Errorf("%s: links %v, want [%s]", tc.name, links, want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/dir/page.html")
+	html := `<html><head>
+<base href="/base/">
+<link rel="Stylesheet" href="main.css"><link rel="icon" href="/favicon.ico">
+<meta http-equiv="Refresh" content="3; url='/next'">
+<script src="app.js"></script>
+<style>@import "theme.css"; body { background: url(bg.png) }</style>
+</head><body>
+<a href="a.html#top" rel="nofollow">a</a><a href="a.html">dup</a><a href="#only">anchor</a>
+<a href="mailto:x@example.com">mail</a><a href="javascript:void(0)">js</a><a href=" ">blank</a>
+<area href="https://other.com/area">
+<iframe src="frame.html"></iframe>
+<img src="a.html" srcset="small.png 1x, large.png 2x">
+<video poster="poster.jpg" src="movie.mp4"></video>
+<div style="background-image: url('div.png')"></div>
+<object data="obj.swf"></object>
+</body></html>`
+	links, err := Parse(strings.NewReader(html), pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type simple struct {
+		url  string
+		kind Kind
+		tag  string
+		attr string
+		rel  string
+	}
+	var got []simple
+	for _, l := range links {
+		got = append(got, simple{l.URL.String(), l.Kind, l.Tag, l.Attr, l.Rel})
+	}
+	base := "https://example.com/base/"
+	want := []simple{
+		{base + "a.html", KIND_ANCHOR, "a", "href", "nofollow"},
+		{"https://other.com/area", KIND_ANCHOR, "area", "href", ""},
+		{base + "main.css", KIND_STYLESHEET, "link", "href", "stylesheet"},
+		{"https://example.com/favicon.ico", KIND_LINK, "link", "href", "icon"},
+		{base + "app.js", KIND_SCRIPT, "script", "src", ""},
+		{base + "frame.html", KIND_FRAME, "iframe", "src", ""},
+		{base + "a.html", KIND_IMAGE, "img", "src", ""},
+		{base + "small.png", KIND_IMAGE, "img", "srcset", ""},
+		{base + "large.png", KIND_IMAGE, "img", "srcset", ""},
+		{base + "poster.jpg", KIND_IMAGE, "video", "poster", ""},
+		{base + "movie.mp4", KIND_MEDIA, "video", "src", ""},
+		{base + "obj.swf", KIND_MEDIA, "object", "data", ""},
+		{base + "bg.png", KIND_CSS, "style", "", ""},
+		{base + "theme.css", KIND_CSS, "style", "", ""},
+		{base + "div.png", KIND_CSS, "div", "style", ""},
+		{"https://example.com/next", KIND_REFRESH, "meta", "content", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got links:\n%v\nwant:\n%v", got, want)
+	}
+	frames := Filter(links, KIND_FRAME, KIND_REFRESH)
+	if len(frames) != 2 || frames[0].Kind != KIND_FRAME || frames[1].Kind != KIND_REFRESH {
+		t.Fatalf("unexpected filtered links: %v", frames)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/a/b")
+	for ref, want := range map[string]string{
+		"c":                      "https://example.com/a/c",
+		" ../c#frag ":            "https://example.com/c",
+		"//cdn.com/x":            "https://cdn.com/x",
+		"HTTP://Other.com/y":     "http://Other.com/y",
+		"#frag":                  "",
+		"":                       "",
+		"data:text/plain,x":      "",
+		"ftp://example.com/f":    "",
+		"javascript:alert(1)":    "",
+		"http://[::1]:namedport": "",
+	} {
+		got := Resolve(baseURL, ref)
+		if (got == nil) != (want == "") || (got != nil && got.String() != want) {
+			t.Errorf("Resolve(%q) = %v, want %q", ref, got, want)
+		}
+	}
+	if got := Resolve(nil, "relative"); got != nil {
+		t.Errorf("Resolve(nil, relative) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,179 @@
+package proxypool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestHealthTransitions(t *testing.T) {
+	pool, err := New([]string{"http://127.0.0.1:1", "http://127.0.0.1:2"}, Options{
+		MaxFailures:    2,
+		RetestInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := mustParseURL(t, "http://127.0.0.1:1")
+	pool.Report(bad, fmt.Errorf("boom"))
+	pool.Report(bad, nil)
+	pool.Report(bad, fmt.Errorf("boom"))
+	if !pool.Stats()[0].Healthy {
+		t.Fatal("a success didn't reset the consecutive failures")
+	}
+	pool.Report(bad, fmt.Errorf("boom"))
+	if pool.Stats()[0].Healthy {
+		t.Fatal("the proxy is still healthy")
+	}
+	for i := 0; i < 4; i++ {
+		picked, err := pool.Pick(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if picked.String() == bad.String() {
+			t.Fatal("an unhealthy proxy was picked")
+		}
+	}
+	time.Sleep(60 * time.Millisecond)
+	pool.Pick(nil)
+	stats := pool.Stats()[0]
+	if !stats.Healthy || stats.Retests != 1 {
+		t.Fatalf("the proxy wasn't retested: %+v", stats)
+	}
+	// 未设置测试URL时，重新参与选择的代理再失败一次就会再次被判定为不健康。
+	pool.Report(bad, fmt.Errorf("boom"))
+	if pool.Stats()[0].Healthy {
+		t.Fatal("the retested proxy is still healthy after another failure")
+	}
+	if _, err := New(nil, Options{}); err == nil {
+		t.Fatal("an empty pool was created")
+	}
+}
+
+func TestRetestOnlyProxy(t *testing.T) {
+	pool, err := New([]string{"http://127.0.0.1:1"}, Options{
+		MaxFailures:    1,
+		RetestInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	only := mustParseURL(t, "http://127.0.0.1:1")
+	pool.Report(only, fmt.Errorf("boom"))
+	if _, err := pool.Pick(nil); err != ErrNoHealthyProxy {
+		t.Fatalf("unexpected error with no healthy proxy: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	// 到期重新测试的代理应该可以被同一次选择选中。
+	for i := 0; i < 2; i++ {
+		picked, err := pool.Pick(nil)
+		if err != nil {
+			t.Fatalf("pick %d after the retest interval: %v", i, err)
+		}
+		if picked.String() != only.String() {
+			t.Fatalf("picked %s, want %s", picked, only)
+		}
+	}
+}
+
+func TestRetestThroughProxy(t *testing.T) {
+	status := int32(http.StatusServiceUnavailable)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer proxy.Close()
+	pool, err := New([]string{proxy.URL}, Options{
+		MaxFailures:    1,
+		RetestInterval: 10 * time.Millisecond,
+		TestURL:        "http://example.invalid/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyURL := mustParseURL(t, proxy.URL)
+	pool.Report(proxyURL, fmt.Errorf("boom"))
+	waitRetest := func(retests uint64) ProxyStats {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			pool.Pick(nil)
+			stats := pool.Stats()[0]
+			mp := pool.(*myPool)
+			mp.lock.Lock()
+			busy := mp.proxies[0].testing
+			mp.lock.Unlock()
+			if stats.Retests >= retests && !busy {
+				return stats
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatal("timeout waiting for retest")
+		return ProxyStats{}
+	}
+	if stats := waitRetest(1); stats.Healthy {
+		t.Fatalf("the proxy passed a failed test: %+v", stats)
+	}
+	atomic.StoreInt32(&status, http.StatusOK)
+	deadline := time.Now().Add(5 * time.Second)
+	for !pool.Stats()[0].Healthy {
+		if time.Now().After(deadline) {
+			t.Fatal("the proxy didn't recover")
+		}
+		pool.Pick(nil)
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStickyEviction(t *testing.T) {
+	pool, err := New([]string{"http://127.0.0.1:1", "http://127.0.0.1:2", "http://127.0.0.1:3"}, Options{
+		Strategy:       STRATEGY_STICKY,
+		MaxStickyHosts: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pick := func(host string) string {
+		picked, err := pool.Pick(&url.URL{Scheme: "http", Host: host})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return picked.String()
+	}
+	a := pick("a.com")
+	for i := 0; i < 3; i++ {
+		if pick("a.com") != a {
+			t.Fatal("a.com changed its proxy")
+		}
+	}
+	pick("b.com")
+	pick("a.com")
+	pick("c.com")
+	mp := pool.(*myPool)
+	if len(mp.sticky) != 2 || mp.stickyList.Len() != 2 {
+		t.Fatalf("%d sticky hosts, want 2", len(mp.sticky))
+	}
+	if _, ok := mp.sticky["b.com"]; ok {
+		t.Fatal("the least recently used host wasn't evicted")
+	}
+	if _, ok := mp.sticky["a.com"]; !ok {
+		t.Fatal("a recently used host was evicted")
+	}
+	// 固定使用的代理不健康时会重新选择。
+	for i := uint32(0); i < defaultMaxFailures; i++ {
+		pool.Report(mustParseURL(t, a), fmt.Errorf("boom"))
+	}
+	if pick("a.com") == a {
+		t.Fatal("an unhealthy sticky proxy was picked")
+	}
+}
@@ -2,40 +2,202 @@ package reader
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"sync"
 )
 
+// DefaultMemoryThreshold 默认的内存阈值。
+// 超过此长度的数据会被转存到临时文件中。
+const DefaultMemoryThreshold = 4 << 20
+
+// ErrTooLarge 表示数据超出最大长度的错误。
+var ErrTooLarge = errors.New("multiple reader: data too large")
+
+// ErrClosedMultipleReader 表示多重读取器已关闭的错误。
+var ErrClosedMultipleReader = errors.New("multiple reader: closed")
+
 // MultipleReader 多重读取器的接口。
 type MultipleReader interface {
 	// Reader 获取一个可关闭读取器的实例。
 	// 后者会持有本多重读取器中的数据。
+	// 每次获取的读取器都是相互独立的，使用完毕后应该将其关闭。
 	Reader() io.ReadCloser
+	// Size 获取数据的长度。
+	Size() int64
+	// Truncated 判断数据是否因超出最大长度而被截断。
+	Truncated() bool
+	// Close 关闭多重读取器。
+	// 之后将无法再获取读取器，但已获取的读取器在关闭之前仍然可用。
+	// 所有读取器都关闭之后，相关的临时文件会被删除。
+	Close() error
+}
+
+// Options 多重读取器的可选项。
+type Options struct {
+	// MaxSize 数据的最大长度。为0时表示不限制。
+	MaxSize int64 `json:"max_size,omitempty"`
+	// Truncate 数据超出最大长度时是否截断。
+	// 为false时会拒绝这样的数据并返回ErrTooLarge。
+	Truncate bool `json:"truncate"`
+	// MemoryThreshold 内存阈值。
+	// 超过此长度的数据会被转存到临时文件中。为0时使用DefaultMemoryThreshold。
+	MemoryThreshold int64 `json:"memory_threshold,omitempty"`
+	// TempDir 存放临时文件的目录。为空时使用系统默认的临时目录。
+	TempDir string `json:"temp_dir,omitempty"`
 }
 
 // myMultipleReader 多重读取器的实现类型。
+// 数据较少时保存在内存中，否则保存在临时文件中。
 type myMultipleReader struct {
+	// data 保存在内存中的数据。
 	data []byte
+	// file 保存数据的临时文件。为nil时表示数据保存在内存中。
+	file *os.File
+	// size 数据的长度。
+	size int64
+	// truncated 数据是否被截断。
+	truncated bool
+	// refs 临时文件的引用计数，包括多重读取器自身和未关闭的读取器。
+	refs int
+	// closed 多重读取器是否已关闭。
+	closed bool
+	// lock 保护引用计数和关闭状态的互斥锁。
+	lock sync.Mutex
 }
 
 // NewMultipleReader 新建并返回一个多重读取器的实例。
+// 不限制数据的长度，超过DefaultMemoryThreshold的数据会被转存到临时文件中。
 func NewMultipleReader(reader io.Reader) (MultipleReader, error) {
-	var data []byte
-	var err error
-	if reader != nil {
-		data, err = ioutil.ReadAll(reader)
+	return NewMultipleReaderWithOptions(reader, Options{})
+}
+
+// NewMultipleReaderWithOptions 根据给定的可选项新建并返回一个多重读取器的实例。
+func NewMultipleReaderWithOptions(reader io.Reader, opts Options) (MultipleReader, error) {
+	if reader == nil {
+		return &myMultipleReader{data: []byte{}, refs: 1}, nil
+	}
+	threshold := opts.MemoryThreshold
+	if threshold <= 0 {
+		threshold = DefaultMemoryThreshold
+	}
+	// 多读取一个字节以便判断数据是否超出最大长度。
+	src := reader
+	if opts.MaxSize > 0 {
+		src = io.LimitReader(reader, opts.MaxSize+1)
+	}
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, src, threshold+1)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("multiple reader: couldn't create a new one: %s", err)
+	}
+	mr := &myMultipleReader{refs: 1}
+	if n <= threshold {
+		mr.data = buf.Bytes()
+		mr.size = n
+	} else {
+		file, err := ioutil.TempFile(opts.TempDir, "multiple-reader-*")
 		if err != nil {
+			return nil, fmt.Errorf("multiple reader: couldn't create a temp file: %s", err)
+		}
+		mr.file = file
+		written, err := io.Copy(file, io.MultiReader(&buf, src))
+		if err != nil {
+			mr.release()
 			return nil, fmt.Errorf("multiple reader: couldn't create a new one: %s", err)
 		}
-	} else {
-		data = []byte{}
+		mr.size = written
 	}
-	return &myMultipleReader{
-		data: data,
-	}, nil
+	if opts.MaxSize > 0 && mr.size > opts.MaxSize {
+		if !opts.Truncate {
+			mr.release()
+			return nil, ErrTooLarge
+		}
+		mr.size = opts.MaxSize
+		mr.truncated = true
+		if mr.file == nil {
+			mr.data = mr.data[:mr.size]
+		}
+	}
+	return mr, nil
 }
 
 func (mr *myMultipleReader) Reader() io.ReadCloser {
-	return ioutil.NopCloser(bytes.NewReader(mr.data))
+	if mr.file == nil {
+		return ioutil.NopCloser(bytes.NewReader(mr.data))
+	}
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	if mr.closed {
+		return ioutil.NopCloser(errReader{ErrClosedMultipleReader})
+	}
+	mr.refs++
+	return &fileReader{
+		Reader: io.NewSectionReader(mr.file, 0, mr.size),
+		mr:     mr,
+	}
+}
+
+func (mr *myMultipleReader) Size() int64 {
+	return mr.size
+}
+
+func (mr *myMultipleReader) Truncated() bool {
+	return mr.truncated
+}
+
+func (mr *myMultipleReader) Close() error {
+	mr.lock.Lock()
+	if mr.closed {
+		mr.lock.Unlock()
+		return nil
+	}
+	mr.closed = true
+	mr.lock.Unlock()
+	return mr.release()
+}
+
+// release 释放一个对临时文件的引用。
+// 引用计数归零时会关闭并删除临时文件。
+func (mr *myMultipleReader) release() error {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	mr.refs--
+	if mr.refs > 0 || mr.file == nil {
+		return nil
+	}
+	err := mr.file.Close()
+	if removeErr := os.Remove(mr.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// fileReader 读取临时文件中的数据的读取器。
+type fileReader struct {
+	io.Reader
+	// mr 所属的多重读取器。
+	mr *myMultipleReader
+	// once 保证只释放一次引用。
+	once sync.Once
+}
+
+func (reader *fileReader) Close() error {
+	var err error
+	reader.once.Do(func() {
+		err = reader.mr.release()
+	})
+	return err
+}
+
+// errReader 总是返回给定错误的读取器。
+type errReader struct {
+	err error
+}
+
+func (reader errReader) Read(p []byte) (int, error) {
+	return 0, reader.err
 }
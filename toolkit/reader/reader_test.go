@@ -0,0 +1,171 @@
+package reader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// tempDir 创建测试用的临时目录，并在测试结束时删除它。
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// tempFiles 获取给定目录中的文件的数量。
+func tempFiles(t *testing.T, dir string) int {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(infos)
+}
+
+// readAll 从多重读取器获取一个读取器并读取全部数据。
+func readAll(t *testing.T, mr MultipleReader) string {
+	reader := mr.Reader()
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMultipleReaderInMemory(t *testing.T) {
+	dir := tempDir(t)
+	content := strings.Repeat("a", 100)
+	mr, err := NewMultipleReaderWithOptions(strings.NewReader(content),
+		Options{MemoryThreshold: 100, TempDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	if n := tempFiles(t, dir); n != 0 {
+		t.Fatalf("%d temp files for data within the threshold", n)
+	}
+	for i := 0; i < 2; i++ {
+		if got := readAll(t, mr); got != content {
+			t.Fatalf("read %d bytes, want %d", len(got), len(content))
+		}
+	}
+	if mr.Size() != 100 || mr.Truncated() {
+		t.Fatalf("size %d, truncated %v", mr.Size(), mr.Truncated())
+	}
+}
+
+func TestMultipleReaderSpillsToDisk(t *testing.T) {
+	dir := tempDir(t)
+	content := strings.Repeat("0123456789", 100)
+	mr, err := NewMultipleReaderWithOptions(strings.NewReader(content),
+		Options{MemoryThreshold: 64, TempDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := tempFiles(t, dir); n != 1 {
+		t.Fatalf("%d temp files for data beyond the threshold, want 1", n)
+	}
+	if mr.Size() != int64(len(content)) {
+		t.Fatalf("size %d, want %d", mr.Size(), len(content))
+	}
+	// 各个读取器相互独立。
+	r1, r2 := mr.Reader(), mr.Reader()
+	head := make([]byte, 10)
+	if _, err := r1.Read(head); err != nil || string(head) != "0123456789" {
+		t.Fatalf("read %q, %v", head, err)
+	}
+	if data, _ := ioutil.ReadAll(r2); string(data) != content {
+		t.Fatalf("the second reader read %d bytes, want %d", len(data), len(content))
+	}
+	r2.Close()
+	// 关闭多重读取器之后，未关闭的读取器仍然可用。
+	if err := mr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := ioutil.ReadAll(r1); string(head)+string(rest) != content {
+		t.Fatal("the open reader was broken by closing the multiple reader")
+	}
+	if n := tempFiles(t, dir); n != 1 {
+		t.Fatalf("the temp file was removed with an open reader")
+	}
+	if _, err := ioutil.ReadAll(mr.Reader()); err != ErrClosedMultipleReader {
+		t.Fatalf("unexpected error after closing: %v", err)
+	}
+	r1.Close()
+	r1.Close()
+	if n := tempFiles(t, dir); n != 0 {
+		t.Fatalf("%d temp files left after all readers were closed", n)
+	}
+	if err := mr.Close(); err != nil {
+		t.Fatalf("unexpected error of closing twice: %v", err)
+	}
+}
+
+func TestMultipleReaderMaxSize(t *testing.T) {
+	content := strings.Repeat("x", 200)
+	for _, tc := range []struct {
+		name      string
+		threshold int64
+	}{
+		{"memory", 1000},
+		{"disk", 16},
+	} {
+		dir := tempDir(t)
+		opts := Options{MaxSize: 150, MemoryThreshold: tc.threshold, TempDir: dir}
+		if _, err := NewMultipleReaderWithOptions(strings.NewReader(content), opts); err != ErrTooLarge {
+			t.Fatalf("%s: unexpected error for too large data: %v", tc.name, err)
+		}
+		if n := tempFiles(t, dir); n != 0 {
+			t.Fatalf("%s: %d temp files left for rejected data", tc.name, n)
+		}
+		opts.Truncate = true
+		mr, err := NewMultipleReaderWithOptions(strings.NewReader(content), opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := readAll(t, mr); got != content[:150] || mr.Size() != 150 || !mr.Truncated() {
+			t.Fatalf("%s: read %d bytes, size %d, truncated %v", tc.name, len(got), mr.Size(), mr.Truncated())
+		}
+		mr.Close()
+		// 数据的长度恰好等于最大长度时不算超出。
+		opts.Truncate = false
+		mr, err = NewMultipleReaderWithOptions(strings.NewReader(content[:150]), opts)
+		if err != nil {
+			t.Fatalf("%s: unexpected error for data of the max size: %v", tc.name, err)
+		}
+		if mr.Truncated() {
+			t.Fatalf("%s: data of the max size was truncated", tc.name)
+		}
+		mr.Close()
+		if n := tempFiles(t, dir); n != 0 {
+			t.Fatalf("%s: %d temp files left", tc.name, n)
+		}
+	}
+}
+
+func TestMultipleReaderNil(t *testing.T) {
+	mr, err := NewMultipleReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, mr); got != "" || mr.Size() != 0 {
+		t.Fatalf("read %q from nil, size %d", got, mr.Size())
+	}
+	if err := mr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mr, err = NewMultipleReader(bytes.NewReader([]byte("abc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	if got := readAll(t, mr); got != "abc" {
+		t.Fatalf("read %q, want %q", got, "abc")
+	}
+}
@@ -0,0 +1,235 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSize robots.txt内容的最大解析长度。超出部分会被忽略。
+const MaxSize = 500 << 10
+
+// Robots robots.txt的解析结果。
+type Robots struct {
+	// groups 规则组列表。
+	groups []*Group
+	// sitemaps 声明的站点地图的URL列表。
+	sitemaps []string
+}
+
+// Group 针对某些用户代理的规则组。
+type Group struct {
+	// agents 规则组适用的用户代理列表（已转为小写）。
+	agents []string
+	// rules 规则列表。
+	rules []rule
+	// crawlDelay 抓取间隔。
+	crawlDelay time.Duration
+}
+
+// rule 单条Allow或Disallow规则。
+type rule struct {
+	// allow 是否为Allow规则。
+	allow bool
+	// pattern 路径模式。
+	pattern string
+}
+
+// allowAllGroup 允许一切的规则组。
+var allowAllGroup = &Group{}
+
+// disallowAllGroup 禁止一切的规则组。
+var disallowAllGroup = &Group{rules: []rule{{allow: false, pattern: "/"}}}
+
+// AllowAll 返回允许一切的解析结果。
+// 当robots.txt不存在（4xx）时使用。
+func AllowAll() *Robots {
+	return &Robots{groups: []*Group{allowAllGroup}}
+}
+
+// DisallowAll 返回禁止一切的解析结果。
+// 当robots.txt暂时无法获取（5xx或网络错误）时使用。
+func DisallowAll() *Robots {
+	return &Robots{groups: []*Group{{agents: []string{"*"}, rules: disallowAllGroup.rules}}}
+}
+
+// Parse 解析robots.txt的内容。
+func Parse(reader io.Reader) (*Robots, error) {
+	robots := &Robots{}
+	var current *Group
+	// inAgents 表示是否正处于连续的User-agent行之中。
+	var inAgents bool
+	scanner := bufio.NewScanner(io.LimitReader(reader, MaxSize))
+	scanner.Buffer(make([]byte, 0, 4096), MaxSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		index := strings.Index(line, ":")
+		if index < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:index]))
+		value := strings.TrimSpace(line[index+1:])
+		switch key {
+		case "user-agent":
+			if !inAgents || current == nil {
+				current = &Group{}
+				robots.groups = append(robots.groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+			continue
+		case "allow", "disallow":
+			if current != nil && value != "" {
+				current.rules = append(current.rules,
+					rule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if current != nil {
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					current.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			if value != "" {
+				robots.sitemaps = append(robots.sitemaps, value)
+			}
+		}
+		inAgents = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return robots, nil
+}
+
+// Sitemaps 获取robots.txt中声明的站点地图的URL列表。
+func (robots *Robots) Sitemaps() []string {
+	sitemaps := make([]string, len(robots.sitemaps))
+	copy(sitemaps, robots.sitemaps)
+	return sitemaps
+}
+
+// Group 获取适用于给定用户代理的规则组。
+// 会选用用户代理名称匹配最长的规则组，都不匹配时选用“*”规则组。
+// 若仍未找到，则返回允许一切的规则组。
+func (robots *Robots) Group(userAgent string) *Group {
+	token := ProductToken(userAgent)
+	var matched *Group
+	var matchedLen int
+	var fallback *Group
+	for _, group := range robots.groups {
+		for _, agent := range group.agents {
+			if agent == "*" {
+				if fallback == nil {
+					fallback = group
+				} else {
+					fallback = mergeGroups(fallback, group)
+				}
+				continue
+			}
+			if token == "" || !strings.HasPrefix(token, agent) {
+				continue
+			}
+			switch {
+			case len(agent) > matchedLen:
+				matched = group
+				matchedLen = len(agent)
+			case len(agent) == matchedLen && matched != group:
+				matched = mergeGroups(matched, group)
+			}
+		}
+	}
+	if matched != nil {
+		return matched
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return allowAllGroup
+}
+
+// ProductToken 获取用户代理字符串中的产品标识（已转为小写）。
+// 例如“Mozilla/5.0 (compatible; Crawler/1.0)”的产品标识为“mozilla”。
+func ProductToken(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if index := strings.IndexAny(userAgent, "/ ;("); index >= 0 {
+		userAgent = userAgent[:index]
+	}
+	return strings.ToLower(userAgent)
+}
+
+// mergeGroups 合并适用于同一用户代理的两个规则组。
+func mergeGroups(g1, g2 *Group) *Group {
+	merged := &Group{
+		agents:     append(append([]string{}, g1.agents...), g2.agents...),
+		rules:      append(append([]rule{}, g1.rules...), g2.rules...),
+		crawlDelay: g1.crawlDelay,
+	}
+	if g2.crawlDelay > merged.crawlDelay {
+		merged.crawlDelay = g2.crawlDelay
+	}
+	return merged
+}
+
+// CrawlDelay 获取规则组声明的抓取间隔。未声明时为0。
+func (group *Group) CrawlDelay() time.Duration {
+	return group.crawlDelay
+}
+
+// Allowed 判断给定的路径（可包含查询部分）是否被允许抓取。
+// 路径模式匹配长度最长的规则胜出，长度相同时Allow规则优先。
+func (group *Group) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed := true
+	matchedLen := -1
+	for _, r := range group.rules {
+		if !match(r.pattern, path) {
+			continue
+		}
+		if len(r.pattern) > matchedLen ||
+			(len(r.pattern) == matchedLen && r.allow) {
+			allowed = r.allow
+			matchedLen = len(r.pattern)
+		}
+	}
+	return allowed
+}
+
+// match 判断路径是否匹配给定的模式。
+// 模式中的“*”匹配任意字符序列，结尾的“$”表示匹配路径结尾。
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		if i == len(parts)-1 && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		index := strings.Index(rest, part)
+		if index < 0 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+	if anchored {
+		return rest == ""
+	}
+	return true
+}
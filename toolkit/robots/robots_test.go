@@ -0,0 +1,190 @@
+package robots
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, content string) *Robots {
+	robots, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return robots
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/", true},
+		{"/fish", "/fish", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/fish/salmon.html", true},
+		{"/fish", "/Fish.asp", false},
+		{"/fish", "/catfish", false},
+		{"/fish/", "/fish", false},
+		{"/*", "/anything", true},
+		{"*", "/anything", true},
+		{"/fish*", "/fishheads/catfish.php?parameters", true},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php", "/windows.PHP", false},
+		{"/*.php$", "/filename.php", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/*.php$", "/filename.php5", false},
+		{"/fish*.php", "/fish.php", true},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/a*b*c", "/aXbYc", true},
+		{"/a*b*c", "/aXcYb", false},
+		{"/a*b*c$", "/abcbc", true},
+		{"/a*b*c$", "/abcb", false},
+		{"/$", "/", true},
+		{"/$", "/page", false},
+	} {
+		if got := match(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestGroupAllowed(t *testing.T) {
+	robots := mustParse(t, `User-agent: *
+Allow: /p
+Disallow: /p
+Disallow: /*.php
+Allow: /page
+Disallow: /folder/
+Allow: /folder/open$
+Allow: /$
+Disallow: /
+Allow: /public
+`)
+	group := robots.Group("testbot")
+	for path, want := range map[string]bool{
+		// 长度相同时Allow规则优先。
+		"/p": true,
+		// 匹配最长的规则胜出。
+		"/page":            true,
+		"/page.php":        false,
+		"/folder/":         false,
+		"/folder/open":     true,
+		"/folder/open/x":   false,
+		"/":                true,
+		"":                 true,
+		"/other":           false,
+		"/public/x?q=1":    true,
+		"/robots.txt":      true,
+		"/index.php?a=b":   false,
+		"/public/x.php?ok": true,
+	} {
+		if got := group.Allowed(path); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestParseEmptyDisallow(t *testing.T) {
+	robots := mustParse(t, `User-agent: testbot
+Disallow:
+
+User-agent: *
+Disallow: /
+`)
+	if !robots.Group("testbot").Allowed("/anything") {
+		t.Error("an empty Disallow line disallowed a path")
+	}
+	if robots.Group("otherbot").Allowed("/anything") {
+		t.Error("the * group was not applied to another agent")
+	}
+}
+
+func TestRobotsGroup(t *testing.T) {
+	robots := mustParse(t, `# comment
+User-agent: *
+Disallow: /all
+Crawl-delay: 1
+
+User-agent: test
+Disallow: /test
+
+User-agent: TestBot # the most specific agent
+Disallow: /testbot
+Crawl-delay: 2.5
+
+User-agent: a
+User-agent: b
+Disallow: /ab
+
+Sitemap: https://example.com/sitemap.xml
+`)
+	for _, tc := range []struct {
+		userAgent  string
+		disallowed string
+		allowed    string
+		crawlDelay time.Duration
+	}{
+		// 匹配最长的用户代理名称的规则组胜出。
+		{"TestBot/2.0 (+https://example.com/bot)", "/testbot", "/test", 2500 * time.Millisecond},
+		{"tester", "/test", "/all", 0},
+		{"otherbot", "/all", "/testbot", time.Second},
+		{"", "/all", "/ab", time.Second},
+		// 连续的User-agent行共用同一个规则组。
+		{"a", "/ab", "/all", 0},
+		{"b/1.0", "/ab", "/all", 0},
+	} {
+		group := robots.Group(tc.userAgent)
+		if group.Allowed(tc.disallowed) {
+			t.Errorf("%q: %s is allowed", tc.userAgent, tc.disallowed)
+		}
+		if !group.Allowed(tc.allowed) {
+			t.Errorf("%q: %s is disallowed", tc.userAgent, tc.allowed)
+		}
+		if group.CrawlDelay() != tc.crawlDelay {
+			t.Errorf("%q: crawl delay %s, want %s", tc.userAgent, group.CrawlDelay(), tc.crawlDelay)
+		}
+	}
+	if sitemaps := robots.Sitemaps(); len(sitemaps) != 1 || sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("unexpected sitemaps: %v", sitemaps)
+	}
+}
+
+func TestRobotsGroupFallback(t *testing.T) {
+	// 没有规则组适用时允许一切。
+	robots := mustParse(t, "User-agent: otherbot\nDisallow: /\n")
+	if !robots.Group("testbot").Allowed("/x") {
+		t.Error("disallowed without an applicable group")
+	}
+	// 规则出现在任何User-agent行之前时被忽略。
+	robots = mustParse(t, "Disallow: /\nUser-agent: *\nDisallow: /private\n")
+	group := robots.Group("testbot")
+	if !group.Allowed("/x") || group.Allowed("/private") {
+		t.Error("rules before any User-agent line were applied")
+	}
+	// 适用于同一用户代理的多个规则组会被合并。
+	robots = mustParse(t, "User-agent: testbot\nDisallow: /a\n\nUser-agent: testbot\nDisallow: /b\n")
+	group = robots.Group("testbot")
+	if group.Allowed("/a") || group.Allowed("/b") {
+		t.Error("groups for the same agent were not merged")
+	}
+	if !AllowAll().Group("testbot").Allowed("/x") || DisallowAll().Group("testbot").Allowed("/x") {
+		t.Error("unexpected result of AllowAll or DisallowAll")
+	}
+}
+
+func TestProductToken(t *testing.T) {
+	for userAgent, want := range map[string]string{
+		"Mozilla/5.0 (compatible; Crawler/1.0)": "mozilla",
+		" TestBot ":                             "testbot",
+		"bot;v=1":                               "bot",
+		"":                                      "",
+	} {
+		if got := ProductToken(userAgent); got != want {
+			t.Errorf("ProductToken(%q) = %q, want %q", userAgent, got, want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package seenset
+
+import (
+	"BeanGithub/crawler/errors"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// bloomHeaderSize 布隆过滤器快照头部的字节数。
+const bloomHeaderSize = 24
+
+// myBloomFilter 布隆过滤器的实现类型。
+type myBloomFilter struct {
+	// bits 位数组。
+	bits []uint64
+	// m 位数组的位数。
+	m uint64
+	// k 哈希函数的个数。
+	k uint64
+	// count 添加成功的键的数量。
+	count uint64
+	// rwlock 保护以上字段的读写锁。
+	rwlock sync.RWMutex
+}
+
+// NewBloomFilter 创建一个布隆过滤器。
+// 参数expectedNumber 预期的键的数量。
+// 参数falsePositiveRate 键的数量达到预期值时可以容忍的误判率，取值范围为(0, 1)。
+// 被误判为已存在的键不会被添加，因此会有少量的键被漏掉。
+func NewBloomFilter(expectedNumber uint64, falsePositiveRate float64) (SeenSet, error) {
+	if expectedNumber == 0 {
+		return nil, errors.NewIllegalParameterError("zero expected number for bloom filter")
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		errMsg := fmt.Sprintf("illegal false positive rate for bloom filter: %f", falsePositiveRate)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+	n := float64(expectedNumber)
+	m := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / n * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+	return &myBloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}, nil
+}
+
+func (bf *myBloomFilter) Kind() Kind {
+	return KIND_BLOOM
+}
+
+// locations 计算键在位数组中对应的各个位置。
+// 使用双重哈希以两个哈希值模拟k个哈希函数。
+func (bf *myBloomFilter) locations(key string) []uint64 {
+	h1 := fingerprint(key)
+	h := fnv.New64()
+	h.Write([]byte(key))
+	h2 := h.Sum64() | 1
+	locations := make([]uint64, bf.k)
+	for i := uint64(0); i < bf.k; i++ {
+		locations[i] = (h1 + i*h2) % bf.m
+	}
+	return locations
+}
+
+func (bf *myBloomFilter) Add(key string) (bool, error) {
+	locations := bf.locations(key)
+	bf.rwlock.Lock()
+	defer bf.rwlock.Unlock()
+	var added bool
+	for _, loc := range locations {
+		mask := uint64(1) << (loc % 64)
+		if bf.bits[loc/64]&mask == 0 {
+			bf.bits[loc/64] |= mask
+			added = true
+		}
+	}
+	if added {
+		bf.count++
+	}
+	return added, nil
+}
+
+func (bf *myBloomFilter) Contains(key string) (bool, error) {
+	locations := bf.locations(key)
+	bf.rwlock.RLock()
+	defer bf.rwlock.RUnlock()
+	for _, loc := range locations {
+		if bf.bits[loc/64]&(uint64(1)<<(loc%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (bf *myBloomFilter) Len() uint64 {
+	bf.rwlock.RLock()
+	defer bf.rwlock.RUnlock()
+	return bf.count
+}
+
+func (bf *myBloomFilter) Bytes() uint64 {
+	return uint64(len(bf.bits)) * 8
+}
+
+// MarshalBinary 生成布隆过滤器的快照。
+// 快照依次包含位数、哈希函数个数、键的数量以及位数组（均为小端序）。
+func (bf *myBloomFilter) MarshalBinary() ([]byte, error) {
+	bf.rwlock.RLock()
+	defer bf.rwlock.RUnlock()
+	data := make([]byte, bloomHeaderSize+len(bf.bits)*8)
+	binary.LittleEndian.PutUint64(data[0:], bf.m)
+	binary.LittleEndian.PutUint64(data[8:], bf.k)
+	binary.LittleEndian.PutUint64(data[16:], bf.count)
+	for i, word := range bf.bits {
+		binary.LittleEndian.PutUint64(data[bloomHeaderSize+i*8:], word)
+	}
+	return data, nil
+}
+
+func (bf *myBloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < bloomHeaderSize {
+		return fmt.Errorf("bloom filter: insufficient snapshot (length: %d)", len(data))
+	}
+	m := binary.LittleEndian.Uint64(data[0:])
+	k := binary.LittleEndian.Uint64(data[8:])
+	count := binary.LittleEndian.Uint64(data[16:])
+	words := (m + 63) / 64
+	if m == 0 || k == 0 || uint64(len(data)-bloomHeaderSize) != words*8 {
+		return fmt.Errorf("bloom filter: corrupted snapshot (m: %d, k: %d, length: %d)",
+			m, k, len(data))
+	}
+	bits := make([]uint64, words)
+	for i := range bits {
+		bits[i] = binary.LittleEndian.Uint64(data[bloomHeaderSize+i*8:])
+	}
+	bf.rwlock.Lock()
+	defer bf.rwlock.Unlock()
+	bf.m, bf.k, bf.count, bf.bits = m, k, count, bits
+	return nil
+}
+
+func (bf *myBloomFilter) Clear() error {
+	bf.rwlock.Lock()
+	defer bf.rwlock.Unlock()
+	bf.bits = make([]uint64, len(bf.bits))
+	bf.count = 0
+	return nil
+}
+
+func (bf *myBloomFilter) Close() error {
+	return nil
+}
@@ -0,0 +1,388 @@
+package seenset
+
+import (
+	"BeanGithub/crawler/errors"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// diskLogName 指纹日志文件的名称。
+	diskLogName = "seen.log"
+	// diskIndexName 指纹索引文件的名称。
+	diskIndexName = "seen.idx"
+	// diskIndexMagic 指纹索引文件的魔数。
+	diskIndexMagic = "SEENIDX1"
+	// diskIndexHeaderSize 指纹索引文件头部的字节数。
+	diskIndexHeaderSize = 16
+	// diskMinSlots 指纹索引的最小槽位数。
+	diskMinSlots = 1 << 16
+	// diskChunkSlots 每次从磁盘读取的槽位数。
+	diskChunkSlots = 64
+	// diskDirtyCount 索引头部中表示索引已被修改但尚未同步的键的数量。
+	diskDirtyCount = ^uint64(0)
+)
+
+// myDiskSet 基于磁盘的集合的实现类型。
+// 只保存键的64位指纹：指纹日志按添加顺序记录所有指纹，
+// 指纹索引是存放在文件中的开放寻址哈希表。
+// 内存占用与键的数量无关，查找与添加通常只需要一两次磁盘读写。
+type myDiskSet struct {
+	// dir 存放数据文件的目录。
+	dir string
+	// logFile 指纹日志文件。
+	logFile *os.File
+	// logWriter 指纹日志的写入缓冲。
+	logWriter *bufio.Writer
+	// indexFile 指纹索引文件。
+	indexFile *os.File
+	// slots 指纹索引的槽位数，总是2的幂。
+	slots uint64
+	// count 键的数量。
+	count uint64
+	// dirty 指纹索引是否有尚未同步到头部的修改。
+	dirty bool
+	// closed 是否已关闭。
+	closed bool
+	// lock 保护以上字段的互斥锁。
+	lock sync.Mutex
+}
+
+// NewDiskSet 创建一个基于磁盘的集合。
+// 参数dir 存放数据文件的目录。若目录中已有数据则会在其基础上继续使用，
+// 不需要这些数据时应调用Clear方法将其清空。
+// 适用于键的数量达到数千万乃至更多的场景。
+func NewDiskSet(dir string) (SeenSet, error) {
+	if dir == "" {
+		return nil, errors.NewIllegalParameterError("empty directory for disk seen set")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(filepath.Join(dir, diskLogName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	set := &myDiskSet{
+		dir:     dir,
+		logFile: logFile,
+	}
+	info, err := logFile.Stat()
+	if err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	// 丢弃日志末尾不完整的指纹。
+	count := uint64(info.Size()) / 8
+	if err := set.truncateLog(count); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	if err := set.openIndex(); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	return set, nil
+}
+
+func (set *myDiskSet) Kind() Kind {
+	return KIND_DISK
+}
+
+func (set *myDiskSet) Add(key string) (bool, error) {
+	fp := fingerprint(key)
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if set.closed {
+		return false, ErrClosedSeenSet
+	}
+	found, slot, err := set.lookup(fp)
+	if err != nil || found {
+		return false, err
+	}
+	// 先让索引头部失效，以免进程意外退出后索引与日志不一致却未被察觉。
+	if !set.dirty {
+		if err := set.writeIndexHeader(set.indexFile, diskDirtyCount); err != nil {
+			return false, err
+		}
+		set.dirty = true
+	}
+	if err := set.writeSlot(set.indexFile, slot, fp); err != nil {
+		return false, err
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], fp)
+	if _, err := set.logWriter.Write(buf[:]); err != nil {
+		return false, err
+	}
+	set.count++
+	if set.count*2 > set.slots {
+		if err := set.rebuildIndex(set.slots * 2); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func (set *myDiskSet) Contains(key string) (bool, error) {
+	fp := fingerprint(key)
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if set.closed {
+		return false, ErrClosedSeenSet
+	}
+	found, _, err := set.lookup(fp)
+	return found, err
+}
+
+func (set *myDiskSet) Len() uint64 {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	return set.count
+}
+
+func (set *myDiskSet) Bytes() uint64 {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	return diskIndexHeaderSize + set.slots*8 + set.count*8
+}
+
+// MarshalBinary 生成集合的快照。
+// 数据本身已保存在磁盘上，快照中只包含键的数量（8字节，小端序）。
+// 调用本方法会把缓冲中的数据刷入磁盘。
+func (set *myDiskSet) MarshalBinary() ([]byte, error) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if set.closed {
+		return nil, ErrClosedSeenSet
+	}
+	if err := set.sync(); err != nil {
+		return nil, err
+	}
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, set.count)
+	return data, nil
+}
+
+// UnmarshalBinary 用快照恢复集合的状态。
+// 快照之后添加的键都会被丢弃，以便与快照时的状态保持一致。
+func (set *myDiskSet) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return fmt.Errorf("disk seen set: illegal snapshot (length: %d)", len(data))
+	}
+	count := binary.LittleEndian.Uint64(data)
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if set.closed {
+		return ErrClosedSeenSet
+	}
+	if count == set.count {
+		return nil
+	}
+	if count > set.count {
+		return fmt.Errorf("disk seen set: snapshot is newer than data (snapshot: %d, data: %d)",
+			count, set.count)
+	}
+	if err := set.logWriter.Flush(); err != nil {
+		return err
+	}
+	if err := set.truncateLog(count); err != nil {
+		return err
+	}
+	return set.rebuildIndex(minSlots(count))
+}
+
+// Clear 清空集合，并截断磁盘上的指纹日志和指纹索引。
+func (set *myDiskSet) Clear() error {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if set.closed {
+		return ErrClosedSeenSet
+	}
+	// 缓冲中尚未写入的指纹会随截断一起被丢弃。
+	if err := set.truncateLog(0); err != nil {
+		return err
+	}
+	return set.rebuildIndex(diskMinSlots)
+}
+
+func (set *myDiskSet) Close() error {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if set.closed {
+		return nil
+	}
+	set.closed = true
+	err := set.sync()
+	if closeErr := set.logFile.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := set.indexFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// lookup 在指纹索引中查找给定的指纹。
+// 若未找到，则第二个结果值为可以存放该指纹的空槽位。
+func (set *myDiskSet) lookup(fp uint64) (bool, uint64, error) {
+	mask := set.slots - 1
+	slot := fp & mask
+	buf := make([]byte, diskChunkSlots*8)
+	for probed := uint64(0); probed < set.slots; {
+		n := set.slots - slot
+		if n > diskChunkSlots {
+			n = diskChunkSlots
+		}
+		chunk := buf[:n*8]
+		if _, err := set.indexFile.ReadAt(chunk, diskIndexHeaderSize+int64(slot)*8); err != nil {
+			return false, 0, err
+		}
+		for i := uint64(0); i < n; i++ {
+			value := binary.LittleEndian.Uint64(chunk[i*8:])
+			if value == 0 {
+				return false, slot + i, nil
+			}
+			if value == fp {
+				return true, slot + i, nil
+			}
+		}
+		probed += n
+		slot = (slot + n) & mask
+	}
+	return false, 0, fmt.Errorf("disk seen set: full index (slots: %d)", set.slots)
+}
+
+// writeSlot 向给定索引文件的槽位写入指纹。
+func (set *myDiskSet) writeSlot(file *os.File, slot uint64, fp uint64) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], fp)
+	_, err := file.WriteAt(buf[:], diskIndexHeaderSize+int64(slot)*8)
+	return err
+}
+
+// sync 刷新指纹日志并更新指纹索引头部中的键的数量。
+func (set *myDiskSet) sync() error {
+	if err := set.logWriter.Flush(); err != nil {
+		return err
+	}
+	if err := set.writeIndexHeader(set.indexFile, set.count); err != nil {
+		return err
+	}
+	set.dirty = false
+	return nil
+}
+
+// writeIndexHeader 向给定的索引文件写入头部。
+func (set *myDiskSet) writeIndexHeader(file *os.File, count uint64) error {
+	header := make([]byte, diskIndexHeaderSize)
+	copy(header, diskIndexMagic)
+	binary.LittleEndian.PutUint64(header[8:], count)
+	_, err := file.WriteAt(header, 0)
+	return err
+}
+
+// truncateLog 把指纹日志截断为给定数量的指纹。
+func (set *myDiskSet) truncateLog(count uint64) error {
+	if err := set.logFile.Truncate(int64(count) * 8); err != nil {
+		return err
+	}
+	if _, err := set.logFile.Seek(int64(count)*8, io.SeekStart); err != nil {
+		return err
+	}
+	set.count = count
+	set.logWriter = bufio.NewWriterSize(set.logFile, 64<<10)
+	return nil
+}
+
+// openIndex 打开指纹索引文件。
+// 若索引文件不存在或与指纹日志不一致，就根据指纹日志重建索引。
+func (set *myDiskSet) openIndex() error {
+	indexPath := filepath.Join(set.dir, diskIndexName)
+	indexFile, err := os.OpenFile(indexPath, os.O_RDWR, 0644)
+	if err == nil {
+		header := make([]byte, diskIndexHeaderSize)
+		info, statErr := indexFile.Stat()
+		_, readErr := indexFile.ReadAt(header, 0)
+		if statErr == nil && readErr == nil &&
+			string(header[:8]) == diskIndexMagic &&
+			binary.LittleEndian.Uint64(header[8:]) == set.count {
+			slots := uint64(info.Size()-diskIndexHeaderSize) / 8
+			if slots >= diskMinSlots && slots&(slots-1) == 0 && set.count*2 <= slots {
+				set.indexFile = indexFile
+				set.slots = slots
+				return nil
+			}
+		}
+		indexFile.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return set.rebuildIndex(minSlots(set.count))
+}
+
+// rebuildIndex 以给定的槽位数根据指纹日志重建指纹索引。
+func (set *myDiskSet) rebuildIndex(slots uint64) error {
+	if err := set.logWriter.Flush(); err != nil {
+		return err
+	}
+	indexPath := filepath.Join(set.dir, diskIndexName)
+	tmpPath := indexPath + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmpFile.Truncate(diskIndexHeaderSize + int64(slots)*8); err != nil {
+		return fail(err)
+	}
+	newSet := &myDiskSet{indexFile: tmpFile, slots: slots}
+	reader := bufio.NewReaderSize(io.NewSectionReader(set.logFile, 0, int64(set.count)*8), 64<<10)
+	var buf [8]byte
+	for i := uint64(0); i < set.count; i++ {
+		if _, err := io.ReadFull(reader, buf[:]); err != nil {
+			return fail(err)
+		}
+		fp := binary.LittleEndian.Uint64(buf[:])
+		found, slot, err := newSet.lookup(fp)
+		if err != nil {
+			return fail(err)
+		}
+		if !found {
+			if err := set.writeSlot(tmpFile, slot, fp); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := set.writeIndexHeader(tmpFile, set.count); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmpPath, indexPath); err != nil {
+		return fail(err)
+	}
+	if set.indexFile != nil {
+		set.indexFile.Close()
+	}
+	set.indexFile = tmpFile
+	set.slots = slots
+	set.dirty = false
+	return nil
+}
+
+// minSlots 获取容纳给定数量的键所需的最小槽位数。
+func minSlots(count uint64) uint64 {
+	slots := uint64(diskMinSlots)
+	for slots < count*2+2 {
+		slots <<= 1
+	}
+	return slots
+}
@@ -0,0 +1,103 @@
+package seenset
+
+import (
+	"bytes"
+	"sync"
+)
+
+// myExactSet 精确的内存集合的实现类型。
+type myExactSet struct {
+	// keyMap 键的字典。
+	keyMap map[string]struct{}
+	// bytes 所有键的总长度。
+	bytes uint64
+	// rwlock 保护以上字段的读写锁。
+	rwlock sync.RWMutex
+}
+
+// NewExactSet 创建一个精确的内存集合。
+// 集合会保存每一个键，因此占用的内存会随键的数量线性增长。
+func NewExactSet() SeenSet {
+	return &myExactSet{
+		keyMap: map[string]struct{}{},
+	}
+}
+
+func (set *myExactSet) Kind() Kind {
+	return KIND_EXACT
+}
+
+func (set *myExactSet) Add(key string) (bool, error) {
+	set.rwlock.Lock()
+	defer set.rwlock.Unlock()
+	if _, ok := set.keyMap[key]; ok {
+		return false, nil
+	}
+	set.keyMap[key] = struct{}{}
+	set.bytes += uint64(len(key))
+	return true, nil
+}
+
+func (set *myExactSet) Contains(key string) (bool, error) {
+	set.rwlock.RLock()
+	defer set.rwlock.RUnlock()
+	_, ok := set.keyMap[key]
+	return ok, nil
+}
+
+func (set *myExactSet) Len() uint64 {
+	set.rwlock.RLock()
+	defer set.rwlock.RUnlock()
+	return uint64(len(set.keyMap))
+}
+
+func (set *myExactSet) Bytes() uint64 {
+	set.rwlock.RLock()
+	defer set.rwlock.RUnlock()
+	return set.bytes
+}
+
+// MarshalBinary 生成集合的快照。快照由以换行符分隔的所有键组成。
+func (set *myExactSet) MarshalBinary() ([]byte, error) {
+	set.rwlock.RLock()
+	defer set.rwlock.RUnlock()
+	var buf bytes.Buffer
+	buf.Grow(int(set.bytes) + len(set.keyMap))
+	for key := range set.keyMap {
+		buf.WriteString(key)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (set *myExactSet) UnmarshalBinary(data []byte) error {
+	keyMap := map[string]struct{}{}
+	var total uint64
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		key := string(line)
+		if _, ok := keyMap[key]; !ok {
+			keyMap[key] = struct{}{}
+			total += uint64(len(key))
+		}
+	}
+	set.rwlock.Lock()
+	defer set.rwlock.Unlock()
+	set.keyMap = keyMap
+	set.bytes = total
+	return nil
+}
+
+func (set *myExactSet) Clear() error {
+	set.rwlock.Lock()
+	defer set.rwlock.Unlock()
+	set.keyMap = map[string]struct{}{}
+	set.bytes = 0
+	return nil
+}
+
+func (set *myExactSet) Close() error {
+	return nil
+}
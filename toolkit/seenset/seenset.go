@@ -0,0 +1,59 @@
+package seenset
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// Kind 已见集合的种类。
+type Kind string
+
+const (
+	// KIND_EXACT 精确的内存集合。
+	KIND_EXACT Kind = "exact"
+	// KIND_BLOOM 布隆过滤器。
+	KIND_BLOOM Kind = "bloom"
+	// KIND_DISK 基于磁盘的集合。
+	KIND_DISK Kind = "disk"
+)
+
+// ErrClosedSeenSet 表示已见集合已关闭的错误变量。
+var ErrClosedSeenSet = errors.New("closed seen set")
+
+// SeenSet 已见集合的接口类型。
+// 用于记录已经处理过的键（例如URL）以便去重。
+// 该接口的实现类型必须是并发安全的！
+type SeenSet interface {
+	// Kind 获取已见集合的种类。
+	Kind() Kind
+	// Add 向集合添加键。
+	// 若键此前不在集合中，则第一个结果值为true。
+	Add(key string) (bool, error)
+	// Contains 判断键是否已在集合中。
+	// 布隆过滤器可能会以一定的概率误判为已存在。
+	Contains(key string) (bool, error)
+	// Len 获取集合中键的数量。
+	Len() uint64
+	// Bytes 获取集合占用的存储空间的字节数。
+	Bytes() uint64
+	// MarshalBinary 生成集合当前状态的快照。
+	MarshalBinary() ([]byte, error)
+	// UnmarshalBinary 用快照恢复集合的状态。
+	UnmarshalBinary(data []byte) error
+	// Clear 清空集合。
+	Clear() error
+	// Close 关闭集合并释放相关资源。
+	Close() error
+}
+
+// fingerprint 计算键的64位指纹。
+// 结果值不会为0，以便用0表示空位。
+func fingerprint(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	fp := h.Sum64()
+	if fp == 0 {
+		fp = 1
+	}
+	return fp
+}
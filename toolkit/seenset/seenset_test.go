@@ -0,0 +1,295 @@
+package seenset
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// tempDir 创建测试用的临时目录，并在测试结束时删除它。
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "seenset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// newTestSets 创建各种已见集合及其用于恢复快照的空集合。
+func newTestSets(t *testing.T) map[Kind][2]SeenSet {
+	bloom1, err := NewBloomFilter(1000, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bloom2, _ := NewBloomFilter(10, 0.1)
+	disk, err := NewDiskSet(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[Kind][2]SeenSet{
+		KIND_EXACT: {NewExactSet(), NewExactSet()},
+		KIND_BLOOM: {bloom1, bloom2},
+		// 基于磁盘的集合只能用快照回退到同一目录中较早的状态。
+		KIND_DISK: {disk, disk},
+	}
+}
+
+func TestSeenSetAddAndContains(t *testing.T) {
+	for kind, sets := range newTestSets(t) {
+		set := sets[0]
+		if set.Kind() != kind {
+			t.Errorf("kind %q, want %q", set.Kind(), kind)
+		}
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("http://example.com/%d", i)
+			if added, err := set.Add(key); !added || err != nil {
+				t.Fatalf("%s: Add(%q) = %v, %v", kind, key, added, err)
+			}
+			if added, err := set.Add(key); added || err != nil {
+				t.Fatalf("%s: Add(%q) again = %v, %v", kind, key, added, err)
+			}
+		}
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("http://example.com/%d", i)
+			if found, err := set.Contains(key); !found || err != nil {
+				t.Fatalf("%s: Contains(%q) = %v, %v", kind, key, found, err)
+			}
+		}
+		if found, _ := set.Contains("http://example.com/absent"); found {
+			t.Errorf("%s: contains an absent key", kind)
+		}
+		if n := set.Len(); n != 100 {
+			t.Errorf("%s: length %d, want 100", kind, n)
+		}
+		if set.Bytes() == 0 {
+			t.Errorf("%s: zero bytes", kind)
+		}
+		if err := set.Close(); err != nil {
+			t.Errorf("%s: %v", kind, err)
+		}
+	}
+}
+
+func TestSeenSetSnapshot(t *testing.T) {
+	for kind, sets := range newTestSets(t) {
+		set, restored := sets[0], sets[1]
+		for i := 0; i < 50; i++ {
+			set.Add(fmt.Sprintf("key-%d", i))
+		}
+		data, err := set.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		for i := 50; i < 60; i++ {
+			set.Add(fmt.Sprintf("key-%d", i))
+		}
+		if err := restored.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if n := restored.Len(); n != 50 {
+			t.Errorf("%s: restored length %d, want 50", kind, n)
+		}
+		for i := 0; i < 50; i++ {
+			if found, _ := restored.Contains(fmt.Sprintf("key-%d", i)); !found {
+				t.Fatalf("%s: restored set lost key-%d", kind, i)
+			}
+		}
+		var found int
+		for i := 50; i < 60; i++ {
+			if ok, _ := restored.Contains(fmt.Sprintf("key-%d", i)); ok {
+				found++
+			}
+		}
+		if found > 0 {
+			t.Errorf("%s: restored set contains %d keys added after the snapshot", kind, found)
+		}
+		if err := restored.UnmarshalBinary([]byte{1, 2, 3}); err == nil && kind != KIND_EXACT {
+			t.Errorf("%s: no error for a corrupted snapshot", kind)
+		}
+		set.Close()
+		restored.Close()
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const n = 10000
+	const rate = 0.01
+	bf, err := NewBloomFilter(n, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		bf.Add(fmt.Sprintf("http://example.com/page/%d", i))
+	}
+	var falsePositives int
+	for i := 0; i < n; i++ {
+		if found, _ := bf.Contains(fmt.Sprintf("http://example.org/other/%d", i)); found {
+			falsePositives++
+		}
+	}
+	// 留出余量以免测试不稳定。
+	if got := float64(falsePositives) / n; got > 2*rate {
+		t.Fatalf("false positive rate %f, want about %f", got, rate)
+	}
+	// 被误判为已存在的键不会被添加，因此数量可能略少于预期。
+	if added := bf.Len(); added > n || added < n*(1-2*rate) {
+		t.Fatalf("length %d, want about %d", added, n)
+	}
+}
+
+func TestBloomFilterIllegalParameters(t *testing.T) {
+	for _, tc := range []struct {
+		n    uint64
+		rate float64
+	}{
+		{0, 0.01}, {10, 0}, {10, 1}, {10, -0.5},
+	} {
+		if _, err := NewBloomFilter(tc.n, tc.rate); err == nil {
+			t.Errorf("no error for expected number %d and false positive rate %f", tc.n, tc.rate)
+		}
+	}
+}
+
+func TestDiskSetReopen(t *testing.T) {
+	dir := tempDir(t)
+	set, err := NewDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		set.Add(fmt.Sprintf("key-%d", i))
+	}
+	if err := set.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.Add("key-x"); err != ErrClosedSeenSet {
+		t.Fatalf("unexpected error after closing: %v", err)
+	}
+	set, err = NewDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+	if n := set.Len(); n != 1000 {
+		t.Fatalf("reopened length %d, want 1000", n)
+	}
+	for i := 0; i < 1000; i++ {
+		if added, _ := set.Add(fmt.Sprintf("key-%d", i)); added {
+			t.Fatalf("key-%d was added again after reopening", i)
+		}
+	}
+}
+
+func TestDiskSetRecoversFromUnsyncedIndex(t *testing.T) {
+	dir := tempDir(t)
+	set, err := NewDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		set.Add(fmt.Sprintf("key-%d", i))
+	}
+	if _, err := set.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	// 索引中已写入而日志中尚未刷入的键，模拟进程意外退出。
+	for i := 100; i < 110; i++ {
+		set.Add(fmt.Sprintf("key-%d", i))
+	}
+	reopened, err := NewDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if n := reopened.Len(); n != 100 {
+		t.Fatalf("reopened length %d, want 100", n)
+	}
+	for i := 100; i < 110; i++ {
+		if found, _ := reopened.Contains(fmt.Sprintf("key-%d", i)); found {
+			t.Fatalf("the index was not rebuilt: key-%d is still found", i)
+		}
+	}
+	if found, _ := reopened.Contains("key-99"); !found {
+		t.Fatal("key-99 was lost")
+	}
+}
+
+func TestDiskSetGrows(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	set, err := NewDiskSet(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+	const n = diskMinSlots/2 + 100
+	for i := 0; i < n; i++ {
+		if added, err := set.Add(fmt.Sprintf("key-%d", i)); !added || err != nil {
+			t.Fatalf("Add(key-%d) = %v, %v", i, added, err)
+		}
+	}
+	if slots := set.(*myDiskSet).slots; slots != 2*diskMinSlots {
+		t.Fatalf("%d slots, want %d", slots, 2*diskMinSlots)
+	}
+	for _, i := range []int{0, n / 2, n - 1} {
+		if found, _ := set.Contains(fmt.Sprintf("key-%d", i)); !found {
+			t.Fatalf("key-%d was lost after growing", i)
+		}
+	}
+}
+
+func TestSeenSetClear(t *testing.T) {
+	for kind, sets := range newTestSets(t) {
+		set := sets[0]
+		for i := 0; i < 100; i++ {
+			set.Add(fmt.Sprintf("key-%d", i))
+		}
+		if err := set.Clear(); err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if n := set.Len(); n != 0 {
+			t.Fatalf("%s: length %d after clearing", kind, n)
+		}
+		if added, err := set.Add("key-0"); !added || err != nil {
+			t.Fatalf("%s: Add after clearing = %v, %v", kind, added, err)
+		}
+	}
+}
+
+func TestDiskSetClearTruncatesFiles(t *testing.T) {
+	dir := tempDir(t)
+	set, err := NewDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		set.Add(fmt.Sprintf("key-%d", i))
+	}
+	if _, err := set.MarshalBinary(); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	set.Add("key-new")
+	if err := set.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Clear(); err != ErrClosedSeenSet {
+		t.Fatalf("unexpected error of clearing after closing: %v", err)
+	}
+	reopened, err := NewDiskSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if n := reopened.Len(); n != 1 {
+		t.Fatalf("reopened length %d, want 1", n)
+	}
+	if found, _ := reopened.Contains("key-1"); found {
+		t.Fatal("a cleared key was found after reopening")
+	}
+}
@@ -0,0 +1,282 @@
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// MaxSize 站点地图（解压之后）的最大解析长度。
+	MaxSize = 50 << 20
+	// MaxEntries 单个站点地图中的最大条目数量。超出部分会被忽略。
+	MaxEntries = 50000
+	// DefaultPriority 未声明优先级的条目的默认优先级。
+	DefaultPriority = 0.5
+)
+
+var (
+	// ErrNotSitemap 代表内容不是站点地图的错误。
+	ErrNotSitemap = errors.New("not a sitemap")
+	// ErrTooLarge 代表站点地图超出最大解析长度的错误。
+	ErrTooLarge = errors.New("sitemap too large")
+)
+
+// gzipMagic gzip格式的魔数。
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// lastModLayouts 条目的最后修改时间可以使用的W3C日期时间格式。
+var lastModLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// Sitemap 站点地图的解析结果。
+type Sitemap struct {
+	// Index 是否为站点地图索引。
+	// 为true时各条目都是子站点地图的URL，否则是页面的URL。
+	Index bool
+	// Entries 条目列表。
+	Entries []Entry
+}
+
+// Entry 站点地图中的条目。
+type Entry struct {
+	// Loc 条目的URL。
+	Loc string
+	// LastMod 最后修改时间。未声明或无法解析时为零值。
+	LastMod time.Time
+	// ChangeFreq 更新频率。页面条目才可能有此值。
+	ChangeFreq string
+	// Priority 优先级，取值范围为[0, 1]。未声明时为DefaultPriority。
+	Priority float64
+}
+
+// xmlEntry XML格式的站点地图中的url或sitemap元素。
+type xmlEntry struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+}
+
+// Parse 解析站点地图的内容。
+// 支持XML格式的站点地图和站点地图索引，以及每行一个URL的文本格式。
+// gzip压缩的内容会被自动解压。XML内容的编码以XML声明为准。
+func Parse(reader io.Reader) (*Sitemap, error) {
+	return parse(reader, false)
+}
+
+// ParseUTF8 解析已经转换为UTF-8的站点地图的内容。
+// 与Parse的区别在于，它会忽略XML声明中的编码，以免再次解码。
+func ParseUTF8(reader io.Reader) (*Sitemap, error) {
+	return parse(reader, true)
+}
+
+// parse 解析站点地图的内容。
+// 参数utf8 表示内容是否已经是UTF-8。
+func parse(reader io.Reader, utf8 bool) (*Sitemap, error) {
+	br := bufio.NewReader(reader)
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gzipReader, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		br = bufio.NewReader(gzipReader)
+	}
+	limited := &limitedReader{reader: br, remaining: MaxSize}
+	br = bufio.NewReader(limited)
+	first, err := firstNonSpace(br)
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrNotSitemap
+		}
+		return nil, err
+	}
+	var sitemap *Sitemap
+	if first == '<' {
+		sitemap, err = parseXML(br, utf8)
+	} else {
+		sitemap, err = parseText(br)
+	}
+	if limited.exceeded {
+		return nil, ErrTooLarge
+	}
+	return sitemap, err
+}
+
+// parseXML 解析XML格式的站点地图。
+// 参数utf8 表示内容是否已经是UTF-8。
+func parseXML(reader io.Reader, utf8 bool) (*Sitemap, error) {
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = charset.NewReaderLabel
+	if utf8 {
+		decoder.CharsetReader = keepCharset
+	}
+	decoder.Strict = false
+	sitemap := &Sitemap{}
+	var entryName string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF && entryName != "" {
+				return sitemap, nil
+			}
+			if entryName == "" {
+				return nil, ErrNotSitemap
+			}
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if entryName == "" {
+			switch strings.ToLower(start.Name.Local) {
+			case "urlset":
+				entryName = "url"
+			case "sitemapindex":
+				entryName = "sitemap"
+				sitemap.Index = true
+			default:
+				return nil, ErrNotSitemap
+			}
+			continue
+		}
+		if strings.ToLower(start.Name.Local) != entryName {
+			if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var elem xmlEntry
+		if err := decoder.DecodeElement(&elem, &start); err != nil {
+			return nil, err
+		}
+		if entry, ok := elem.entry(); ok {
+			sitemap.Entries = append(sitemap.Entries, entry)
+			if len(sitemap.Entries) >= MaxEntries {
+				return sitemap, nil
+			}
+		}
+	}
+}
+
+// parseText 解析每行一个URL的文本格式的站点地图。
+func parseText(reader io.Reader) (*Sitemap, error) {
+	sitemap := &Sitemap{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "http://") && !strings.HasPrefix(line, "https://") {
+			return nil, ErrNotSitemap
+		}
+		sitemap.Entries = append(sitemap.Entries, Entry{Loc: line, Priority: DefaultPriority})
+		if len(sitemap.Entries) >= MaxEntries {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sitemap, nil
+}
+
+// entry 把XML元素转换为条目。没有URL的元素会被忽略。
+func (elem xmlEntry) entry() (Entry, bool) {
+	loc := strings.TrimSpace(elem.Loc)
+	if loc == "" {
+		return Entry{}, false
+	}
+	entry := Entry{
+		Loc:        loc,
+		LastMod:    parseLastMod(elem.LastMod),
+		ChangeFreq: strings.ToLower(strings.TrimSpace(elem.ChangeFreq)),
+		Priority:   DefaultPriority,
+	}
+	if p, err := strconv.ParseFloat(strings.TrimSpace(elem.Priority), 64); err == nil && p >= 0 && p <= 1 {
+		entry.Priority = p
+	}
+	return entry, true
+}
+
+// parseLastMod 解析最后修改时间。无法解析时返回零值。
+func parseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// keepCharset 不做任何转换的字符集读取器，用于已经转换为UTF-8的内容。
+func keepCharset(label string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
+
+// firstNonSpace 获取第一个非空白字节，但不会将其读出。
+func firstNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		// 跳过UTF-8的字节顺序标记。
+		if b == 0xef {
+			if bom, _ := reader.Peek(2); bytes.Equal(bom, []byte{0xbb, 0xbf}) {
+				reader.Discard(2)
+				continue
+			}
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, reader.UnreadByte()
+		}
+	}
+}
+
+// limitedReader 最多读取给定长度的读取器，并记录是否超出了该长度。
+type limitedReader struct {
+	// reader 底层的读取器。
+	reader io.Reader
+	// remaining 剩余可读取的长度。
+	remaining int64
+	// exceeded 是否超出了最大长度。
+	exceeded bool
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.remaining <= 0 {
+		// 再多读一个字节以判断是否恰好读完。
+		var one [1]byte
+		if n, _ := lr.reader.Read(one[:]); n > 0 {
+			lr.exceeded = true
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > lr.remaining {
+		p = p[:lr.remaining]
+	}
+	n, err := lr.reader.Read(p)
+	lr.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,94 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestParseURLSet(t *testing.T) {
+	sitemap, err := Parse(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc> https://a.com/x </loc><lastmod>2024-01-02</lastmod><changefreq>Daily</changefreq><priority>0.8</priority></url>
+<url><loc>https://a.com/y</loc><lastmod>2024-01-02T10:00:00+08:00</lastmod><priority>7</priority></url>
+<url><lastmod>2024-01-02</lastmod></url>
+</urlset>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sitemap.Index || len(sitemap.Entries) != 2 {
+		t.Fatalf("unexpected sitemap: %+v", sitemap)
+	}
+	x, y := sitemap.Entries[0], sitemap.Entries[1]
+	if x.Loc != "https://a.com/x" || x.Priority != 0.8 || x.ChangeFreq != "daily" ||
+		!x.LastMod.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected entry: %+v", x)
+	}
+	if y.Priority != DefaultPriority || y.LastMod.IsZero() {
+		t.Errorf("unexpected entry: %+v", y)
+	}
+}
+
+func TestParseIndexGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>https://a.com/1.xml</loc></sitemap><sitemap><loc>https://a.com/2.xml.gz</loc></sitemap>
+</sitemapindex>`))
+	gz.Close()
+	sitemap, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sitemap.Index || len(sitemap.Entries) != 2 || sitemap.Entries[1].Loc != "https://a.com/2.xml.gz" {
+		t.Fatalf("unexpected sitemap: %+v", sitemap)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	sitemap, err := Parse(strings.NewReader("\xef\xbb\xbfhttps://a.com/1\n\nhttps://a.com/2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sitemap.Entries) != 2 || sitemap.Entries[0].Loc != "https://a.com/1" {
+		t.Fatalf("unexpected sitemap: %+v", sitemap)
+	}
+}
+
+func TestParseNotSitemap(t *testing.T) {
+	for _, content := range []string{"", "<html><body/></html>", "hello world", "<rss/>"} {
+		if _, err := Parse(strings.NewReader(content)); err != ErrNotSitemap {
+			t.Errorf("%q: error %v, want %v", content, err, ErrNotSitemap)
+		}
+	}
+}
+
+func TestParseCharset(t *testing.T) {
+	const loc = "https://a.com/café"
+	latin1, _ := charmap.Windows1252.NewEncoder().String(loc)
+	doc := func(loc string) string {
+		return `<?xml version="1.0" encoding="windows-1252"?><urlset><url><loc>` + loc + `</loc></url></urlset>`
+	}
+	sitemap, err := Parse(strings.NewReader(doc(latin1)))
+	if err != nil || sitemap.Entries[0].Loc != loc {
+		t.Fatalf("Parse: %+v, %v", sitemap, err)
+	}
+	sitemap, err = ParseUTF8(strings.NewReader(doc(loc)))
+	if err != nil || sitemap.Entries[0].Loc != loc {
+		t.Fatalf("ParseUTF8: %+v, %v", sitemap, err)
+	}
+}
+
+func TestParseTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("<urlset><url><loc>https://a.com/x</loc></url><!--")
+	buf.Write(bytes.Repeat([]byte("padding "), MaxSize/8))
+	buf.WriteString("--></urlset>")
+	if _, err := Parse(&buf); err != ErrTooLarge {
+		t.Fatalf("error %v, want %v", err, ErrTooLarge)
+	}
+}